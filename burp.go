@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// burpDoc writes captures in the XML item format Burp Suite uses to save and
+// load items (--burp), so the site map can be populated without sending
+// traffic. Each item carries a synthetic request for the URL and, when the
+// archive recorded a status, a synthetic empty response with that status and
+// MIME type.
+type burpDoc struct{ captureList }
+
+// burpItems is the document element. Values are written as escaped character
+// data; Burp reads that as well as CDATA sections, which encoding/xml does not
+// produce.
+type burpItems struct {
+	XMLName     xml.Name   `xml:"items"`
+	BurpVersion string     `xml:"burpVersion,attr"`
+	ExportTime  string     `xml:"exportTime,attr"`
+	Items       []burpItem `xml:"item"`
+}
+
+type burpItem struct {
+	Time           string      `xml:"time"`
+	URL            string      `xml:"url"`
+	Host           burpHost    `xml:"host"`
+	Port           string      `xml:"port"`
+	Protocol       string      `xml:"protocol"`
+	Method         string      `xml:"method"`
+	Path           string      `xml:"path"`
+	Extension      string      `xml:"extension"`
+	Request        burpMessage `xml:"request"`
+	Status         string      `xml:"status"`
+	ResponseLength int         `xml:"responselength"`
+	MimeType       string      `xml:"mimetype"`
+	Response       burpMessage `xml:"response"`
+	Comment        string      `xml:"comment"`
+}
+
+type burpHost struct {
+	IP   string `xml:"ip,attr"`
+	Name string `xml:",chardata"`
+}
+
+type burpMessage struct {
+	Base64 bool   `xml:"base64,attr"`
+	Data   string `xml:",chardata"`
+}
+
+// burpTime is the Java Date.toString layout Burp writes.
+const burpTime = "Mon Jan 02 15:04:05 MST 2006"
+
+func newBurpDoc(links bool) *burpDoc {
+	return &burpDoc{captureList{links: links}}
+}
+
+func (d *burpDoc) write(w io.Writer) error {
+	doc := burpItems{
+		BurpVersion: "gowaybackgo " + appVersion(),
+		ExportTime:  time.Now().UTC().Format(burpTime),
+	}
+	for _, c := range d.sorted() {
+		if it, ok := burpItemOf(c); ok {
+			doc.Items = append(doc.Items, it)
+		}
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// burpItemOf builds the Burp item of c; ok is false for URLs Burp cannot
+// represent (no host, or a scheme other than http/https).
+func burpItemOf(c capture) (burpItem, bool) {
+	u, err := url.Parse(c.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return burpItem{}, false
+	}
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	reqPath := u.RequestURI()
+	it := burpItem{
+		URL:       c.URL,
+		Host:      burpHost{Name: u.Hostname()},
+		Port:      port,
+		Protocol:  u.Scheme,
+		Method:    "GET",
+		Path:      reqPath,
+		Extension: strings.TrimPrefix(path.Ext(u.Path), "."),
+		Request: burpMessage{Base64: true, Data: base64.StdEncoding.EncodeToString(
+			[]byte("GET " + reqPath + " HTTP/1.1\r\nHost: " + u.Host + "\r\n\r\n"))},
+		MimeType: burpMimeType(c.Mime),
+		Comment:  c.comment(),
+	}
+	if !c.Time.IsZero() {
+		it.Time = c.Time.Format(burpTime)
+	}
+	if c.Status != 0 {
+		it.Status = fmt.Sprint(c.Status)
+		resp := fmt.Sprintf("HTTP/1.1 %d \r\n", c.Status)
+		if c.Mime != "" {
+			resp += "Content-Type: " + c.Mime + "\r\n"
+		}
+		resp += "Content-Length: 0\r\n\r\n"
+		it.Response = burpMessage{Base64: true, Data: base64.StdEncoding.EncodeToString([]byte(resp))}
+		it.ResponseLength = len(resp)
+	}
+	return it, true
+}
+
+// burpMimeType maps a MIME type to the short names Burp shows in its MIME
+// type column; unknown types are left blank, as Burp does.
+func burpMimeType(mime string) string {
+	mime = strings.ToLower(mime)
+	switch {
+	case strings.Contains(mime, "html"):
+		return "HTML"
+	case strings.Contains(mime, "json"):
+		return "JSON"
+	case strings.Contains(mime, "javascript") || strings.Contains(mime, "ecmascript"):
+		return "script"
+	case strings.Contains(mime, "css"):
+		return "CSS"
+	case strings.Contains(mime, "xml"):
+		return "XML"
+	case strings.HasPrefix(mime, "text/"):
+		return "text"
+	case strings.HasPrefix(mime, "image/"):
+		return strings.ToUpper(strings.TrimPrefix(mime, "image/"))
+	}
+	return ""
+}
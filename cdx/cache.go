@@ -0,0 +1,140 @@
+package cdx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNotCached is returned (wrapped) by Client.Get in offline mode when the
+// requested URL has no cache entry.
+var ErrNotCached = errors.New("cdx: not in cache (offline)")
+
+// DiskCache stores raw response bodies on disk, one file per request URL.
+// Entries are written through a temporary file and renamed into place only
+// once the whole body has been read, so an interrupted download never leaves
+// a truncated entry. A DiskCache is safe for concurrent use.
+type DiskCache struct {
+	Dir string        // directory holding the entries; created on first write
+	TTL time.Duration // entries older than this are refetched; 0 never expires
+}
+
+// NewDiskCache returns a cache rooted at dir whose entries expire after ttl.
+func NewDiskCache(dir string, ttl time.Duration) *DiskCache {
+	return &DiskCache{Dir: dir, TTL: ttl}
+}
+
+// path returns the entry file for rawURL. URLs are hashed: they are long and
+// full of characters that are awkward in file names.
+func (dc *DiskCache) path(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(dc.Dir, hex.EncodeToString(sum[:])+".cdx")
+}
+
+// Open returns the cached body of rawURL. Expired entries are misses unless
+// stale is set, which offline mode uses to serve whatever it has.
+func (dc *DiskCache) Open(rawURL string, stale bool) (io.ReadCloser, bool) {
+	p := dc.path(rawURL)
+	fi, err := os.Stat(p)
+	if err != nil || (!stale && dc.TTL > 0 && time.Since(fi.ModTime()) > dc.TTL) {
+		return nil, false
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, false
+	}
+	return f, true
+}
+
+// tee wraps body so that reading it to the end also stores it as rawURL's
+// entry. If the entry cannot be created the body is returned unwrapped.
+func (dc *DiskCache) tee(rawURL string, body io.ReadCloser) io.ReadCloser {
+	if err := os.MkdirAll(dc.Dir, 0o755); err != nil {
+		return body
+	}
+	tmp, err := os.CreateTemp(dc.Dir, ".tmp*")
+	if err != nil {
+		return body
+	}
+	return &cacheWriter{body: body, tmp: tmp, dst: dc.path(rawURL)}
+}
+
+// cacheWriter copies a response body into a temporary file as it is read,
+// renaming it into the cache on EOF. A body closed early is drained first so
+// short reads (a page count, a consumer that stopped iterating) still produce
+// an entry; a failed read or write discards it.
+type cacheWriter struct {
+	body io.ReadCloser
+	tmp  *os.File
+	dst  string
+	err  error // first write or read error; the entry is discarded
+	done bool  // entry committed or discarded
+}
+
+func (cw *cacheWriter) Read(p []byte) (int, error) {
+	n, err := cw.body.Read(p)
+	if n > 0 && cw.err == nil {
+		_, cw.err = cw.tmp.Write(p[:n])
+	}
+	switch {
+	case err == io.EOF:
+		cw.finish()
+	case err != nil && cw.err == nil:
+		cw.err = err
+	}
+	return n, err
+}
+
+func (cw *cacheWriter) Close() error {
+	if !cw.done && cw.err == nil {
+		io.Copy(io.Discard, cw) // Read commits the entry at EOF
+	}
+	cw.finish()
+	return cw.body.Close()
+}
+
+// finish commits the entry if the body was read without error, otherwise
+// removes the temporary file.
+func (cw *cacheWriter) finish() {
+	if cw.done {
+		return
+	}
+	cw.done = true
+	err := cw.tmp.Close()
+	if cw.err == nil && err == nil {
+		err = os.Rename(cw.tmp.Name(), cw.dst)
+	}
+	if cw.err != nil || err != nil {
+		os.Remove(cw.tmp.Name())
+	}
+}
+
+// cached serves rawURL from c.Cache as a synthetic 200 response. ok is false on
+// a miss; in offline mode a miss is an error wrapping ErrNotCached instead.
+func (c *Client) cached(rawURL string) (resp *http.Response, ok bool, err error) {
+	if c.Cache == nil {
+		if c.Offline {
+			return nil, false, fmt.Errorf("%w: no cache configured", ErrNotCached)
+		}
+		return nil, false, nil
+	}
+	body, ok := c.Cache.Open(rawURL, c.Offline)
+	if !ok {
+		if c.Offline {
+			return nil, false, fmt.Errorf("%w: %s", ErrNotCached, rawURL)
+		}
+		return nil, false, nil
+	}
+	return &http.Response{
+		Status:     "200 OK (cached)",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       body,
+	}, true, nil
+}
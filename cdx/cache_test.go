@@ -0,0 +1,97 @@
+package cdx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDiskCache(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		fmt.Fprintf(w, "body of %s\n", req.URL.Path)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	c := testClient(srv)
+	c.Cache = NewDiskCache(dir, time.Hour)
+	get := func(path string) (string, error) {
+		resp, err := c.Get(context.Background(), srv.URL+path)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		return string(b), err
+	}
+
+	for i := 0; i < 2; i++ {
+		if body, err := get("/a"); err != nil || body != "body of /a\n" {
+			t.Fatalf("get #%d = %q, %v", i, body, err)
+		}
+	}
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Errorf("server hits = %d, want 1 (second get served from cache)", got)
+	}
+
+	// A body closed before EOF is drained, so the entry is still written.
+	resp, err := c.Get(context.Background(), srv.URL+"/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if _, ok := c.Cache.Open(srv.URL+"/b", false); !ok {
+		t.Error("entry for an early-closed body was not committed")
+	}
+
+	// Expired entries are refetched online but still served offline.
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(c.Cache.path(srv.URL+"/a"), old, old)
+	if _, err := get("/a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&hits); got != 3 {
+		t.Errorf("server hits = %d, want 3 (expired entry refetched)", got)
+	}
+	os.Chtimes(c.Cache.path(srv.URL+"/a"), old, old)
+	c.Offline = true
+	if body, err := get("/a"); err != nil || body != "body of /a\n" {
+		t.Errorf("offline get of stale entry = %q, %v", body, err)
+	}
+	if _, err := get("/missing"); !errors.Is(err, ErrNotCached) {
+		t.Errorf("offline miss error = %v, want ErrNotCached", err)
+	}
+	if got := atomic.LoadInt32(&hits); got != 3 {
+		t.Errorf("server hits = %d, want 3 (offline never fetches)", got)
+	}
+
+	// No temporary files are left behind.
+	if tmps, _ := filepath.Glob(filepath.Join(dir, ".tmp*")); len(tmps) != 0 {
+		t.Errorf("leftover temp files: %v", tmps)
+	}
+}
+
+func TestDiskCacheSkipsErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+	c := testClient(srv)
+	c.Cache = NewDiskCache(t.TempDir(), 0)
+	if _, err := c.Get(context.Background(), srv.URL); err == nil {
+		t.Fatal("expected an error for HTTP 404")
+	}
+	if _, ok := c.Cache.Open(srv.URL, false); ok {
+		t.Error("an error response must not be cached")
+	}
+}
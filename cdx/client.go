@@ -0,0 +1,329 @@
+// Package cdx is a client for the Wayback Machine CDX server API. It builds
+// search URLs, fetches result pages with retry and back-off, and streams the
+// captures back as typed records.
+//
+//	c := cdx.NewClient(nil)
+//	q := cdx.Query{URL: "example.com/*", Fields: []string{cdx.FieldOriginal, cdx.FieldTimestamp}}
+//	for rec, err := range c.Records(ctx, q) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(rec.Timestamp, rec.Original)
+//	}
+package cdx
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultEndpoint is the Wayback Machine CDX search endpoint.
+const DefaultEndpoint = "https://web.archive.org/cdx/search/cdx"
+
+// DefaultUserAgent is sent when Client.UserAgent is empty. web.archive.org
+// throttles or blocks the default Go client UA, so identify the tool
+// explicitly.
+const DefaultUserAgent = "gowaybackgo (+github.com/OoS-MaMaD/gowaybackgo)"
+
+// DefaultCursorLimit is the cursor batch size used when Query.Limit is unset.
+const DefaultCursorLimit = 10000
+
+// ErrBadPageCount is returned (wrapped) by NumPages when the server's
+// showNumPages reply is not a number.
+var ErrBadPageCount = errors.New("cdx: unparsable page count")
+
+// StatusError reports a non-2xx HTTP response.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string { return fmt.Sprintf("HTTP %d", e.Code) }
+
+// isStatus reports whether err is a StatusError with the given code.
+func isStatus(err error, code int) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.Code == code
+}
+
+// errStopped ends a Stream early when a Records consumer stops iterating.
+var errStopped = errors.New("cdx: iteration stopped")
+
+// Client fetches CDX results. The zero value is usable; NewClient fills in the
+// defaults explicitly. A Client is safe for concurrent use once configured.
+type Client struct {
+	HTTPClient *http.Client // nil uses http.DefaultClient
+	Endpoint   string       // CDX search URL; empty uses DefaultEndpoint
+	UserAgent  string       // empty uses DefaultUserAgent
+	Retries    int          // attempts per request; values < 1 mean a single attempt
+
+	// Cache, when set, serves responses it holds without touching the network
+	// and stores successful responses it does not. With Offline set, a URL the
+	// cache lacks fails with ErrNotCached instead of being fetched, and expired
+	// entries are still served.
+	Cache   *DiskCache
+	Offline bool
+
+	// Limiter, when set, gates every network attempt (cache hits bypass it)
+	// and is told about server push-back, so all requests sharing it slow
+	// down and pause together.
+	Limiter *Limiter
+
+	// Stats, when set, counts requests, retries, status codes, cache hits,
+	// and bytes read.
+	Stats *Stats
+
+	// Logf, when set, receives transient notices such as retries and back-off.
+	Logf func(format string, a ...any)
+}
+
+// NewClient returns a Client using hc (http.DefaultClient when nil), the
+// Wayback endpoint, and three attempts per request.
+func NewClient(hc *http.Client) *Client {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return &Client{
+		HTTPClient: hc,
+		Endpoint:   DefaultEndpoint,
+		UserAgent:  DefaultUserAgent,
+		Retries:    3,
+	}
+}
+
+func (c *Client) endpoint() string {
+	if c.Endpoint == "" {
+		return DefaultEndpoint
+	}
+	return c.Endpoint
+}
+
+func (c *Client) logf(format string, a ...any) {
+	if c.Logf != nil {
+		c.Logf(format, a...)
+	}
+}
+
+// Get fetches rawURL, making up to Retries attempts with back-off. Non-2xx
+// status codes are surfaced as errors: 429 and 5xx are retried with a longer
+// back-off, other 4xx fail fast. Context cancellation is honoured between
+// attempts. The caller must close the returned body.
+//
+// With a Cache, hits are served from disk and a fetched body is stored once
+// it has been read in full (or closed, which drains it).
+func (c *Client) Get(ctx context.Context, rawURL string) (*http.Response, error) {
+	if resp, ok, err := c.cached(rawURL); ok || err != nil {
+		if ok && c.Stats != nil {
+			c.Stats.CacheHits.Add(1)
+		}
+		return resp, err
+	}
+	resp, err := c.fetch(ctx, rawURL)
+	if err == nil && c.Cache != nil {
+		resp.Body = c.Cache.tee(rawURL, resp.Body)
+	}
+	return resp, err
+}
+
+// fetch performs Get's network request and retries.
+func (c *Client) fetch(ctx context.Context, rawURL string) (*http.Response, error) {
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	ua := c.UserAgent
+	if ua == "" {
+		ua = DefaultUserAgent
+	}
+	maxRetries := c.Retries
+	if maxRetries < 1 {
+		maxRetries = 1
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		// Check context before every attempt; the limiter also holds the
+		// attempt while the server has asked everyone to back off.
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if c.Limiter != nil {
+			if err := c.Limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return nil, err // non-retryable
+		}
+		req.Header.Set("User-Agent", ua)
+
+		if c.Stats != nil {
+			c.Stats.Requests.Add(1)
+			if attempt > 1 {
+				c.Stats.Retries.Add(1)
+			}
+		}
+		resp, err := hc.Do(req)
+		if err == nil && c.Stats != nil {
+			c.Stats.addStatus(resp.StatusCode)
+		}
+		if err == nil && resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+			if c.Limiter != nil {
+				c.Limiter.Success()
+			}
+			if c.Stats != nil {
+				resp.Body = countingBody{resp.Body, &c.Stats.Bytes}
+			}
+			return resp, nil
+		}
+		lastErr = err
+		if err == nil {
+			lastErr = &StatusError{Code: resp.StatusCode}
+			resp.Body.Close()
+		}
+
+		backoff, shared, retry := NextRetry(resp, attempt)
+		switch {
+		case !retry:
+			return nil, lastErr
+		case shared && c.Limiter != nil:
+			// Pause every request sharing the limiter, not just this one;
+			// the next attempt's Wait sleeps out the pause.
+			c.Limiter.Backoff(backoff)
+			c.logf("HTTP %d on page fetch; pausing all requests for %s (attempt %d/%d)",
+				resp.StatusCode, backoff, attempt, maxRetries)
+			continue
+		case attempt == maxRetries:
+			continue
+		case shared:
+			c.logf("HTTP %d on page fetch; backing off %s (attempt %d/%d)",
+				resp.StatusCode, backoff, attempt, maxRetries)
+		default:
+			c.logf("retrying page fetch (attempt %d/%d): %v", attempt, maxRetries, lastErr)
+		}
+		if !Sleep(ctx, backoff) {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, lastErr
+}
+
+// NumPages asks the server how many result pages q spans. An empty reply is
+// reported as 0 pages; a non-numeric one as an error wrapping ErrBadPageCount.
+func (c *Client) NumPages(ctx context.Context, q Query) (int, error) {
+	resp, err := c.Get(ctx, c.NumPagesURL(q))
+	if err != nil {
+		return 0, fmt.Errorf("fetch page count: %w", err)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	numStr := ""
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			numStr = line
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("read page-count response: %w", err)
+	}
+
+	if numStr == "" {
+		return 0, nil
+	}
+	pages, err := strconv.Atoi(numStr)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrBadPageCount, numStr)
+	}
+	return pages, nil
+}
+
+// Page fetches one page of q's results and calls fn with each non-blank line,
+// trimmed, in the column order of q.Fields. An error from fn stops the read
+// and is returned as-is.
+func (c *Client) Page(ctx context.Context, q Query, page int, fn func(line string) error) error {
+	resp, err := c.Get(ctx, c.PageURL(q, page))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return eachLine(resp.Body, fn)
+}
+
+// Cursor fetches the batch of q's results that starts at resumeKey ("" for
+// the first batch) and calls fn with each result line. It returns the resume
+// key of the next batch, or "" after the last one. Unlike page numbers, which
+// rely on showNumPages, cursor paging walks any result set to the end.
+func (c *Client) Cursor(ctx context.Context, q Query, resumeKey string, fn func(line string) error) (string, error) {
+	resp, err := c.Get(ctx, c.CursorURL(q, resumeKey))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Results are followed by a blank line and then the next resume key. The
+	// key line is only recognisable after the blank, so results are passed on
+	// as they arrive.
+	next := ""
+	sawBlank := false
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "":
+			sawBlank = true
+		case sawBlank:
+			next = line
+		default:
+			if err := fn(line); err != nil {
+				return "", err
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+	return next, nil
+}
+
+// eachLine calls fn with each non-blank, trimmed line of r, returning fn's
+// first error as-is. Lines up to 1 MiB are accepted; archived URLs can be long.
+func eachLine(r io.Reader, fn func(line string) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	return nil
+}
+
+// Stream calls fn with each record of q from the Wayback CDX API. See Stream.
+func (c *Client) Stream(ctx context.Context, q Query, fn func(Record) error) error {
+	return Stream(ctx, c, q, fn)
+}
+
+// Records returns an iterator over q's results from the Wayback CDX API. See
+// Records.
+func (c *Client) Records(ctx context.Context, q Query) iter.Seq2[Record, error] {
+	return Records(ctx, c, q)
+}
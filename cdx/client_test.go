@@ -0,0 +1,271 @@
+package cdx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pagedServer serves a showNumPages reply and two pages of original/timestamp
+// lines, like the Wayback CDX API.
+func pagedServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		if q.Get("showNumPages") == "true" {
+			fmt.Fprintln(w, "2")
+			return
+		}
+		switch q.Get("page") {
+		case "0":
+			fmt.Fprintln(w, "http://example.com/a 20200101000000")
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "http://example.com/b -")
+		case "1":
+			fmt.Fprintln(w, "http://example.com/c 20210101000000")
+		}
+	}))
+}
+
+func testClient(srv *httptest.Server) *Client {
+	c := NewClient(srv.Client())
+	c.Endpoint = srv.URL
+	return c
+}
+
+func TestPageURL(t *testing.T) {
+	c := NewClient(nil)
+	q := Query{
+		URL:      "example.com/api*",
+		From:     "2020",
+		To:       "2022",
+		Filters:  []string{"statuscode:200", "mimetype:text/html"},
+		Fields:   []string{FieldOriginal, FieldTimestamp},
+		Collapse: "urlkey",
+	}
+
+	u, err := url.Parse(c.PageURL(q, 3))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != DefaultEndpoint {
+		t.Errorf("endpoint = %q, want %q", got, DefaultEndpoint)
+	}
+	v := u.Query()
+	for k, want := range map[string]string{
+		"url": "example.com/api*", "fl": "original,timestamp", "collapse": "urlkey",
+		"page": "3", "from": "2020", "to": "2022",
+	} {
+		if got := v.Get(k); got != want {
+			t.Errorf("query %q = %q, want %q", k, got, want)
+		}
+	}
+	if len(v["filter"]) != 2 {
+		t.Errorf("filters = %v, want 2", v["filter"])
+	}
+
+	u, err = url.Parse(c.NumPagesURL(Query{URL: "example.com*"}))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	v = u.Query()
+	if v.Get("showNumPages") != "true" || v.Get("page") != "" || v.Get("fl") != "" || v.Get("from") != "" {
+		t.Errorf("page-count URL has unexpected params: %v", v)
+	}
+}
+
+func TestGet(t *testing.T) {
+	t.Run("success returns response without retry and sends UA", func(t *testing.T) {
+		var hits int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			if req.Header.Get("User-Agent") != DefaultUserAgent {
+				t.Errorf("User-Agent = %q, want %q", req.Header.Get("User-Agent"), DefaultUserAgent)
+			}
+			fmt.Fprintln(w, "ok")
+		}))
+		defer srv.Close()
+		resp, err := testClient(srv).Get(context.Background(), srv.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if got := atomic.LoadInt32(&hits); got != 1 {
+			t.Errorf("hits = %d, want 1", got)
+		}
+	})
+
+	t.Run("404 fails fast without retrying", func(t *testing.T) {
+		var hits int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer srv.Close()
+		if _, err := testClient(srv).Get(context.Background(), srv.URL); err == nil {
+			t.Fatal("expected an error for HTTP 404")
+		}
+		if got := atomic.LoadInt32(&hits); got != 1 {
+			t.Errorf("hits = %d, want 1 (a 404 must not be retried)", got)
+		}
+	})
+
+	t.Run("already-cancelled context returns immediately", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := NewClient(nil).Get(ctx, "http://example.invalid"); err == nil {
+			t.Fatal("expected an error on a cancelled context")
+		}
+	})
+}
+
+func TestNumPages(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    int
+		wantBad bool
+	}{
+		{"number", "\n 7 \n", 7, false},
+		{"empty reply is zero pages", "", 0, false},
+		{"garbage", "<html>", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+			got, err := testClient(srv).NumPages(context.Background(), Query{URL: "example.com*"})
+			if tt.wantBad {
+				if !errors.Is(err, ErrBadPageCount) {
+					t.Fatalf("err = %v, want ErrBadPageCount", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("NumPages = %d, %v; want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecords(t *testing.T) {
+	srv := pagedServer(t)
+	defer srv.Close()
+	c := testClient(srv)
+	q := Query{URL: "example.com*", Fields: []string{FieldOriginal, FieldTimestamp}}
+
+	var got []Record
+	for rec, err := range c.Records(context.Background(), q) {
+		if err != nil {
+			t.Fatalf("Records: %v", err)
+		}
+		got = append(got, rec)
+	}
+	want := []Record{
+		{Original: "http://example.com/a", Timestamp: "20200101000000"},
+		{Original: "http://example.com/b"},
+		{Original: "http://example.com/c", Timestamp: "20210101000000"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d records, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("record %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// Breaking out of the loop must stop the stream without an error.
+	n := 0
+	for _, err := range c.Records(context.Background(), q) {
+		if err != nil {
+			t.Fatalf("unexpected error after break: %v", err)
+		}
+		n++
+		break
+	}
+	if n != 1 {
+		t.Errorf("iterated %d records before break, want 1", n)
+	}
+}
+
+func TestStreamCallbackError(t *testing.T) {
+	srv := pagedServer(t)
+	defer srv.Close()
+	boom := errors.New("boom")
+	err := testClient(srv).Stream(context.Background(), Query{URL: "example.com*"}, func(Record) error { return boom })
+	if !errors.Is(err, boom) {
+		t.Errorf("Stream error = %v, want the callback's error", err)
+	}
+}
+
+func TestSleep(t *testing.T) {
+	if !Sleep(context.Background(), time.Millisecond) {
+		t.Error("Sleep should return true after the delay elapses")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if Sleep(ctx, time.Hour) {
+		t.Error("Sleep should return false when the context is cancelled")
+	}
+}
+
+// cursorServer serves three resume-key batches of one URL each and a garbage
+// showNumPages reply, like a CDX server that cannot count pages.
+func cursorServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		if q.Get("showNumPages") == "true" {
+			fmt.Fprintln(w, "<html>busy</html>")
+			return
+		}
+		if q.Get("showResumeKey") != "true" || q.Get("limit") == "" || q.Get("page") != "" {
+			t.Errorf("cursor request has wrong params: %s", req.URL.RawQuery)
+		}
+		switch q.Get("resumeKey") {
+		case "":
+			fmt.Fprint(w, "http://x/1\n\nkey+1\n")
+		case "key+1": // keys round-trip verbatim through URL encoding
+			fmt.Fprint(w, "http://x/2\n\nkey+2\n")
+		case "key+2":
+			fmt.Fprint(w, "http://x/3\n") // last batch: no key
+		default:
+			t.Errorf("unexpected resumeKey %q", q.Get("resumeKey"))
+		}
+	}))
+}
+
+func TestCursor(t *testing.T) {
+	srv := cursorServer(t)
+	defer srv.Close()
+	c := testClient(srv)
+	q := Query{URL: "x/*", Fields: []string{FieldOriginal}, Limit: 1}
+
+	var lines []string
+	next, err := c.Cursor(context.Background(), q, "", func(line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+	if err != nil || next != "key+1" || len(lines) != 1 || lines[0] != "http://x/1" {
+		t.Fatalf("Cursor = %q, %v, lines %v; want key+1 and one result", next, err, lines)
+	}
+
+	// Stream falls back to Walk when the page count is unusable.
+	var got []string
+	err = c.Stream(context.Background(), q, func(rec Record) error {
+		got = append(got, rec.Original)
+		return nil
+	})
+	if err != nil || len(got) != 3 || got[2] != "http://x/3" {
+		t.Errorf("Stream via resume keys = %v, %v; want 3 records", got, err)
+	}
+}
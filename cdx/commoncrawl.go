@@ -0,0 +1,261 @@
+package cdx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CommonCrawlServer is the Common Crawl URL index server.
+const CommonCrawlServer = "https://index.commoncrawl.org"
+
+// Crawl is one Common Crawl index, as listed by the server's collinfo.json.
+type Crawl struct {
+	ID     string `json:"id"` // e.g. "CC-MAIN-2024-33"
+	Name   string `json:"name"`
+	CDXAPI string `json:"cdx-api"`
+}
+
+// CommonCrawl is a Source backed by the Common Crawl CDX index server. Every
+// crawl has its own index with its own pagination; a CommonCrawl spans the
+// crawls in Indexes, numbering their pages one after another so callers can
+// treat them as a single paginated source.
+type CommonCrawl struct {
+	Client  *Client  // transport (retries, user agent); nil uses NewClient(nil)
+	Server  string   // index server; empty uses CommonCrawlServer
+	Indexes []string // crawl IDs; empty selects the most recent crawl
+
+	mu       sync.Mutex
+	resolved []string         // Indexes, or the latest crawl once looked up
+	counts   map[string][]int // per-index page counts, keyed by query
+}
+
+// NewCommonCrawl returns a CommonCrawl over the given crawl IDs (the latest
+// crawl when none are given), fetching through c.
+func NewCommonCrawl(c *Client, indexes ...string) *CommonCrawl {
+	return &CommonCrawl{Client: c, Indexes: indexes}
+}
+
+func (cc *CommonCrawl) client() *Client {
+	if cc.Client == nil {
+		cc.Client = NewClient(nil)
+	}
+	return cc.Client
+}
+
+func (cc *CommonCrawl) server() string {
+	if cc.Server == "" {
+		return CommonCrawlServer
+	}
+	return strings.TrimSuffix(cc.Server, "/")
+}
+
+// Crawls lists the crawls the server indexes, most recent first.
+func (cc *CommonCrawl) Crawls(ctx context.Context) ([]Crawl, error) {
+	resp, err := cc.client().Get(ctx, cc.server()+"/collinfo.json")
+	if err != nil {
+		return nil, fmt.Errorf("fetch crawl list: %w", err)
+	}
+	defer resp.Body.Close()
+	var crawls []Crawl
+	if err := json.NewDecoder(resp.Body).Decode(&crawls); err != nil {
+		return nil, fmt.Errorf("decode crawl list: %w", err)
+	}
+	return crawls, nil
+}
+
+// indexes returns the crawl IDs to search, looking up the latest crawl once
+// when none were configured.
+func (cc *CommonCrawl) indexes(ctx context.Context) ([]string, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.resolved != nil {
+		return cc.resolved, nil
+	}
+	if len(cc.Indexes) > 0 {
+		cc.resolved = cc.Indexes
+		return cc.resolved, nil
+	}
+	crawls, err := cc.Crawls(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(crawls) == 0 {
+		return nil, errors.New("cdx: Common Crawl lists no crawls")
+	}
+	cc.resolved = []string{crawls[0].ID}
+	return cc.resolved, nil
+}
+
+// ccFieldNames maps CDX filter field names to their Common Crawl equivalents.
+// urlkey, digest, and length share the same name on both servers.
+var ccFieldNames = map[string]string{
+	FieldStatusCode: "status",
+	FieldMimeType:   "mime",
+	FieldOriginal:   "url",
+}
+
+// ccFilter rewrites a CDX filter expression for the Common Crawl server,
+// keeping any leading modifiers (! negate, = exact, ~ contains).
+func ccFilter(f string) string {
+	i := 0
+	for i < len(f) && strings.IndexByte("!=~", f[i]) >= 0 {
+		i++
+	}
+	name, expr, ok := strings.Cut(f[i:], ":")
+	if !ok {
+		return f
+	}
+	if cc, ok := ccFieldNames[name]; ok {
+		name = cc
+	}
+	return f[:i] + name + ":" + expr
+}
+
+// indexURL builds a request against one crawl's index. Common Crawl does not
+// honour fl= or collapse=, so full JSON records are requested and the columns
+// are selected locally.
+func (cc *CommonCrawl) indexURL(index string, q Query, page int, numPages bool) string {
+	v := q.values()
+	v.Del("filter")
+	for _, f := range q.Filters {
+		v.Add("filter", ccFilter(f))
+	}
+	v.Set("output", "json")
+	if numPages {
+		v.Set("showNumPages", "true")
+	} else {
+		v.Set("page", strconv.Itoa(page))
+	}
+	return cc.server() + "/" + index + "-index?" + v.Encode()
+}
+
+// pageCounts returns the page count of q in every searched crawl, fetching
+// them once per query.
+func (cc *CommonCrawl) pageCounts(ctx context.Context, q Query) ([]string, []int, error) {
+	indexes, err := cc.indexes(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := q.values().Encode()
+	cc.mu.Lock()
+	counts, ok := cc.counts[key]
+	cc.mu.Unlock()
+	if ok {
+		return indexes, counts, nil
+	}
+
+	counts = make([]int, len(indexes))
+	for i, index := range indexes {
+		n, err := cc.indexPages(ctx, index, q)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", index, err)
+		}
+		counts[i] = n
+	}
+	cc.mu.Lock()
+	if cc.counts == nil {
+		cc.counts = make(map[string][]int)
+	}
+	cc.counts[key] = counts
+	cc.mu.Unlock()
+	return indexes, counts, nil
+}
+
+// indexPages asks one crawl's index how many pages q spans. The server
+// answers {"pages": N, ...}; a 404 means no captures.
+func (cc *CommonCrawl) indexPages(ctx context.Context, index string, q Query) (int, error) {
+	resp, err := cc.client().Get(ctx, cc.indexURL(index, q, 0, true))
+	if isStatus(err, http.StatusNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("fetch page count: %w", err)
+	}
+	defer resp.Body.Close()
+	var reply struct {
+		Pages *int `json:"pages"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil || reply.Pages == nil {
+		return 0, ErrBadPageCount
+	}
+	return *reply.Pages, nil
+}
+
+// NumPages reports the total number of pages q spans across every searched
+// crawl.
+func (cc *CommonCrawl) NumPages(ctx context.Context, q Query) (int, error) {
+	_, counts, err := cc.pageCounts(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	return total, nil
+}
+
+// ccRecord is one JSON line from the Common Crawl index.
+type ccRecord struct {
+	URLKey    string `json:"urlkey"`
+	Timestamp string `json:"timestamp"`
+	URL       string `json:"url"`
+	Mime      string `json:"mime"`
+	Status    string `json:"status"`
+	Digest    string `json:"digest"`
+	Length    string `json:"length"`
+}
+
+// Page fetches page number page, counted across every searched crawl, and
+// calls fn with each record rendered as a CDX text line of q's columns.
+// Malformed JSON lines are skipped.
+func (cc *CommonCrawl) Page(ctx context.Context, q Query, page int, fn func(line string) error) error {
+	indexes, counts, err := cc.pageCounts(ctx, q)
+	if err != nil {
+		return err
+	}
+	index, local := "", page
+	for i, n := range counts {
+		if local < n {
+			index = indexes[i]
+			break
+		}
+		local -= n
+	}
+	if index == "" {
+		return fmt.Errorf("cdx: page %d out of range", page)
+	}
+
+	resp, err := cc.client().Get(ctx, cc.indexURL(index, q, local, false))
+	if isStatus(err, http.StatusNotFound) {
+		return nil // no captures on this page
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	cols := q.columns()
+	return eachLine(resp.Body, func(line string) error {
+		var cr ccRecord
+		if json.Unmarshal([]byte(line), &cr) != nil || cr.URL == "" {
+			return nil
+		}
+		rec := Record{
+			URLKey:     cr.URLKey,
+			Timestamp:  cr.Timestamp,
+			Original:   cr.URL,
+			MimeType:   cr.Mime,
+			StatusCode: cr.Status,
+			Digest:     cr.Digest,
+			Length:     cr.Length,
+		}
+		return fn(rec.Line(cols))
+	})
+}
@@ -0,0 +1,101 @@
+package cdx
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCCFilter(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"statuscode:200", "status:200"},
+		{"!statuscode:404", "!status:404"},
+		{"mimetype:text/.*", "mime:text/.*"},
+		{"~original:admin", "~url:admin"},
+		{"digest:ABC", "digest:ABC"},
+		{"nocolon", "nocolon"},
+	}
+	for _, tt := range tests {
+		if got := ccFilter(tt.in); got != tt.want {
+			t.Errorf("ccFilter(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestCommonCrawlPagesSpanIndexes checks that pages are numbered across
+// several crawls and that a crawl with no captures (404) contributes nothing.
+func TestCommonCrawlPagesSpanIndexes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		if q.Get("filter") != "status:200" {
+			t.Errorf("filter = %q, want translated status:200", q.Get("filter"))
+		}
+		switch req.URL.Path {
+		case "/A-index":
+			if q.Get("showNumPages") == "true" {
+				fmt.Fprint(w, `{"pages": 2}`)
+				return
+			}
+			fmt.Fprintf(w, `{"url":"http://x/a%s","timestamp":"2024","status":"200"}`+"\n", q.Get("page"))
+		case "/B-index":
+			if q.Get("showNumPages") == "true" {
+				fmt.Fprint(w, `{"pages": 1}`)
+				return
+			}
+			fmt.Fprintln(w, `not json`)
+			fmt.Fprintln(w, `{"url":"http://x/b","timestamp":"2023","status":"200","digest":"D"}`)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer srv.Close()
+
+	cc := &CommonCrawl{Client: NewClient(srv.Client()), Server: srv.URL, Indexes: []string{"A", "Empty", "B"}}
+	q := Query{URL: "x/*", Filters: []string{"statuscode:200"}, Fields: []string{FieldOriginal, FieldDigest}}
+
+	n, err := cc.NumPages(context.Background(), q)
+	if err != nil || n != 3 {
+		t.Fatalf("NumPages = %d, %v; want 3", n, err)
+	}
+	var got []Record
+	for rec, err := range Records(context.Background(), cc, q) {
+		if err != nil {
+			t.Fatalf("Records: %v", err)
+		}
+		got = append(got, rec)
+	}
+	want := []Record{{Original: "http://x/a0"}, {Original: "http://x/a1"}, {Original: "http://x/b", Digest: "D"}}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("record %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if err := cc.Page(context.Background(), q, 3, func(string) error { return nil }); err == nil {
+		t.Error("Page past the last index should fail")
+	}
+}
+
+func TestCommonCrawlLatestIndex(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/collinfo.json":
+			fmt.Fprint(w, `[{"id":"CC-NEW"},{"id":"CC-OLD"}]`)
+		case "/CC-NEW-index":
+			fmt.Fprint(w, `{"pages": 4}`)
+		default:
+			t.Errorf("unexpected request %s", req.URL.Path)
+			http.NotFound(w, req)
+		}
+	}))
+	defer srv.Close()
+
+	cc := &CommonCrawl{Client: NewClient(srv.Client()), Server: srv.URL}
+	if n, err := cc.NumPages(context.Background(), Query{URL: "x/*"}); err != nil || n != 4 {
+		t.Errorf("NumPages = %d, %v; want 4 from the latest crawl", n, err)
+	}
+}
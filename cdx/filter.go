@@ -0,0 +1,78 @@
+package cdx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// localFilter is a CDX filter= expression compiled for sources that cannot
+// filter server-side.
+type localFilter struct {
+	field  string
+	negate bool
+	re     *regexp.Regexp
+}
+
+// compileFilters parses CDX filter expressions ("[!]field:regex"). Like the
+// CDX server, the regex must match the whole value.
+func compileFilters(exprs []string) ([]localFilter, error) {
+	out := make([]localFilter, 0, len(exprs))
+	for _, e := range exprs {
+		f := localFilter{}
+		if strings.HasPrefix(e, "!") {
+			f.negate = true
+			e = e[1:]
+		}
+		name, expr, ok := strings.Cut(e, ":")
+		if !ok {
+			return nil, fmt.Errorf("cdx: filter %q is not field:regex", e)
+		}
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("cdx: filter %q: %w", e, err)
+		}
+		f.field, f.re = name, re
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// match reports whether rec passes every filter. A filter on a column the
+// source did not report is skipped rather than failed, so archives that omit
+// e.g. status codes still return their captures.
+func match(rec Record, filters []localFilter) bool {
+	for _, f := range filters {
+		v := rec.Get(f.field)
+		if v == "" {
+			continue
+		}
+		if f.re.MatchString(v) == f.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// inWindow reports whether timestamp ts falls within the from/to window using
+// CDX semantics: bounds may be truncated (yyyy, yyyyMM, ...) and are
+// inclusive of the whole period they name. An empty ts passes.
+func inWindow(ts, from, to string) bool {
+	if ts == "" {
+		return true
+	}
+	if from != "" && prefix(ts, len(from)) < from {
+		return false
+	}
+	if to != "" && prefix(ts, len(to)) > to {
+		return false
+	}
+	return true
+}
+
+func prefix(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,214 @@
+package cdx
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxRetryAfter caps how long a server-supplied Retry-After can pause
+// requests, so a misconfigured header cannot stall a run for hours.
+const MaxRetryAfter = 10 * time.Minute
+
+// MinRetryAfter is the shortest pause a Retry-After causes: "0", or a date
+// already past, still holds requests back briefly rather than not at all.
+const MinRetryAfter = time.Second
+
+// minRateDivisor bounds adaptive slow-down: the rate never drops below the
+// configured rate divided by this.
+const minRateDivisor = 16
+
+// unlimitedBackoffRate stands in for the configured rate of a Limiter without
+// one (rate 0) once the server pushes back: the rate drops to half of it, and
+// throttling stops again when successes have raised it back up.
+const unlimitedBackoffRate = 8
+
+// Limiter is a token-bucket rate limiter shared by every request a Client
+// makes, so concurrent page fetchers are throttled together. It adapts to the
+// server: a 429 or 5xx (Backoff) pauses all callers and halves the rate, and
+// each success (Success) raises it again step by step to the configured rate.
+// A Limiter with rate 0 does not throttle until the first push-back; it then
+// slows down from unlimitedBackoffRate and returns to unlimited as requests
+// succeed.
+//
+// Safe for concurrent use.
+type Limiter struct {
+	mu         sync.Mutex
+	max        float64   // configured requests per second; 0 = unlimited
+	rate       float64   // current adaptive rate, in [top()/minRateDivisor, top()]; 0 = unlimited
+	burst      float64   // bucket capacity
+	tokens     float64   // available requests
+	last       time.Time // last refill
+	pauseUntil time.Time // no requests before this
+}
+
+// NewLimiter returns a Limiter allowing rate requests per second (fractional
+// rates such as 0.5 mean one request every two seconds) with bursts of up to
+// burst requests. rate <= 0 disables throttling; burst < 1 is treated as 1.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if rate < 0 {
+		rate = 0
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		max:    rate,
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Rate reports the current adaptive rate in requests per second (0 when
+// unlimited).
+func (l *Limiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// refill adds the tokens accrued since the last refill. Caller holds l.mu.
+func (l *Limiter) refill(now time.Time) {
+	if now.After(l.last) {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+	}
+}
+
+// Wait blocks until a request may be sent: any pause has ended and a token is
+// available. It returns ctx's error if ctx ends first.
+func (l *Limiter) Wait(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		l.mu.Lock()
+		now := time.Now()
+		var wait time.Duration
+		switch {
+		case now.Before(l.pauseUntil):
+			wait = l.pauseUntil.Sub(now)
+		case l.rate <= 0:
+			l.mu.Unlock()
+			return nil
+		default:
+			l.refill(now)
+			if l.tokens >= 1 {
+				l.tokens--
+				l.mu.Unlock()
+				return nil
+			}
+			wait = time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		}
+		l.mu.Unlock()
+		if !Sleep(ctx, wait) {
+			return ctx.Err()
+		}
+	}
+}
+
+// Backoff records push-back from the server: every caller of Wait is held
+// for d (extending, never shortening, a pause already in force), and the
+// rate is halved. The bucket is emptied so requests resume one at a time.
+func (l *Limiter) Backoff(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.pauseUntil) {
+		l.pauseUntil = until
+	}
+	if l.rate <= 0 {
+		l.rate = l.top() // unlimited until now
+	}
+	l.rate = max(l.rate/2, l.top()/minRateDivisor)
+	l.tokens = 0
+	l.last = l.pauseUntil // accrue nothing while paused
+}
+
+// Success records a request the server accepted, raising the rate back
+// towards the configured one by a tenth of it. Without a configured rate,
+// throttling stops once the rate is back at unlimitedBackoffRate.
+func (l *Limiter) Success() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 || l.rate >= l.top() {
+		return
+	}
+	l.rate += l.top() / 10
+	switch {
+	case l.max > 0:
+		l.rate = min(l.rate, l.max)
+	case l.rate >= unlimitedBackoffRate:
+		l.rate = 0
+	}
+}
+
+// top is the rate slow-down starts from and recovers to. Caller holds l.mu.
+func (l *Limiter) top() float64 {
+	if l.max > 0 {
+		return l.max
+	}
+	return unlimitedBackoffRate
+}
+
+// RetryAfter parses a Retry-After header (delay-seconds or an HTTP date),
+// kept between MinRetryAfter and MaxRetryAfter. ok is false when the header
+// is absent or invalid.
+func RetryAfter(h http.Header, now time.Time) (d time.Duration, ok bool) {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = t.Sub(now)
+	} else {
+		return 0, false
+	}
+	return min(max(d, MinRetryAfter), MaxRetryAfter), true
+}
+
+// RetryDelay returns how long to back off after attempt (counting from 1) got
+// a 429 or 5xx reply with header h: its Retry-After, or 1s, 4s, 9s, ...
+// without one.
+func RetryDelay(h http.Header, attempt int) time.Duration {
+	if d, ok := RetryAfter(h, time.Now()); ok {
+		return d
+	}
+	return time.Duration(attempt*attempt) * time.Second
+}
+
+// NextRetry decides what follows attempt (counting from 1) of a request that
+// got resp, nil after a network error. A 429 or 5xx is push-back: wait is
+// RetryDelay and shared is true, as every request to the server should hold
+// off. A network error or other non-4xx reply waits 1s, 2s, 3s, ... for this
+// request alone. Any other 4xx won't change on retry, so retry is false.
+func NextRetry(resp *http.Response, attempt int) (wait time.Duration, shared, retry bool) {
+	switch {
+	case resp == nil:
+		return time.Duration(attempt) * time.Second, false, true
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return RetryDelay(resp.Header, attempt), true, true
+	case resp.StatusCode >= 400:
+		return 0, false, false
+	}
+	return time.Duration(attempt) * time.Second, false, true
+}
+
+// Sleep waits for d or until ctx is cancelled. Returns false if cancelled.
+func Sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,211 @@
+package cdx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"7", 7 * time.Second, true},
+		{"0", MinRetryAfter, true},
+		{"-3", MinRetryAfter, true},
+		{"86400", MaxRetryAfter, true},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.header != "" {
+			h.Set("Retry-After", tt.header)
+		}
+		got, ok := RetryAfter(h, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("RetryAfter(%q) = %s, %v; want %s, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		header  string
+		attempt int
+		want    time.Duration
+	}{
+		{"", 1, time.Second},
+		{"", 3, 9 * time.Second},
+		{"7", 3, 7 * time.Second},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.header != "" {
+			h.Set("Retry-After", tt.header)
+		}
+		if got := RetryDelay(h, tt.attempt); got != tt.want {
+			t.Errorf("RetryDelay(%q, %d) = %s, want %s", tt.header, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestNextRetry(t *testing.T) {
+	tests := []struct {
+		status     int // 0 = network error
+		attempt    int
+		wantWait   time.Duration
+		wantShared bool
+		wantRetry  bool
+	}{
+		{0, 2, 2 * time.Second, false, true},
+		{http.StatusTooManyRequests, 2, 4 * time.Second, true, true},
+		{http.StatusBadGateway, 3, 9 * time.Second, true, true},
+		{http.StatusNotFound, 1, 0, false, false},
+		{http.StatusNotModified, 1, time.Second, false, true},
+	}
+	for _, tt := range tests {
+		var resp *http.Response
+		if tt.status != 0 {
+			resp = &http.Response{StatusCode: tt.status, Header: http.Header{}}
+		}
+		wait, shared, retry := NextRetry(resp, tt.attempt)
+		if wait != tt.wantWait || shared != tt.wantShared || retry != tt.wantRetry {
+			t.Errorf("NextRetry(%d, %d) = %s, %v, %v; want %s, %v, %v", tt.status, tt.attempt,
+				wait, shared, retry, tt.wantWait, tt.wantShared, tt.wantRetry)
+		}
+	}
+}
+
+func TestLimiterAdapts(t *testing.T) {
+	l := NewLimiter(8, 1)
+	l.Backoff(0)
+	l.Backoff(0)
+	if got := l.Rate(); got != 2 {
+		t.Errorf("rate after two backoffs = %g, want 2", got)
+	}
+	for i := 0; i < 10; i++ {
+		l.Backoff(0)
+	}
+	if got := l.Rate(); got != 8.0/minRateDivisor {
+		t.Errorf("rate floor = %g, want %g", got, 8.0/minRateDivisor)
+	}
+	for i := 0; i < 20; i++ {
+		l.Success()
+	}
+	if got := l.Rate(); got != 8 {
+		t.Errorf("rate after recovery = %g, want 8 (never above configured)", got)
+	}
+}
+
+func TestLimiterAdaptsUnlimited(t *testing.T) {
+	l := NewLimiter(0, 1)
+	l.Success()
+	if got := l.Rate(); got != 0 {
+		t.Errorf("rate before push-back = %g, want 0 (unlimited)", got)
+	}
+	l.Backoff(0)
+	if got := l.Rate(); got != unlimitedBackoffRate/2 {
+		t.Errorf("rate after backoff = %g, want %g", got, unlimitedBackoffRate/2.0)
+	}
+	l.Backoff(0)
+	if got := l.Rate(); got != unlimitedBackoffRate/4 {
+		t.Errorf("rate after two backoffs = %g, want %g", got, unlimitedBackoffRate/4.0)
+	}
+
+	// Throttled now: after the emptied bucket, the next token takes 1/rate.
+	start := time.Now()
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if el := time.Since(start); el < 400*time.Millisecond {
+		t.Errorf("wait after backoff took %s, want >= ~500ms", el)
+	}
+
+	for i := 0; i < 20; i++ {
+		l.Success()
+	}
+	if got := l.Rate(); got != 0 {
+		t.Errorf("rate after recovery = %g, want 0 (unlimited again)", got)
+	}
+}
+
+func TestLimiterWait(t *testing.T) {
+	ctx := context.Background()
+
+	// Fractional rate: after the burst, the next token takes 1/rate seconds.
+	l := NewLimiter(20, 2)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if el := time.Since(start); el < 40*time.Millisecond {
+		t.Errorf("3 waits at 20/s with burst 2 took %s, want >= ~50ms", el)
+	}
+
+	// A pause holds every caller, even when unlimited.
+	u := NewLimiter(0, 1)
+	u.Backoff(60 * time.Millisecond)
+	start = time.Now()
+	if err := u.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if el := time.Since(start); el < 50*time.Millisecond {
+		t.Errorf("wait during pause returned after %s, want >= ~60ms", el)
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	u.Backoff(time.Hour)
+	if err := u.Wait(cctx); err == nil {
+		t.Error("Wait should fail on a cancelled context")
+	}
+}
+
+// TestGetRetryAfterPausesAll checks that one 429 with Retry-After holds back
+// a concurrent request sharing the limiter, not only the one that was refused.
+func TestGetRetryAfterPausesAll(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	c := testClient(srv)
+	c.Limiter = NewLimiter(0, 1)
+
+	start := time.Now()
+	resp, err := c.Get(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	resp.Body.Close()
+	if el := time.Since(start); el < 900*time.Millisecond {
+		t.Errorf("retry after Retry-After: 1 came after %s, want >= 1s", el)
+	}
+
+	// The pause is over now; a fresh limiter pause blocks other callers too.
+	c.Limiter.Backoff(80 * time.Millisecond)
+	start = time.Now()
+	resp, err = c.Get(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	resp.Body.Close()
+	if el := time.Since(start); el < 70*time.Millisecond {
+		t.Errorf("request during a shared pause went out after %s", el)
+	}
+}
@@ -0,0 +1,92 @@
+package cdx
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Query describes a CDX search. Zero-valued fields are left out of the
+// request, so the server defaults apply.
+type Query struct {
+	URL      string   // url= match pattern, sent as-is (e.g. "example.com/*", "*.example.com")
+	From     string   // from= timestamp, yyyy[MMdd[hhmmss]]
+	To       string   // to= timestamp, yyyy[MMdd[hhmmss]]
+	Filters  []string // filter= expressions, e.g. "statuscode:200", "mimetype:text/html"
+	Fields   []string // fl= columns; empty selects the server default (DefaultFields)
+	Collapse string   // collapse= expression, e.g. "urlkey" or "timestamp:8"
+	Limit    int      // batch size for cursor paging; 0 uses DefaultCursorLimit
+}
+
+// columns returns the column order of result lines for q.
+func (q Query) columns() []string {
+	if len(q.Fields) == 0 {
+		return DefaultFields
+	}
+	return q.Fields
+}
+
+// values holds the parameters shared by page-count and page requests. Filters
+// and the date window apply to both so the count matches the fetched results.
+func (q Query) values() url.Values {
+	v := url.Values{}
+	v.Set("url", q.URL)
+	if q.From != "" {
+		v.Set("from", q.From)
+	}
+	if q.To != "" {
+		v.Set("to", q.To)
+	}
+	for _, f := range q.Filters {
+		v.Add("filter", f)
+	}
+	return v
+}
+
+// resultValues adds the result-shaping parameters (columns, collapse).
+func (q Query) resultValues() url.Values {
+	v := q.values()
+	if len(q.Fields) > 0 {
+		v.Set("fl", strings.Join(q.Fields, ","))
+	}
+	if q.Collapse != "" {
+		v.Set("collapse", q.Collapse)
+	}
+	return v
+}
+
+// pageValues selects one page of results.
+func (q Query) pageValues(page int) url.Values {
+	v := q.resultValues()
+	v.Set("page", strconv.Itoa(page))
+	return v
+}
+
+// NumPagesURL returns the request URL asking how many result pages q spans.
+func (c *Client) NumPagesURL(q Query) string {
+	v := q.values()
+	v.Set("showNumPages", "true")
+	return c.endpoint() + "?" + v.Encode()
+}
+
+// PageURL returns the request URL for one page of q's results.
+func (c *Client) PageURL(q Query, page int) string {
+	return c.endpoint() + "?" + q.pageValues(page).Encode()
+}
+
+// CursorURL returns the request URL for the batch of q's results that starts
+// at resumeKey ("" for the first batch), asking the server to append the key
+// of the following batch.
+func (c *Client) CursorURL(q Query, resumeKey string) string {
+	v := q.resultValues()
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultCursorLimit
+	}
+	v.Set("limit", strconv.Itoa(limit))
+	v.Set("showResumeKey", "true")
+	if resumeKey != "" {
+		v.Set("resumeKey", resumeKey)
+	}
+	return c.endpoint() + "?" + v.Encode()
+}
@@ -0,0 +1,169 @@
+package cdx
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Column names accepted by the CDX server's fl= parameter.
+const (
+	FieldURLKey     = "urlkey"
+	FieldTimestamp  = "timestamp"
+	FieldOriginal   = "original"
+	FieldMimeType   = "mimetype"
+	FieldStatusCode = "statuscode"
+	FieldDigest     = "digest"
+	FieldLength     = "length"
+)
+
+// DefaultFields is the column order the CDX server returns when a query does
+// not set Fields.
+var DefaultFields = []string{
+	FieldURLKey, FieldTimestamp, FieldOriginal, FieldMimeType,
+	FieldStatusCode, FieldDigest, FieldLength,
+}
+
+// timestampLayout is the full 14-digit CDX timestamp (yyyyMMddhhmmss).
+const timestampLayout = "20060102150405"
+
+// Record is one capture returned by the CDX server. Columns that were not
+// requested, or that the server reports as "-", are left empty. Values are
+// exactly as the archive returned them: archived URLs are attacker-influenced,
+// so callers printing them to a terminal must sanitize first.
+type Record struct {
+	URLKey     string
+	Timestamp  string
+	Original   string
+	MimeType   string
+	StatusCode string
+	Digest     string
+	Length     string
+}
+
+// ParseRecord splits a space-separated CDX line into a Record, assigning the
+// columns in the order given by fields (DefaultFields when empty). Extra
+// columns are ignored; missing ones stay empty. Returns ok=false for a blank
+// line.
+func ParseRecord(line string, fields []string) (Record, bool) {
+	cols := strings.Fields(line)
+	if len(cols) == 0 {
+		return Record{}, false
+	}
+	if len(fields) == 0 {
+		fields = DefaultFields
+	}
+	var rec Record
+	for i, name := range fields {
+		if i >= len(cols) {
+			break
+		}
+		if cols[i] != "-" {
+			rec.set(name, cols[i])
+		}
+	}
+	return rec, true
+}
+
+// Get returns the value of the named CDX column, or "" for an unknown name.
+func (r Record) Get(field string) string {
+	switch field {
+	case FieldURLKey:
+		return r.URLKey
+	case FieldTimestamp:
+		return r.Timestamp
+	case FieldOriginal:
+		return r.Original
+	case FieldMimeType:
+		return r.MimeType
+	case FieldStatusCode:
+		return r.StatusCode
+	case FieldDigest:
+		return r.Digest
+	case FieldLength:
+		return r.Length
+	}
+	return ""
+}
+
+func (r *Record) set(field, v string) {
+	switch field {
+	case FieldURLKey:
+		r.URLKey = v
+	case FieldTimestamp:
+		r.Timestamp = v
+	case FieldOriginal:
+		r.Original = v
+	case FieldMimeType:
+		r.MimeType = v
+	case FieldStatusCode:
+		r.StatusCode = v
+	case FieldDigest:
+		r.Digest = v
+	case FieldLength:
+		r.Length = v
+	}
+}
+
+// lineEscaper percent-encodes whitespace, which would otherwise split a value
+// across columns of a CDX text line.
+var lineEscaper = strings.NewReplacer(" ", "%20", "\t", "%09", "\r", "%0D", "\n", "%0A")
+
+// Line renders the record as a CDX text line holding the given columns, the
+// inverse of ParseRecord. Empty values are written as "-" and whitespace
+// inside a value is percent-encoded.
+func (r Record) Line(fields []string) string {
+	if len(fields) == 0 {
+		fields = DefaultFields
+	}
+	cols := make([]string, len(fields))
+	for i, name := range fields {
+		v := r.Get(name)
+		if v == "" {
+			v = "-"
+		}
+		cols[i] = lineEscaper.Replace(v)
+	}
+	return strings.Join(cols, " ")
+}
+
+// Time parses Timestamp as UTC. The CDX server may return truncated
+// timestamps (yyyy, yyyyMM, ...); missing components default to the start of
+// the period.
+func (r Record) Time() (time.Time, error) {
+	return ParseTimestamp(r.Timestamp)
+}
+
+// ParseTimestamp parses a possibly truncated CDX timestamp (yyyy[MM[dd[hh[mm[ss]]]]])
+// as UTC.
+func ParseTimestamp(ts string) (time.Time, error) {
+	if len(ts) < 4 || len(ts) > len(timestampLayout) || len(ts)%2 != 0 {
+		return time.Time{}, fmt.Errorf("cdx: bad timestamp %q", ts)
+	}
+	// Pad with the earliest valid value of each missing component.
+	const pad = "00000101000000"
+	return time.Parse(timestampLayout, ts+pad[len(ts):])
+}
+
+// WaybackWeb is the prefix of Wayback Machine snapshot URLs.
+const WaybackWeb = "https://web.archive.org/web/"
+
+// SnapshotURL returns the Wayback Machine URL that shows this capture, or ""
+// when the record lacks a timestamp or original URL. It is only meaningful
+// for records from the Wayback CDX API.
+func (r Record) SnapshotURL() string {
+	if r.Timestamp == "" || r.Original == "" {
+		return ""
+	}
+	return WaybackWeb + r.Timestamp + "/" + r.Original
+}
+
+// ReplayURL returns the Wayback Machine URL that serves this capture's
+// original bytes, without the archive's banner or link rewriting (the "id_"
+// flag), or "" when the record lacks a timestamp or original URL.
+func (r Record) ReplayURL() string {
+	if r.Timestamp == "" || r.Original == "" {
+		return ""
+	}
+	return WaybackWeb + r.Timestamp + "id_/" + r.Original
+}
@@ -0,0 +1,77 @@
+package cdx
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRecord(t *testing.T) {
+	fields := []string{FieldOriginal, FieldTimestamp, FieldStatusCode, FieldMimeType}
+	tests := []struct {
+		name   string
+		line   string
+		fields []string
+		want   Record
+		wantOK bool
+	}{
+		{"blank", "  ", fields, Record{}, false},
+		{"url only", "http://x/a", fields, Record{Original: "http://x/a"}, true},
+		{
+			"requested column order",
+			"http://x/a 20200101 200 text/html",
+			fields,
+			Record{Original: "http://x/a", Timestamp: "20200101", StatusCode: "200", MimeType: "text/html"},
+			true,
+		},
+		{"dashes are empty", "http://x/a - 200 -", fields, Record{Original: "http://x/a", StatusCode: "200"}, true},
+		{
+			"server default columns",
+			"com,x)/a 20200101000000 http://x/a text/html 200 ABCD 512",
+			nil,
+			Record{URLKey: "com,x)/a", Timestamp: "20200101000000", Original: "http://x/a",
+				MimeType: "text/html", StatusCode: "200", Digest: "ABCD", Length: "512"},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseRecord(tt.line, tt.fields)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("ParseRecord(%q) = %+v, %v; want %+v, %v", tt.line, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRecordLineRoundTrip(t *testing.T) {
+	fields := []string{FieldOriginal, FieldStatusCode, FieldDigest}
+	rec := Record{Original: "http://x/a", Digest: "ABCD"}
+	line := rec.Line(fields)
+	if line != "http://x/a - ABCD" {
+		t.Fatalf("Line = %q", line)
+	}
+	if got, _ := ParseRecord(line, fields); got != rec {
+		t.Errorf("round trip = %+v, want %+v", got, rec)
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{"20200102030405", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), false},
+		{"2020", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), false},
+		{"202006", time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC), false},
+		{"20201", time.Time{}, true},
+		{"abcd", time.Time{}, true},
+		{"", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimestamp(tt.in)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("ParseTimestamp(%q) = %v, %v; want %v, err=%v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
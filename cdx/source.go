@@ -0,0 +1,100 @@
+package cdx
+
+import (
+	"context"
+	"errors"
+	"iter"
+)
+
+// Source is a paginated index of archived captures. Client (the Wayback CDX
+// API) is one; CommonCrawl is another. Page delivers CDX text lines holding
+// q.Fields columns whatever the source's native format, so every source
+// parses with ParseRecord and feeds the same consumers.
+type Source interface {
+	// NumPages reports how many pages q spans on this source.
+	NumPages(ctx context.Context, q Query) (int, error)
+	// Page calls fn with each non-blank result line of one page. An error
+	// from fn stops the read and is returned as-is.
+	Page(ctx context.Context, q Query, page int, fn func(line string) error) error
+}
+
+// CursorSource is a Source that can also walk results sequentially with a
+// resume key, which does not depend on the server reporting a page count.
+// Client implements it.
+type CursorSource interface {
+	Source
+	// Cursor calls fn with each result line of the batch starting at
+	// resumeKey ("" for the first) and returns the next batch's key, or ""
+	// after the last batch.
+	Cursor(ctx context.Context, q Query, resumeKey string, fn func(line string) error) (string, error)
+}
+
+// Stream fetches every page of q from src in order and calls fn with each
+// parsed record. It stops at the first error, including one returned by fn
+// or a cancelled ctx. When the page count is unparsable, a CursorSource is
+// walked with resume keys instead; any other source is read as a single page.
+func Stream(ctx context.Context, src Source, q Query, fn func(Record) error) error {
+	cols := q.columns()
+	each := func(line string) error {
+		rec, ok := ParseRecord(line, cols)
+		if !ok {
+			return nil
+		}
+		return fn(rec)
+	}
+
+	pages, err := src.NumPages(ctx, q)
+	if errors.Is(err, ErrBadPageCount) {
+		if cs, ok := src.(CursorSource); ok {
+			return Walk(ctx, cs, q, each)
+		}
+		pages, err = 1, nil
+	}
+	if err != nil {
+		return err
+	}
+	for p := 0; p < pages; p++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := src.Page(ctx, q, p, each); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Walk pages through all of q's results on src with resume keys, calling fn
+// with each result line.
+func Walk(ctx context.Context, src CursorSource, q Query, fn func(line string) error) error {
+	key := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		next, err := src.Cursor(ctx, q, key, fn)
+		if err != nil {
+			return err
+		}
+		if next == "" || next == key {
+			return nil
+		}
+		key = next
+	}
+}
+
+// Records returns an iterator over q's results from src. Iteration ends after
+// the last record, or after yielding a single non-nil error.
+func Records(ctx context.Context, src Source, q Query) iter.Seq2[Record, error] {
+	return func(yield func(Record, error) bool) {
+		err := Stream(ctx, src, q, func(rec Record) error {
+			if !yield(rec, nil) {
+				return errStopped
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopped) {
+			yield(Record{}, err)
+		}
+	}
+}
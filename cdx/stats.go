@@ -0,0 +1,53 @@
+package cdx
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Stats counts the HTTP activity of a Client: every attempt, the retries
+// among them, responses by status code, cache hits, and response bytes read
+// from the network. Install one as Client.Stats; swapping in a fresh Stats
+// between runs gives per-run figures. Safe for concurrent use.
+type Stats struct {
+	Requests  atomic.Int64 // network attempts, retries included
+	Retries   atomic.Int64 // attempts after the first for the same URL
+	CacheHits atomic.Int64 // responses served from Client.Cache
+	Bytes     atomic.Int64 // response body bytes read from the network
+
+	mu       sync.Mutex
+	statuses map[int]int64
+}
+
+func (s *Stats) addStatus(code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.statuses == nil {
+		s.statuses = make(map[int]int64)
+	}
+	s.statuses[code]++
+}
+
+// Statuses returns a copy of the response count per HTTP status code.
+func (s *Stats) Statuses() map[int]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[int]int64, len(s.statuses))
+	for code, n := range s.statuses {
+		out[code] = n
+	}
+	return out
+}
+
+// countingBody adds the bytes read through it to a Stats.
+type countingBody struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (b countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,242 @@
+package cdx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// TimeMap is a Source backed by RFC 7089 Memento TimeMaps in
+// application/link-format, as served by national and regional web archives
+// (Arquivo.pt, the UK Web Archive, pywb deployments, ...). Each endpoint is
+// one page: Page walks that archive's TimeMap, following rel="next" links to
+// later TimeMap pages.
+//
+// TimeMaps cannot filter server-side, so the query's date window and filters
+// are applied locally; a filter on a column the archive does not report (for
+// example the status code) is skipped rather than failed. Collapse and Fields
+// are not sent: results are rendered in q's columns locally. Wildcard URLs
+// ("example.com*", "*.example.com") are sent as they are; many archives only
+// serve TimeMaps of exact URLs, so when one answers a wildcard with 404 the
+// exact URL is fetched instead and Client.Logf is told.
+type TimeMap struct {
+	Client *Client // transport (retries, user agent); nil uses NewClient(nil)
+
+	// Endpoints are TimeMap URL prefixes such as
+	// "https://arquivo.pt/wayback/timemap/link/". The query URL is appended,
+	// or substituted for a literal "{url}" when present.
+	Endpoints []string
+}
+
+// NewTimeMap returns a TimeMap over the given endpoints, fetching through c.
+func NewTimeMap(c *Client, endpoints ...string) *TimeMap {
+	return &TimeMap{Client: c, Endpoints: endpoints}
+}
+
+func (tm *TimeMap) client() *Client {
+	if tm.Client == nil {
+		tm.Client = NewClient(nil)
+	}
+	return tm.Client
+}
+
+// NumPages reports one page per endpoint.
+func (tm *TimeMap) NumPages(ctx context.Context, q Query) (int, error) {
+	if len(tm.Endpoints) == 0 {
+		return 0, errors.New("cdx: no TimeMap endpoints configured")
+	}
+	return len(tm.Endpoints), nil
+}
+
+// timeMapURL builds the first TimeMap URL of endpoint for q.
+func timeMapURL(endpoint string, q Query) string {
+	if strings.Contains(endpoint, "{url}") {
+		return strings.ReplaceAll(endpoint, "{url}", q.URL)
+	}
+	return endpoint + q.URL
+}
+
+// exactURL strips the wildcards normalizeURLForCDX-style patterns carry: a
+// trailing "*" (prefix match) and a leading "*." (subdomains). ok is false
+// when u has none.
+func exactURL(u string) (exact string, ok bool) {
+	exact = strings.TrimPrefix(strings.TrimSuffix(u, "*"), "*.")
+	return exact, exact != u
+}
+
+// Page fetches every TimeMap page of endpoint number page and calls fn with
+// each memento, as a CDX text line of q's columns, that passes q's date
+// window and filters.
+func (tm *TimeMap) Page(ctx context.Context, q Query, page int, fn func(line string) error) error {
+	if page < 0 || page >= len(tm.Endpoints) {
+		return fmt.Errorf("cdx: page %d out of range", page)
+	}
+	filters, err := compileFilters(q.Filters)
+	if err != nil {
+		return err
+	}
+	cols := q.columns()
+
+	next := timeMapURL(tm.Endpoints[page], q)
+	visited := make(map[string]bool)
+	for next != "" && !visited[next] {
+		visited[next] = true
+		links, err := tm.fetch(ctx, next)
+		if isStatus(err, http.StatusNotFound) {
+			exact, wild := exactURL(q.URL)
+			if len(visited) > 1 || !wild {
+				return nil // no mementos for the URL
+			}
+			tm.client().logf("TimeMap %s has no results for wildcard %q; fetching the exact URL %q instead",
+				tm.Endpoints[page], q.URL, exact)
+			q.URL = exact
+			next = timeMapURL(tm.Endpoints[page], q)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		base, _ := url.Parse(next)
+		next = ""
+
+		original := ""
+		for _, l := range links {
+			if l.hasRel("original") {
+				original = l.uri
+			}
+		}
+		for _, l := range links {
+			switch {
+			case l.hasRel("memento"):
+				rec, ok := mementoRecord(l, original)
+				if !ok || !inWindow(rec.Timestamp, q.From, q.To) || !match(rec, filters) {
+					continue
+				}
+				if err := fn(rec.Line(cols)); err != nil {
+					return err
+				}
+			case l.hasRel("next"):
+				// A paged TimeMap links its successor with rel="next"; a
+				// "next memento" link is a capture and is handled above.
+				if u, err := base.Parse(l.uri); err == nil {
+					next = u.String()
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// fetch downloads and parses one TimeMap page. A 404, which means the archive
+// holds no mementos for the URL (or does not support a wildcard), is returned
+// as a StatusError.
+func (tm *TimeMap) fetch(ctx context.Context, rawURL string) ([]link, error) {
+	resp, err := tm.client().Get(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read TimeMap: %w", err)
+	}
+	return parseLinkFormat(string(body)), nil
+}
+
+// mementoURIRE pulls the capture timestamp and original URL out of a
+// Wayback-style memento URI (".../20200102030405id_/http://example.com/").
+var mementoURIRE = regexp.MustCompile(`/(\d{14})(?:[a-z]{2}_)?/((?:https?|ftp)://.+)$`)
+
+// mementoRecord converts a memento link into a Record. The original URL comes
+// from the memento URI when it embeds one (wildcard TimeMaps mix URLs),
+// falling back to the TimeMap's rel="original" link. The timestamp comes from
+// the datetime attribute, or from the URI when that is missing.
+func mementoRecord(l link, original string) (Record, bool) {
+	rec := Record{Original: original, StatusCode: l.params["status"]}
+	if m := mementoURIRE.FindStringSubmatch(l.uri); m != nil {
+		rec.Timestamp, rec.Original = m[1], m[2]
+	}
+	if dt := l.params["datetime"]; dt != "" {
+		if t, err := http.ParseTime(dt); err == nil {
+			rec.Timestamp = t.UTC().Format(timestampLayout)
+		}
+	}
+	if typ := l.params["type"]; typ != "" && typ != "application/link-format" {
+		rec.MimeType = typ
+	}
+	return rec, rec.Original != ""
+}
+
+// link is one entry of an application/link-format document (RFC 6690).
+type link struct {
+	uri    string
+	params map[string]string // attribute names lower-cased; quotes removed
+}
+
+// hasRel reports whether the link's rel attribute contains token.
+func (l link) hasRel(token string) bool {
+	for _, r := range strings.Fields(l.params["rel"]) {
+		if strings.EqualFold(r, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLinkFormat parses a link-format document: comma-separated
+// "<uri>; attr=value; attr="quoted value"" entries. URIs may themselves
+// contain commas and semicolons, so the parser tracks <...> and quotes rather
+// than splitting. Malformed trailing input is ignored.
+func parseLinkFormat(s string) []link {
+	var links []link
+	for {
+		start := strings.IndexByte(s, '<')
+		if start < 0 {
+			return links
+		}
+		end := strings.IndexByte(s[start:], '>')
+		if end < 0 {
+			return links
+		}
+		l := link{uri: strings.TrimSpace(s[start+1 : start+end]), params: map[string]string{}}
+		s = s[start+end+1:]
+
+		for {
+			s = strings.TrimLeft(s, " \t\r\n")
+			if s == "" || s[0] != ';' {
+				break // ',' (next link), end of input, or garbage
+			}
+			s = strings.TrimLeft(s[1:], " \t\r\n")
+			i := strings.IndexAny(s, "=;,")
+			if i < 0 || s[i] != '=' {
+				if i < 0 {
+					i = len(s)
+				}
+				l.params[strings.ToLower(strings.TrimSpace(s[:i]))] = ""
+				s = s[i:]
+				continue
+			}
+			name := strings.ToLower(strings.TrimSpace(s[:i]))
+			s = strings.TrimLeft(s[i+1:], " \t")
+			var val string
+			if strings.HasPrefix(s, `"`) {
+				if j := strings.IndexByte(s[1:], '"'); j >= 0 {
+					val, s = s[1:1+j], s[2+j:]
+				} else {
+					val, s = s[1:], ""
+				}
+			} else if j := strings.IndexAny(s, ";,"); j >= 0 {
+				val, s = s[:j], s[j:]
+			} else {
+				val, s = s, ""
+			}
+			l.params[name] = strings.TrimSpace(val)
+		}
+		links = append(links, l)
+	}
+}
@@ -0,0 +1,150 @@
+package cdx
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseLinkFormat(t *testing.T) {
+	doc := `<http://example.com/a,b;c>; rel="original",
+<http://arch.example/timemap/link/http://example.com/a,b;c>; rel="self"; type="application/link-format",
+<http://arch.example/20200102030405/http://example.com/a,b;c> ;rel="first memento"; datetime="Thu, 02 Jan 2020 03:04:05 GMT", <http://arch.example/x>; rel=memento; status=200,
+<broken`
+	links := parseLinkFormat(doc)
+	if len(links) != 4 {
+		t.Fatalf("got %d links, want 4: %+v", len(links), links)
+	}
+	if links[0].uri != "http://example.com/a,b;c" || !links[0].hasRel("original") {
+		t.Errorf("link 0 = %+v", links[0])
+	}
+	if !links[2].hasRel("memento") || links[2].params["datetime"] != "Thu, 02 Jan 2020 03:04:05 GMT" {
+		t.Errorf("link 2 = %+v", links[2])
+	}
+	if links[3].params["rel"] != "memento" || links[3].params["status"] != "200" {
+		t.Errorf("unquoted params not parsed: %+v", links[3])
+	}
+}
+
+func TestMementoRecord(t *testing.T) {
+	l := link{uri: "http://arch.example/wayback/20100101000000id_/http://example.com/x?y=1", params: map[string]string{
+		"rel": "memento", "datetime": "Sat, 02 Jan 2010 00:00:00 GMT",
+	}}
+	rec, ok := mementoRecord(l, "http://example.com/fallback")
+	if !ok || rec.Original != "http://example.com/x?y=1" || rec.Timestamp != "20100102000000" {
+		t.Errorf("mementoRecord = %+v, %v", rec, ok)
+	}
+
+	l = link{uri: "http://arch.example/opaque/123", params: map[string]string{"rel": "memento"}}
+	if rec, ok := mementoRecord(l, "http://example.com/"); !ok || rec.Original != "http://example.com/" || rec.Timestamp != "" {
+		t.Errorf("opaque memento = %+v, %v; want the rel=original URL", rec, ok)
+	}
+}
+
+// TestTimeMapPaging walks a two-page TimeMap on one archive plus a second
+// archive with no mementos (404), applying the date window and filters
+// locally.
+func TestTimeMapPaging(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/link-format")
+		switch {
+		case req.URL.Path == "/tm/example.com/":
+			fmt.Fprintf(w, `<http://example.com/>; rel="original",
+<%[1]s/web/20090101000000/http://example.com/>; rel="first memento"; datetime="Thu, 01 Jan 2009 00:00:00 GMT",
+<%[1]s/web/20150101000000/http://example.com/>; rel="memento"; datetime="Thu, 01 Jan 2015 00:00:00 GMT"; status="404",
+<%[1]s/web/20160101000000/http://example.com/>; rel="memento"; datetime="Fri, 01 Jan 2016 00:00:00 GMT",
+</tm2/page2>; rel="next"; type="application/link-format"`, srv.URL)
+		case req.URL.Path == "/tm2/page2":
+			fmt.Fprintf(w, `<http://example.com/>; rel="original",
+<%[1]s/web/20170101000000/http://example.com/>; rel="last memento"; datetime="Sun, 01 Jan 2017 00:00:00 GMT"; status="200",
+</tm2/page2>; rel="next"; type="application/link-format"`, srv.URL)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer srv.Close()
+
+	tm := NewTimeMap(NewClient(srv.Client()), srv.URL+"/tm/", srv.URL+"/missing/{url}")
+	q := Query{
+		URL:     "example.com/",
+		From:    "2010",
+		Filters: []string{"!statuscode:404"},
+		Fields:  []string{FieldOriginal, FieldTimestamp, FieldStatusCode},
+	}
+	if n, _ := tm.NumPages(context.Background(), q); n != 2 {
+		t.Fatalf("NumPages = %d, want 2 (one per endpoint)", n)
+	}
+	var got []string
+	for rec, err := range Records(context.Background(), tm, q) {
+		if err != nil {
+			t.Fatalf("Records: %v", err)
+		}
+		got = append(got, rec.Timestamp+" "+rec.StatusCode)
+	}
+	want := "20160101000000 |20170101000000 200"
+	if strings.Join(got, "|") != want {
+		t.Errorf("mementos = %q, want %q", strings.Join(got, "|"), want)
+	}
+}
+
+// TestTimeMapWildcardFallback queries a prefix wildcard on an archive that
+// only serves exact-URL TimeMaps: the 404 is logged and the exact URL fetched.
+func TestTimeMapWildcardFallback(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		paths = append(paths, req.URL.Path)
+		if req.URL.Path != "/tm/example.com/" {
+			http.NotFound(w, req)
+			return
+		}
+		fmt.Fprint(w, `<http://arch.example/20200101000000/http://example.com/>; rel="memento"`)
+	}))
+	defer srv.Close()
+
+	var logged []string
+	c := NewClient(srv.Client())
+	c.Logf = func(format string, a ...any) { logged = append(logged, fmt.Sprintf(format, a...)) }
+	tm := NewTimeMap(c, srv.URL+"/tm/")
+	for _, tt := range []struct {
+		url     string
+		want    int
+		wantLog bool
+	}{
+		{"example.com/*", 1, true},
+		{"example.com/", 1, false},
+		{"example.org/*", 0, true}, // the exact URL has no mementos either
+	} {
+		paths, logged = nil, nil
+		var got int
+		err := tm.Page(context.Background(), Query{URL: tt.url}, 0, func(string) error { got++; return nil })
+		if err != nil || got != tt.want {
+			t.Errorf("%s: %d mementos, err %v; want %d (requests %v)", tt.url, got, err, tt.want, paths)
+		}
+		if (len(logged) > 0) != tt.wantLog {
+			t.Errorf("%s: logged %q, want a notice: %v", tt.url, logged, tt.wantLog)
+		}
+	}
+}
+
+func TestInWindow(t *testing.T) {
+	tests := []struct {
+		ts, from, to string
+		want         bool
+	}{
+		{"20200101000000", "", "", true},
+		{"20200101000000", "2020", "2020", true},
+		{"20201231235959", "2020", "2020", true},
+		{"20191231235959", "2020", "", false},
+		{"20210101000000", "", "2020", false},
+		{"", "2020", "2021", true},
+	}
+	for _, tt := range tests {
+		if got := inWindow(tt.ts, tt.from, tt.to); got != tt.want {
+			t.Errorf("inWindow(%q, %q, %q) = %v, want %v", tt.ts, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
+)
+
+// checkpointVersion is bumped when the checkpoint layout changes incompatibly.
+const checkpointVersion = 1
+
+// checkpoint records batch progress so an interrupted run can continue with
+// --resume: which targets finished, and for unfinished ones which pages (or
+// which resume-key batch) completed. Results already written are recovered
+// from the output file itself on resume, so no dedup state is stored here.
+//
+// Methods are safe for concurrent use and are no-ops on a nil *checkpoint, so
+// callers need not check whether checkpointing is enabled.
+type checkpoint struct {
+	Version int                     `json:"version"`
+	Output  string                  `json:"output"`
+	Updated time.Time               `json:"updated"`
+	Targets map[string]*targetState `json:"targets"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// targetState is the progress of one target.
+type targetState struct {
+	Query     string `json:"query"` // checkpointQuery the progress was made with
+	Done      bool   `json:"done,omitempty"`
+	Pages     int    `json:"pages,omitempty"`           // page count the completed pages refer to
+	Completed []int  `json:"completed_pages,omitempty"` // pages fetched successfully
+	ResumeKey string `json:"resume_key,omitempty"`      // next cursor batch (--cursor mode)
+}
+
+func newCheckpoint(path, output string) *checkpoint {
+	return &checkpoint{
+		Version: checkpointVersion,
+		Output:  output,
+		Targets: make(map[string]*targetState),
+		path:    path,
+	}
+}
+
+// loadCheckpoint reads a checkpoint written by an earlier run. Later saves go
+// back to the same path.
+func loadCheckpoint(path string) (*checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cp := newCheckpoint(path, "")
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("parse checkpoint %s: %w", path, err)
+	}
+	if cp.Version != checkpointVersion {
+		return nil, fmt.Errorf("checkpoint %s has version %d, want %d", path, cp.Version, checkpointVersion)
+	}
+	if cp.Targets == nil {
+		cp.Targets = make(map[string]*targetState)
+	}
+	return cp, nil
+}
+
+// target returns the state for name, creating it. Caller must hold c.mu.
+func (c *checkpoint) target(name string) *targetState {
+	ts := c.Targets[name]
+	if ts == nil {
+		ts = &targetState{}
+		c.Targets[name] = ts
+	}
+	return ts
+}
+
+// useQuery ties target's progress to query, the run's checkpointQuery for it.
+// Progress made with another query (other filters, fields, or source) does
+// not describe this run's pages or batches, so it is discarded; useQuery
+// reports whether there was any.
+func (c *checkpoint) useQuery(target, query string) (discarded bool) {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ts := c.Targets[target]
+	if ts != nil && ts.Query == query {
+		return false
+	}
+	c.Targets[target] = &targetState{Query: query}
+	return ts != nil && (ts.Done || len(ts.Completed) > 0 || ts.ResumeKey != "")
+}
+
+// isDone reports whether target finished in an earlier run.
+func (c *checkpoint) isDone(target string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ts := c.Targets[target]
+	return ts != nil && ts.Done
+}
+
+// startPages records the page count for target and returns the pages already
+// completed. If the count differs from the one the completed pages were
+// recorded against, the archive has changed and page boundaries have shifted,
+// so the old progress is discarded (changed=true) and every page is fetched
+// again; duplicates are still suppressed via the output file.
+func (c *checkpoint) startPages(target string, pages int) (done map[int]bool, changed bool) {
+	done = make(map[int]bool)
+	if c == nil {
+		return done, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ts := c.target(target)
+	if ts.Pages != pages && len(ts.Completed) > 0 {
+		ts.Completed = nil
+		changed = true
+	}
+	ts.Pages = pages
+	for _, p := range ts.Completed {
+		done[p] = true
+	}
+	return done, changed
+}
+
+// pageDone records that page p of target was fetched and queued in full, and
+// returns how many of its pages are done.
+func (c *checkpoint) pageDone(target string, p int) int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ts := c.target(target)
+	ts.Completed = append(ts.Completed, p)
+	return len(ts.Completed)
+}
+
+// allPagesDone reports whether every page of target has completed.
+func (c *checkpoint) allPagesDone(target string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ts := c.target(target)
+	return len(ts.Completed) >= ts.Pages
+}
+
+// resumeKey returns the cursor key target's walk should continue from.
+func (c *checkpoint) resumeKey(target string) string {
+	if c == nil {
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.target(target).ResumeKey
+}
+
+// setResumeKey records the cursor key of target's next unfetched batch.
+func (c *checkpoint) setResumeKey(target, key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.target(target).ResumeKey = key
+}
+
+// finish marks target complete and drops its page-level detail.
+func (c *checkpoint) finish(target string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Targets[target] = &targetState{Query: c.target(target).Query, Done: true}
+}
+
+// save writes the checkpoint atomically (temp file + rename), so a crash
+// mid-write never leaves a truncated checkpoint behind.
+func (c *checkpoint) save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	c.Updated = time.Now().UTC()
+	data, err := json.MarshalIndent(c, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.path, append(data, '\n'))
+}
+
+// openAppend opens path for appending and returns the dedup keys of the
+// results it already holds, as derived by keyOf from each line (blank keys are
+// skipped). A trailing partial line, left by a run that died mid-write, is
+// truncated away so the next result starts on a fresh line. With gz the file
+// holds gzip members, one per checkpoint save, and a damaged last member is
+// dropped the same way; the caller appends new members.
+func openAppend(path string, gz bool, keyOf func(line string) string) (*os.File, map[string]struct{}, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+	known := make(map[string]struct{})
+	add := func(line string) {
+		if key := keyOf(line); key != "" {
+			known[key] = struct{}{}
+		}
+	}
+	complete, err := readLines(f, gz, add)
+	if err == nil {
+		var st os.FileInfo
+		if st, err = f.Stat(); err == nil && st.Size() > complete {
+			err = f.Truncate(complete)
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, known, nil
+}
+
+// readLines calls fn with each complete line of f, gunzipping it when gz is
+// set, and returns the size of the intact part. The file must be compressed
+// exactly when gz is set, or appending would mix formats.
+func readLines(f *os.File, gz bool, fn func(line string)) (int64, error) {
+	isGz, err := isGzipFile(f)
+	if err != nil {
+		return 0, err
+	}
+	if st, err := f.Stat(); err == nil && st.Size() > 0 && isGz != gz {
+		if gz {
+			return 0, fmt.Errorf("%s is not gzip-compressed; cannot append compressed output", f.Name())
+		}
+		return 0, fmt.Errorf("%s is gzip-compressed; name it .gz or pass --compress to append to it", f.Name())
+	}
+	if gz {
+		return readGzipLines(f, fn)
+	}
+	var complete int64 // bytes up to and including the last newline
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadString('\n')
+		if err == nil {
+			complete += int64(len(line))
+			fn(line)
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return complete, nil
+		}
+		return complete, err
+	}
+}
+
+// outputKey derives the dedup key of one previously written output line, as
+// the printer for the current mode would have keyed it: the --collapse key of
+// a JSONL record or CSV/TSV row (by default its URL), or the line itself.
+func (r *Runner) outputKey(line string) string {
+	switch {
+	case r.cfg.CSV || r.cfg.TSV:
+		return r.tableKey(line)
+	case r.cfg.JSON:
+		var rec jsonRecord
+		if json.Unmarshal([]byte(line), &rec) != nil || rec.URL == "" {
+			return ""
+		}
+		return r.collapse.key(rec.capture())
+	case r.cfg.ESBulk:
+		var doc esDoc // action lines have no url and are skipped
+		if json.Unmarshal([]byte(line), &doc) != nil || doc.URL == "" {
+			return ""
+		}
+		return r.collapse.key(cdx.Record{Original: doc.URL, Timestamp: doc.Timestamp, Digest: doc.Digest})
+	case r.cfg.SmartDedup:
+		return urlShape(strings.TrimSpace(line))
+	}
+	return strings.TrimSpace(line)
+}
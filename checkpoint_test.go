@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.ckpt")
+	cp := newCheckpoint(path, "out.txt")
+	for _, target := range []string{"a.com", "b.com", "c.com"} {
+		cp.useQuery(target, "q1")
+	}
+	cp.startPages("a.com", 3)
+	cp.pageDone("a.com", 0)
+	cp.pageDone("a.com", 2)
+	cp.setResumeKey("b.com", "key+1")
+	cp.finish("c.com")
+	if err := cp.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	got, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("loadCheckpoint: %v", err)
+	}
+	if got.Output != "out.txt" {
+		t.Errorf("Output = %q, want out.txt", got.Output)
+	}
+	for _, target := range []string{"a.com", "b.com", "c.com"} {
+		if got.useQuery(target, "q1") {
+			t.Errorf("useQuery(%s) discarded progress made with the same query", target)
+		}
+	}
+	if !got.isDone("c.com") || got.isDone("a.com") {
+		t.Errorf("isDone: c.com=%v a.com=%v, want true/false", got.isDone("c.com"), got.isDone("a.com"))
+	}
+	done, changed := got.startPages("a.com", 3)
+	if changed || !reflect.DeepEqual(done, map[int]bool{0: true, 2: true}) {
+		t.Errorf("startPages = %v, changed=%v; want pages 0 and 2", done, changed)
+	}
+	if got.allPagesDone("a.com") {
+		t.Error("allPagesDone with page 1 missing")
+	}
+	if k := got.resumeKey("b.com"); k != "key+1" {
+		t.Errorf("resumeKey = %q, want key+1", k)
+	}
+
+	// A different page count invalidates the recorded pages.
+	if done, changed := got.startPages("a.com", 5); !changed || len(done) != 0 {
+		t.Errorf("startPages after count change = %v, changed=%v; want none, true", done, changed)
+	}
+
+	// Progress made with another query is dropped.
+	if !got.useQuery("c.com", "q2") || got.isDone("c.com") {
+		t.Error("useQuery with another query should discard c.com's progress")
+	}
+	if got.useQuery("d.com", "q2") {
+		t.Error("useQuery reported progress for a new target")
+	}
+
+	// A nil checkpoint is a no-op everywhere.
+	var none *checkpoint
+	none.pageDone("a.com", 1)
+	none.finish("a.com")
+	if none.isDone("a.com") || none.save() != nil {
+		t.Error("nil checkpoint should report nothing done and save nothing")
+	}
+}
+
+func TestOpenAppend(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		jsonKeys bool
+		wantKeys []string
+		wantFile string
+	}{
+		{"plain lines", "http://a/1\nhttp://a/2\n", false, []string{"http://a/1", "http://a/2"}, "http://a/1\nhttp://a/2\n"},
+		{"partial last line truncated", "http://a/1\nhttp://a/", false, []string{"http://a/1"}, "http://a/1\n"},
+		{"jsonl keyed by url", `{"url":"http://a/1","status":"200"}` + "\n", true, []string{"http://a/1"}, `{"url":"http://a/1","status":"200"}` + "\n"},
+		{"missing file", "", false, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out.txt")
+			if tt.content != "" {
+				if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r := &Runner{cfg: &Config{JSON: tt.jsonKeys}}
+			f, known, err := openAppend(path, false, r.outputKey)
+			if err != nil {
+				t.Fatalf("openAppend: %v", err)
+			}
+			if _, err := f.WriteString("new\n"); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			if len(known) != len(tt.wantKeys) {
+				t.Errorf("known = %v, want %v", known, tt.wantKeys)
+			}
+			for _, k := range tt.wantKeys {
+				if _, ok := known[k]; !ok {
+					t.Errorf("key %q missing from %v", k, known)
+				}
+			}
+			data, _ := os.ReadFile(path)
+			if string(data) != tt.wantFile+"new\n" {
+				t.Errorf("file = %q, want %q", data, tt.wantFile+"new\n")
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
+)
+
+// --collapse kinds.
+const (
+	collapseNone      = "none"
+	collapseURLKey    = "urlkey"
+	collapseDigest    = "digest"
+	collapseTimestamp = "timestamp"
+)
+
+// collapseSpec is a parsed --collapse value: which captures of a URL count as
+// the same result. digits is the timestamp prefix length for "timestamp:N"
+// (4 = one per year, 6 = one per month, ...).
+type collapseSpec struct {
+	kind   string
+	digits int
+}
+
+// parseCollapse parses a --collapse value. Empty selects urlkey, the
+// historical one-capture-per-URL behaviour.
+func parseCollapse(s string) (collapseSpec, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "", collapseURLKey:
+		return collapseSpec{kind: collapseURLKey}, nil
+	case collapseNone, collapseDigest:
+		return collapseSpec{kind: s}, nil
+	}
+	if n, ok := strings.CutPrefix(s, collapseTimestamp+":"); ok {
+		d, err := strconv.Atoi(n)
+		if err != nil || d < 1 || d > 14 {
+			return collapseSpec{}, fmt.Errorf("timestamp:N needs N between 1 and 14 (4 = year, 6 = month, 8 = day), got %q", n)
+		}
+		return collapseSpec{kind: collapseTimestamp, digits: d}, nil
+	}
+	return collapseSpec{}, fmt.Errorf("must be none, urlkey, digest, or timestamp:N, got %q", s)
+}
+
+// param returns the CDX collapse= parameter for c ("" to send none).
+func (c collapseSpec) param() string {
+	switch c.kind {
+	case "":
+		return collapseURLKey
+	case collapseNone:
+		return ""
+	case collapseTimestamp:
+		return collapseTimestamp + ":" + strconv.Itoa(c.digits)
+	}
+	return c.kind
+}
+
+// field returns the CDX column, besides the URL, that identifies a capture
+// under c, or "" when the URL alone does.
+func (c collapseSpec) field() string {
+	switch c.kind {
+	case collapseNone, collapseTimestamp:
+		return cdx.FieldTimestamp
+	case collapseDigest:
+		return cdx.FieldDigest
+	}
+	return ""
+}
+
+// key returns the dedup key of rec under c. The server's collapse only merges
+// adjacent lines (and Common Crawl and TimeMaps ignore it), so record printers
+// dedup on this key to make the collapse hold across the whole run.
+func (c collapseSpec) key(rec cdx.Record) string {
+	switch c.kind {
+	case collapseNone:
+		return rec.Original + " " + rec.Timestamp
+	case collapseDigest:
+		return rec.Original + " " + rec.Digest
+	case collapseTimestamp:
+		return rec.Original + " " + rec.Timestamp[:min(c.digits, len(rec.Timestamp))]
+	}
+	return rec.Original
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
+)
+
+func TestParseCollapse(t *testing.T) {
+	tests := []struct {
+		in        string
+		wantParam string
+		wantField string
+		wantErr   bool
+	}{
+		{"", "urlkey", "", false},
+		{"urlkey", "urlkey", "", false},
+		{"None", "", "timestamp", false},
+		{"digest", "digest", "digest", false},
+		{"timestamp:6", "timestamp:6", "timestamp", false},
+		{"timestamp:0", "", "", true},
+		{"timestamp:15", "", "", true},
+		{"timestamp", "", "", true},
+		{"statuscode", "", "", true},
+	}
+	for _, tt := range tests {
+		c, err := parseCollapse(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCollapse(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (c.param() != tt.wantParam || c.field() != tt.wantField) {
+			t.Errorf("parseCollapse(%q): param %q field %q, want %q %q", tt.in, c.param(), c.field(), tt.wantParam, tt.wantField)
+		}
+	}
+	if p := (collapseSpec{}).param(); p != "urlkey" {
+		t.Errorf("zero collapseSpec param = %q, want urlkey", p)
+	}
+}
+
+func TestCollapseKey(t *testing.T) {
+	a := cdx.Record{Original: "http://example.com/", Timestamp: "20200115000000", Digest: "AAA"}
+	b := cdx.Record{Original: "http://example.com/", Timestamp: "20200320000000", Digest: "AAA"}
+	c := cdx.Record{Original: "http://example.com/", Timestamp: "20210101000000", Digest: "BBB"}
+	tests := []struct {
+		collapse string
+		same     [3]bool // a==b, b==c, a==c
+	}{
+		{"urlkey", [3]bool{true, true, true}},
+		{"none", [3]bool{false, false, false}},
+		{"digest", [3]bool{true, false, false}},
+		{"timestamp:4", [3]bool{true, false, false}},
+		{"timestamp:6", [3]bool{false, false, false}},
+	}
+	for _, tt := range tests {
+		cs, _ := parseCollapse(tt.collapse)
+		got := [3]bool{cs.key(a) == cs.key(b), cs.key(b) == cs.key(c), cs.key(a) == cs.key(c)}
+		if got != tt.same {
+			t.Errorf("collapse %s: same = %v, want %v", tt.collapse, got, tt.same)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// decompressed returns r, transparently gunzipped when its content is gzip
+// (sniffed, so it works for stdin as well as files of any name).
+func decompressed(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if head, _ := br.Peek(len(gzipMagic)); !bytes.Equal(head, gzipMagic) {
+		return br, nil
+	}
+	return gzip.NewReader(br)
+}
+
+// openInput opens a local input file (--list, --template-file), gunzipping
+// it when it is gzip-compressed.
+func openInput(path string) (io.Reader, io.Closer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := decompressed(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, f, nil
+}
+
+// readInput reads a whole local input file, gunzipping it if needed.
+func readInput(path string) ([]byte, error) {
+	r, c, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return io.ReadAll(r)
+}
+
+// isGzipFile reports whether f starts with the gzip magic, leaving the offset
+// at the start.
+func isGzipFile(f *os.File) (bool, error) {
+	head := make([]byte, len(gzipMagic))
+	n, err := f.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	return n == len(head) && bytes.Equal(head, gzipMagic), nil
+}
+
+// countingReader counts the bytes consumed from a bufio.Reader. It is an
+// io.ByteReader, so gzip reads exactly up to the end of each member rather
+// than buffering past it, and n is the offset of the member's end.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// readGzipLines calls fn with each line of the gzip members of r and returns
+// the size of the intact members. A member is closed at every checkpoint save
+// and when the run ends, so a run that died mid-write leaves a truncated last
+// member holding only results the checkpoint does not cover yet: its lines are
+// not passed to fn, and the caller truncates it away. fn sees a member's lines
+// only once the member proved intact.
+func readGzipLines(r io.Reader, fn func(line string)) (complete int64, err error) {
+	cr := &countingReader{r: bufio.NewReader(r)}
+	zr := new(gzip.Reader)
+	for {
+		if err := zr.Reset(cr); err != nil {
+			if errors.Is(err, io.EOF) {
+				return complete, nil // clean end
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return complete, nil // header cut short
+			}
+			return complete, err
+		}
+		zr.Multistream(false)
+		var lines []string
+		br := bufio.NewReader(zr)
+		for {
+			line, err := br.ReadString('\n')
+			if line != "" {
+				lines = append(lines, line)
+			}
+			if err == nil {
+				continue
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return complete, nil // member cut short
+			}
+			if !errors.Is(err, io.EOF) {
+				return complete, err
+			}
+			break
+		}
+		for _, l := range lines {
+			fn(l)
+		}
+		complete = cr.n
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	io.WriteString(zw, s)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressed(t *testing.T) {
+	for name, in := range map[string][]byte{
+		"plain":    []byte("a.com\nb.com\n"),
+		"gzip":     gzipped(t, "a.com\nb.com\n"),
+		"one byte": {0x1f},
+	} {
+		r, err := decompressed(bytes.NewReader(in))
+		if err != nil {
+			t.Fatalf("%s: decompressed: %v", name, err)
+		}
+		got, _ := io.ReadAll(r)
+		want := "a.com\nb.com\n"
+		if name == "one byte" {
+			want = "\x1f"
+		}
+		if string(got) != want {
+			t.Errorf("%s: read %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestReadGzipLines(t *testing.T) {
+	first := gzipped(t, "http://a/1\nhttp://a/2\n")
+	second := gzipped(t, "http://a/3\n")
+	tests := []struct {
+		name     string
+		data     []byte
+		want     []string
+		complete int
+	}{
+		{"empty", nil, nil, 0},
+		{"two members", append(append([]byte{}, first...), second...), []string{"http://a/1\n", "http://a/2\n", "http://a/3\n"}, len(first) + len(second)},
+		{"truncated last member", append(append([]byte{}, first...), second[:len(second)-3]...), []string{"http://a/1\n", "http://a/2\n"}, len(first)},
+		{"cut in the header", append(append([]byte{}, first...), second[:4]...), []string{"http://a/1\n", "http://a/2\n"}, len(first)},
+	}
+	for _, tt := range tests {
+		var got []string
+		complete, err := readGzipLines(bytes.NewReader(tt.data), func(l string) { got = append(got, l) })
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) || complete != int64(tt.complete) {
+			t.Errorf("%s: lines %q, complete %d; want %q, %d", tt.name, got, complete, tt.want, tt.complete)
+		}
+	}
+}
+
+func TestOpenAppendGzip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt.gz")
+	good := gzipped(t, "http://a/1\n")
+	if err := os.WriteFile(path, append(append([]byte{}, good...), gzipped(t, "http://a/2\n")[:12]...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := &Runner{cfg: &Config{}}
+	f, known, err := openAppend(path, true, r.outputKey)
+	if err != nil {
+		t.Fatalf("openAppend: %v", err)
+	}
+	zw := gzip.NewWriter(f)
+	io.WriteString(zw, "new\n")
+	zw.Close()
+	f.Close()
+
+	if _, ok := known["http://a/1"]; !ok || len(known) != 1 {
+		t.Errorf("known = %v, want only http://a/1", known)
+	}
+	data, _ := os.ReadFile(path)
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil || string(got) != "http://a/1\nnew\n" {
+		t.Errorf("file = %q (%v), want the intact member plus the new one", got, err)
+	}
+}
+
+func TestOpenAppendFormatMismatch(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "plain.gz")
+	os.WriteFile(plain, []byte("http://a/1\n"), 0o644)
+	compressed := filepath.Join(dir, "urls.txt")
+	os.WriteFile(compressed, gzipped(t, "http://a/1\n"), 0o644)
+
+	r := &Runner{cfg: &Config{}}
+	if _, _, err := openAppend(plain, true, r.outputKey); err == nil || !strings.Contains(err.Error(), "not gzip") {
+		t.Errorf("plain file opened as gzip: %v", err)
+	}
+	if _, _, err := openAppend(compressed, false, r.outputKey); err == nil || !strings.Contains(err.Error(), "--compress") {
+		t.Errorf("gzip file opened as plain: %v", err)
+	}
+}
@@ -3,46 +3,127 @@ package main
 import (
 	"flag"
 	"fmt"
+	"math"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
 )
 
 // Config collects all CLI options for the tool.
 type Config struct {
-	URLPattern      string
-	URLList         []string // domains read from stdin when --stdin is set
-	OutputFile      string
-	OnlyQuery       bool
-	OnlyQueryKeys   bool
-	NoQuery         bool
-	ExcludeExt      string
-	IncludeExt      string
-	ExcludeDefaults bool
-	Workers         int
-	PageWorkers     int
-	ExtractPaths    bool
-	Subs            bool
-	JSON            bool // emit one JSON object per line (JSONL) instead of plain text
-	Timeout         time.Duration
-	RateLimit       int    // max CDX page requests per second (0 = unlimited)
-	Retries         int    // max attempts per CDX request
-	From            string // CDX from= timestamp filter (yyyy[MMdd[hhmmss]])
-	To              string // CDX to= timestamp filter (yyyy[MMdd[hhmmss]])
-	Status          string // CDX statuscode filter (e.g. 200, 2.., (200|301))
-	Mime            string // CDX mimetype filter (e.g. text/html, application/json)
-	Proxy           string // HTTP/HTTPS/SOCKS5 proxy URL; empty falls back to env
-	ListFile        string // read targets from this file (one per line)
-	Silent          bool   // results only: no banner, progress, or info/warn logs
-	Stats           bool   // periodic progress stats on stderr
-	NoColor         bool   // disable ANSI color everywhere
+	URLPattern       string
+	URLList          []string // domains read from stdin when --stdin is set
+	OutputFile       string
+	OutputDir        string // write one file per target here (--output-dir)
+	ModeDirs         bool   // --output-dir files go in a subfolder named after the mode
+	Append           bool   // add new results to existing output files instead of truncating them
+	OnlyQuery        bool
+	OnlyQueryKeys    bool
+	NoQuery          bool
+	ExcludeExt       string
+	IncludeExt       string
+	ExcludeDefaults  bool
+	Workers          int
+	PageWorkers      int
+	ExtractPaths     bool
+	Subs             bool
+	JSON             bool   // emit one JSON object per line (JSONL) instead of plain text
+	CSV              bool   // emit CSV rows of --fields
+	TSV              bool   // emit TSV rows of --fields
+	Fields           string // comma-separated --csv/--tsv columns
+	Template         string // Go text/template rendering each record (--template, or read from --template-file)
+	Collapse         string // which captures count as one result: none, urlkey, digest, timestamp:N
+	Timeline         bool   // aggregate captures per period instead of listing them
+	TimelineBy       string // --timeline period: "year" (default) or "month"
+	TimelinePaths    bool   // --timeline rows per top-level path, not just per host
+	OpenAPI          bool   // emit an OpenAPI 3 skeleton inferred from the URLs
+	HAR              bool   // emit an HTTP Archive (HAR 1.2) of the captures
+	Burp             bool   // emit Burp Suite's XML item format
+	ESBulk           bool   // emit Elasticsearch/OpenSearch _bulk NDJSON (implied by --es-url)
+	ESIndex          string // index named in --es-bulk action lines
+	ESURL            string // POST --es-bulk batches to this cluster
+	ESBatch          int    // documents per --es-url request
+	Timeout          time.Duration
+	RateLimit        float64       // max CDX requests per second, fractional allowed (0 = unlimited)
+	Burst            int           // requests allowed back to back before --rate applies
+	Retries          int           // max attempts per CDX request
+	RetryDelay       time.Duration // pause before the second pass over failed pages
+	FailedReport     string        // write pages still failing after retries here (JSONL)
+	Summary          string        // write a JSON run summary here
+	HTMLReport       string        // write a self-contained HTML report of the run here
+	From             string        // CDX from= timestamp filter (yyyy[MMdd[hhmmss]])
+	To               string        // CDX to= timestamp filter (yyyy[MMdd[hhmmss]])
+	Status           []string      // CDX statuscode filters (e.g. 200, 2.., !404); repeatable
+	Mime             []string      // CDX mimetype filters (e.g. text/html, !image/.*); repeatable
+	CDXFilters       []string      // raw CDX filters, "[!]field:regex" (--cdx-filter)
+	MatchRegex       []string      // keep only URLs matching one of these (--match-regex)
+	FilterRegex      []string      // drop URLs matching any of these (--filter-regex)
+	MatchHost        []string      // --match-regex on the host only
+	FilterHost       []string      // --filter-regex on the host only
+	MatchPath        []string      // --match-regex on the path only
+	FilterPath       []string      // --filter-regex on the path only
+	MatchQuery       []string      // --match-regex on the query string only
+	FilterQuery      []string      // --filter-regex on the query string only
+	Proxy            string        // HTTP/HTTPS/SOCKS5 proxy URL; empty falls back to env
+	ListFile         string        // read targets from this file (one per line)
+	Silent           bool          // results only: no banner, progress, or info/warn logs
+	Stats            bool          // periodic progress stats on stderr
+	NoColor          bool          // disable ANSI color everywhere
+	Source           string        // URL index to query: "wayback" (default), "commoncrawl", or "timemap"
+	CCIndexes        string        // comma-separated Common Crawl crawl IDs; empty = latest
+	TimeMaps         string        // comma-separated Memento TimeMap endpoints for --source timemap
+	Cursor           bool          // walk CDX with showResumeKey/resumeKey instead of page numbers
+	CursorLimit      int           // results per resume-key batch
+	Checkpoint       string        // write run progress to this file (--checkpoint)
+	Resume           string        // continue the run recorded in this checkpoint file
+	CacheDir         string        // store raw CDX responses here and reuse them
+	CacheTTL         time.Duration // cached responses older than this are refetched (0 = never)
+	Offline          bool          // serve only from --cache-dir; never touch the network
+	Compress         bool          // gzip the output file whatever its name (.gz names always are)
+	SmartDedup       bool          // print one URL per shape (query values, IDs, slugs ignored)
+	SmartDedupLatest bool          // --smart-dedup keeping the most recently captured URL of each shape
 
 	// excludeFlagSet records whether --exclude-ext was passed on the command
 	// line, captured at parse time so EffectiveExclude does not depend on the
 	// global flag package state at call time.
 	excludeFlagSet bool
+	// collapseFlagSet records whether --collapse was passed, so --timeline
+	// can pick its own default.
+	collapseFlagSet bool
+}
+
+// stringList is a repeatable string flag: each occurrence adds a value.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ", ") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
 }
 
+// trimList trims the values of a repeatable flag and drops empty ones.
+func trimList(l stringList) []string {
+	var out []string
+	for _, s := range l {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// URL index sources selectable with --source.
+const (
+	sourceWayback     = "wayback"
+	sourceCommonCrawl = "commoncrawl"
+	sourceTimeMap     = "timemap"
+)
+
 const logo = `  __ _  _____      ____ _ _   _| |__   __ _  ___| | ____ _  ___
  / _` + "`" + ` |/ _ \ \ /\ / / _` + "`" + ` | | | | '_ \ / _` + "`" + ` |/ __| |/ / _` + "`" + ` |/ _ \
 | (_| | (_) \ V  V / (_| | |_| | |_) | (_| | (__|   < (_| | (_) |
@@ -97,15 +178,46 @@ func printUsage() {
 	cont("e.g.  example.com   example.com/api/v1   *.example.com")
 	row("--stdin", "Read targets from stdin (one per line, # = comment)")
 	row("-l, --list <file>", "Read targets from a file (one per line)")
+	cont("either may be gzip-compressed")
+	row("--source <name>", "URL index: wayback, commoncrawl, timemap (default: wayback)")
+	row("--cc-index <ids>", "Common Crawl crawl IDs, comma-separated (default: latest)")
+	cont("e.g.  CC-MAIN-2024-33,CC-MAIN-2024-30")
+	row("--timemap <urls>", "Memento TimeMap endpoints, comma-separated (timemap source)")
+	cont("e.g.  https://arquivo.pt/wayback/timemap/link/")
 
 	head("OUTPUT  (modes are mutually exclusive)")
 	row("-o, --output <file>", "Write results to file (also prints to stdout)")
+	cont("gzip-compressed when the name ends in .gz; kept as")
+	cont("<file>.partial if the run is interrupted or incomplete")
+	row("--compress", "Gzip the -o file whatever its name")
+	row("--append", "Add only new results to the existing -o/--output-dir")
+	cont("files instead of overwriting; reports new vs known")
+	row("--output-dir <dir>", "Write one file per target (with --stdin/--list) plus")
+	cont("index.json: target -> file, result count, status")
+	row("--mode-dirs", "Put --output-dir files in a subfolder per mode (json/...)")
 	row("--only-query", "Print full query strings only    e.g. foo=1&bar=2")
 	row("--only-query-keys", "Print query parameter keys only  e.g. foo, bar")
 	row("--no-query", "Strip query strings from output URLs")
+	row("--smart-dedup", "One URL per shape: ignore query values, numeric/UUID/hash")
+	cont("segments, and content slugs   e.g. /item?id=1 = /item?id=2")
+	row("--smart-dedup-latest", "--smart-dedup keeping each shape's most recent capture;")
+	cont("URLs are printed when each target ends")
 	row("--extract-paths", "Print unique path segments (one per line)")
 	row("--subs", "Print unique subdomains of the target domain")
-	row("--json, --jsonl", `Emit JSONL: {"url","timestamp","status","mime"}`)
+	row("--json, --jsonl", `Emit JSONL: {"url","timestamp","time","status","mime",`)
+	cont(`"length","digest","urlkey","replay"}; "-" values omitted`)
+	row("--csv, --tsv", "Emit CSV / TSV rows of --fields, with a header row")
+	row("--fields <list>", "Columns for --csv/--tsv (default: original,timestamp,")
+	cont("statuscode,mimetype). CDX: original timestamp statuscode")
+	cont("mimetype digest length urlkey; derived: host path query")
+	cont("extension snapshot")
+	row("--template <tmpl>", "Render each record with a Go text/template, e.g.")
+	cont(`'{{.Scheme}}://{{.Host}}/FUZZ'   '{{.URL}} {{.Status}}'`)
+	cont("fields: URL Scheme Host Hostname Port Path Query Fragment")
+	cont("Extension Params Timestamp Time Status Mime Length Digest")
+	cont("URLKey Snapshot Replay; funcs: lower upper replace")
+	cont("shellquote mdcell")
+	row("--template-file <f>", "Read the --template from a file")
 
 	head("FILTERING")
 	row("--exclude-ext <exts>", "Comma-separated extensions to exclude (e.g. js,css,png)")
@@ -116,16 +228,62 @@ func printUsage() {
 	row("--include-ext <exts>", "Only include these extensions (overrides exclude)")
 	row("--from <ts>", "Only captures at/after this time (yyyy[MMdd[hhmmss]])")
 	row("--to <ts>", "Only captures at/before this time (yyyy[MMdd[hhmmss]])")
-	row("--status <re>", "CDX statuscode filter   e.g. 200  2..  (200|301)")
-	row("--mime <re>", "CDX mimetype filter     e.g. text/html  application/json")
+	row("--collapse <mode>", "Which captures count as one result (default: urlkey)")
+	cont("none = every capture, urlkey = one per URL,")
+	cont("digest = one per distinct content, timestamp:N = one per")
+	cont("N-digit time prefix (4 = year, 6 = month); record modes")
+	row("--openapi", "Emit an OpenAPI 3 JSON skeleton: endpoint templates")
+	cont("(/users/{id}), query parameters with inferred types")
+	row("--har", "Emit an HTTP Archive (HAR 1.2): one entry per URL with")
+	cont("the archived status/MIME; for proxies and HAR viewers")
+	row("--burp", "Emit Burp Suite XML items to load into the site map")
+	cont("without sending traffic")
+	row("--es-bulk", "Emit Elasticsearch/OpenSearch _bulk NDJSON: action line")
+	cont("+ document (URL parts, CDX metadata, target, run_id)")
+	row("--es-index <name>", "Index named in the action lines (default: gowaybackgo)")
+	row("--es-url <url>", "Also POST batches to this cluster's _bulk API, retrying")
+	cont("429/5xx; implies --es-bulk   e.g. http://user:pass@es:9200")
+	cont("output waits while a batch is posted")
+	row("--es-batch <n>", "Documents per --es-url request   (default: 500)")
+	row("--timeline", "Count captures per year/month for each host: table with")
+	cont("first/last/peak period, sparkline, and gaps; add --json")
+	cont("for JSONL rows with per-period counts")
+	row("--timeline-by <unit>", "Timeline period: year or month (default: year)")
+	row("--timeline-paths", "Timeline rows per host and top-level path (/api, ...)")
+	row("--status <re>", "CDX statuscode filter   e.g. 200  2..  (200|301)  !404")
+	cont("repeatable: any plain value may match, no !value may")
+	row("--mime <re>", "CDX mimetype filter     e.g. text/html  !image/.*")
+	cont("repeatable, like --status")
+	row("--cdx-filter <f>", "Raw CDX filter [!]field:regex; repeatable, all must hold")
+	cont("fields: original urlkey digest length statuscode mimetype")
+	row("--match-regex <re>", "Keep only URLs matching <re>; repeat to allow several")
+	cont("e.g.  --match-regex '/admin' --match-regex '/internal'")
+	row("--filter-regex <re>", "Drop URLs matching <re>; repeatable   e.g. '/static/'")
+	row("--match-host <re>", "--match-regex on the host only (also --filter-host,")
+	cont("--match-path, --filter-path, --match-query, --filter-query)")
 
 	head("PERFORMANCE")
 	row("-rl, --rate <n>", "Max CDX requests/sec (default: 0 = unlimited)")
-	cont("recommended 5-10 to avoid hitting rate limits")
+	cont("fractional ok (0.5 = one every 2s); recommended 5-10")
+	cont("slows down on 429/5xx (from 8/s at 0) and recovers")
+	cont("on success; Retry-After pauses for 1s or more")
+	row("--burst <n>", "Requests allowed back to back under --rate (default: 1)")
 	row("--page-workers <n>", "Concurrent CDX page fetchers   (default: 10)")
 	row("-t, --workers <n>", "Concurrent URL processors      (default: 20)")
 	row("--timeout <sec>", "HTTP timeout in seconds        (default: 80)")
 	row("--retries <n>", "Attempts per CDX request       (default: 3)")
+	row("--retry-delay <sec>", "Pause before re-fetching failed pages (default: 30)")
+	row("--cursor", "Page with CDX resume keys instead of page numbers")
+	cont("automatic when the page count is unavailable (wayback)")
+	row("--cursor-limit <n>", "Results per resume-key batch   (default: 10000)")
+	row("--checkpoint <file>", "Save progress (targets, pages) to file; needs -o")
+	cont("(not --output-dir; rerun that with --append instead)")
+	row("--resume <file>", "Continue an interrupted run from its checkpoint,")
+	cont("appending to the same output without duplicates")
+	row("--cache-dir <dir>", "Cache raw CDX responses on disk and reuse them")
+	row("--cache-ttl <dur>", "Refetch cached responses older than this (default: 24h)")
+	cont("0 = never expire   e.g. 30m  12h  168h")
+	row("--offline", "Serve only from --cache-dir; fail instead of fetching")
 	row("--proxy <url>", "Route via http/https/socks5 proxy")
 	cont("falls back to HTTP_PROXY/HTTPS_PROXY env if unset")
 
@@ -133,6 +291,12 @@ func printUsage() {
 	row("--silent", "Only print results (no banner, progress, or logs)")
 	row("--stats", "Print periodic progress stats to stderr")
 	row("--nc, --no-color", "Disable ANSI color")
+	row("--failed-report <f>", "Write pages that still failed after retries to <f> (JSONL)")
+	cont("any failure makes the exit status 3 (incomplete results)")
+	row("--summary <file>", "Write a JSON run summary: per-target pages, retries,")
+	cont("HTTP statuses, results, bytes, duration, overall status")
+	row("--html-report <f>", "Write a single offline HTML report: sortable/filterable")
+	cont("URL table, hosts, status/MIME/extension breakdowns, run stats")
 
 	head("MISC")
 	row("--version", "Print version and exit")
@@ -143,9 +307,21 @@ func printUsage() {
 	ex("gowaybackgo -u example.com --subs")
 	ex("gowaybackgo -u example.com/api --include-ext json,xml")
 	ex("gowaybackgo -u example.com --json --status 200 --mime text/html")
+	ex("gowaybackgo -u example.com --csv --fields host,path,query,statuscode,snapshot -o triage.csv")
+	ex(`gowaybackgo -u example.com --template 'curl -sI {{shellquote .URL}}'`)
+	ex("gowaybackgo -u example.com/login --json --collapse digest   # every distinct version")
+	ex("gowaybackgo -u example.com/api/ --openapi -o api.json")
+	ex("gowaybackgo -u example.com --exclude-defaults --burp -o sitemap.xml")
+	ex("gowaybackgo -u example.com --es-url http://localhost:9200 --es-index recon > /dev/null")
+	ex("gowaybackgo -u example.com --timeline --timeline-by month --timeline-paths")
+	ex("gowaybackgo -l scope.txt --json --output-dir recon --mode-dirs")
 	ex("gowaybackgo -u example.com --from 2020 --to 2022 -o urls.txt")
 	ex("gowaybackgo -u example.com --proxy http://127.0.0.1:8080")
+	ex("gowaybackgo -u example.com --source commoncrawl")
+	ex("gowaybackgo -u example.com/ --source timemap --timemap https://arquivo.pt/wayback/timemap/link/")
 	ex("cat domains.txt | gowaybackgo --stdin --exclude-defaults")
+	ex("gowaybackgo -l domains.txt -o urls.txt --checkpoint run.ckpt   # then: --resume run.ckpt")
+	ex("gowaybackgo -u example.com --cache-dir ~/.cache/gwbg   # then: --offline --extract-paths")
 	fmt.Fprintln(w)
 }
 
@@ -159,6 +335,9 @@ func ParseConfig() (*Config, error) {
 	flag.StringVar(listFile, "l", "", "") // alias
 	outputFile := flag.String("o", "", "")
 	flag.StringVar(outputFile, "output", "", "") // alias
+	outputDir := flag.String("output-dir", "", "")
+	modeDirs := flag.Bool("mode-dirs", false, "")
+	appendOut := flag.Bool("append", false, "")
 	onlyQuery := flag.Bool("only-query", false, "")
 	onlyQueryKeys := flag.Bool("only-query-keys", false, "")
 	noQuery := flag.Bool("no-query", false, "")
@@ -171,21 +350,66 @@ func ParseConfig() (*Config, error) {
 	subs := flag.Bool("subs", false, "")
 	pageWorkers := flag.Int("page-workers", 10, "")
 	timeout := flag.Int("timeout", 80, "")
-	rateLimit := flag.Int("rate", 0, "")
-	flag.IntVar(rateLimit, "rl", 0, "")         // alias
-	flag.IntVar(rateLimit, "rate-limit", 0, "") // alias
+	rateLimit := flag.Float64("rate", 0, "")
+	flag.Float64Var(rateLimit, "rl", 0, "")         // alias
+	flag.Float64Var(rateLimit, "rate-limit", 0, "") // alias
+	burst := flag.Int("burst", 1, "")
 	retries := flag.Int("retries", 3, "")
+	retryDelay := flag.Int("retry-delay", 30, "")
+	failedReport := flag.String("failed-report", "", "")
+	summary := flag.String("summary", "", "")
+	htmlReport := flag.String("html-report", "", "")
+	cursor := flag.Bool("cursor", false, "")
+	cursorLimit := flag.Int("cursor-limit", cdx.DefaultCursorLimit, "")
+	checkpointFile := flag.String("checkpoint", "", "")
+	resume := flag.String("resume", "", "")
+	cacheDir := flag.String("cache-dir", "", "")
+	cacheTTL := flag.Duration("cache-ttl", 24*time.Hour, "")
+	offline := flag.Bool("offline", false, "")
+	compress := flag.Bool("compress", false, "")
+	smartDedup := flag.Bool("smart-dedup", false, "")
+	smartDedupLatest := flag.Bool("smart-dedup-latest", false, "")
 	jsonOut := flag.Bool("json", false, "")
 	flag.BoolVar(jsonOut, "jsonl", false, "") // alias
+	csvOut := flag.Bool("csv", false, "")
+	tsvOut := flag.Bool("tsv", false, "")
+	fields := flag.String("fields", "", "")
+	collapse := flag.String("collapse", collapseURLKey, "")
+	timeline := flag.Bool("timeline", false, "")
+	timelineBy := flag.String("timeline-by", periodYear, "")
+	timelinePaths := flag.Bool("timeline-paths", false, "")
+	openAPI := flag.Bool("openapi", false, "")
+	harOut := flag.Bool("har", false, "")
+	burpOut := flag.Bool("burp", false, "")
+	esBulk := flag.Bool("es-bulk", false, "")
+	esIndex := flag.String("es-index", defaultESIndex, "")
+	esURL := flag.String("es-url", "", "")
+	esBatch := flag.Int("es-batch", defaultESBatch, "")
+	tmplText := flag.String("template", "", "")
+	tmplFile := flag.String("template-file", "", "")
 	from := flag.String("from", "", "")
 	to := flag.String("to", "", "")
-	status := flag.String("status", "", "")
-	mime := flag.String("mime", "", "")
+	var status, mime, cdxFilter stringList
+	flag.Var(&status, "status", "")
+	flag.Var(&mime, "mime", "")
+	flag.Var(&cdxFilter, "cdx-filter", "")
+	var matchRegex, filterRegex, matchHost, filterHost, matchPath, filterPath, matchQuery, filterQuery stringList
+	flag.Var(&matchRegex, "match-regex", "")
+	flag.Var(&filterRegex, "filter-regex", "")
+	flag.Var(&matchHost, "match-host", "")
+	flag.Var(&filterHost, "filter-host", "")
+	flag.Var(&matchPath, "match-path", "")
+	flag.Var(&filterPath, "filter-path", "")
+	flag.Var(&matchQuery, "match-query", "")
+	flag.Var(&filterQuery, "filter-query", "")
 	proxy := flag.String("proxy", "", "")
 	silent := flag.Bool("silent", false, "")
 	stats := flag.Bool("stats", false, "")
 	noColor := flag.Bool("nc", false, "")
 	flag.BoolVar(noColor, "no-color", false, "") // alias
+	source := flag.String("source", sourceWayback, "")
+	ccIndex := flag.String("cc-index", "", "")
+	timeMaps := flag.String("timemap", "", "")
 	versionFlag := flag.Bool("version", false, "")
 	flag.Parse()
 
@@ -195,36 +419,96 @@ func ParseConfig() (*Config, error) {
 	}
 
 	cfg := &Config{
-		OutputFile:      *outputFile,
-		OnlyQuery:       *onlyQuery,
-		OnlyQueryKeys:   *onlyQueryKeys,
-		NoQuery:         *noQuery,
-		ExcludeExt:      *excludeExt,
-		IncludeExt:      *includeExt,
-		ExcludeDefaults: *excludeDefaults,
-		Workers:         *workers,
-		PageWorkers:     *pageWorkers,
-		ExtractPaths:    *extractPaths,
-		Subs:            *subs,
-		JSON:            *jsonOut,
-		Timeout:         time.Duration(*timeout) * time.Second,
-		RateLimit:       *rateLimit,
-		Retries:         *retries,
-		From:            strings.TrimSpace(*from),
-		To:              strings.TrimSpace(*to),
-		Status:          strings.TrimSpace(*status),
-		Mime:            strings.TrimSpace(*mime),
-		Proxy:           strings.TrimSpace(*proxy),
-		ListFile:        strings.TrimSpace(*listFile),
-		Silent:          *silent,
-		Stats:           *stats,
-		NoColor:         *noColor,
+		OutputFile:       *outputFile,
+		OutputDir:        strings.TrimSpace(*outputDir),
+		ModeDirs:         *modeDirs,
+		Append:           *appendOut,
+		OnlyQuery:        *onlyQuery,
+		OnlyQueryKeys:    *onlyQueryKeys,
+		NoQuery:          *noQuery,
+		ExcludeExt:       *excludeExt,
+		IncludeExt:       *includeExt,
+		ExcludeDefaults:  *excludeDefaults,
+		Workers:          *workers,
+		PageWorkers:      *pageWorkers,
+		ExtractPaths:     *extractPaths,
+		Subs:             *subs,
+		JSON:             *jsonOut,
+		CSV:              *csvOut,
+		TSV:              *tsvOut,
+		Fields:           strings.TrimSpace(*fields),
+		Template:         *tmplText,
+		Collapse:         strings.ToLower(strings.TrimSpace(*collapse)),
+		Timeline:         *timeline,
+		TimelineBy:       strings.ToLower(strings.TrimSpace(*timelineBy)),
+		TimelinePaths:    *timelinePaths,
+		OpenAPI:          *openAPI,
+		HAR:              *harOut,
+		Burp:             *burpOut,
+		ESBulk:           *esBulk || strings.TrimSpace(*esURL) != "",
+		ESIndex:          strings.TrimSpace(*esIndex),
+		ESURL:            strings.TrimSpace(*esURL),
+		ESBatch:          *esBatch,
+		Timeout:          time.Duration(*timeout) * time.Second,
+		RateLimit:        *rateLimit,
+		Burst:            *burst,
+		Retries:          *retries,
+		RetryDelay:       time.Duration(*retryDelay) * time.Second,
+		FailedReport:     strings.TrimSpace(*failedReport),
+		Summary:          strings.TrimSpace(*summary),
+		HTMLReport:       strings.TrimSpace(*htmlReport),
+		Cursor:           *cursor,
+		CursorLimit:      *cursorLimit,
+		Checkpoint:       strings.TrimSpace(*checkpointFile),
+		Resume:           strings.TrimSpace(*resume),
+		CacheDir:         strings.TrimSpace(*cacheDir),
+		CacheTTL:         *cacheTTL,
+		Offline:          *offline,
+		Compress:         *compress,
+		SmartDedup:       *smartDedup || *smartDedupLatest,
+		SmartDedupLatest: *smartDedupLatest,
+		From:             strings.TrimSpace(*from),
+		To:               strings.TrimSpace(*to),
+		Status:           trimList(status),
+		Mime:             trimList(mime),
+		CDXFilters:       trimList(cdxFilter),
+		MatchRegex:       matchRegex,
+		FilterRegex:      filterRegex,
+		MatchHost:        matchHost,
+		FilterHost:       filterHost,
+		MatchPath:        matchPath,
+		FilterPath:       filterPath,
+		MatchQuery:       matchQuery,
+		FilterQuery:      filterQuery,
+		Proxy:            strings.TrimSpace(*proxy),
+		ListFile:         strings.TrimSpace(*listFile),
+		Silent:           *silent,
+		Stats:            *stats,
+		NoColor:          *noColor,
+		Source:           strings.ToLower(strings.TrimSpace(*source)),
+		CCIndexes:        strings.TrimSpace(*ccIndex),
+		TimeMaps:         strings.TrimSpace(*timeMaps),
 	}
 	flag.Visit(func(f *flag.Flag) {
-		if f.Name == "exclude-ext" {
+		switch f.Name {
+		case "exclude-ext":
 			cfg.excludeFlagSet = true
+		case "collapse":
+			cfg.collapseFlagSet = true
 		}
 	})
+	if *tmplFile != "" {
+		if cfg.Template != "" {
+			return nil, fmt.Errorf("--template and --template-file are mutually exclusive")
+		}
+		data, err := readInput(*tmplFile)
+		if err != nil {
+			return nil, fmt.Errorf("read template file: %w", err)
+		}
+		if cfg.Template = string(data); cfg.Template == "" {
+			return nil, fmt.Errorf("template file %s is empty", *tmplFile)
+		}
+	}
 
 	if err := cfg.validate(); err != nil {
 		return nil, err
@@ -233,7 +517,11 @@ func ParseConfig() (*Config, error) {
 	// Target source, in precedence order: stdin, --list <file>, then -u.
 	switch {
 	case *stdinFlag:
-		domains, err := readTargets(os.Stdin)
+		in, err := decompressed(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("read stdin: %w", err)
+		}
+		domains, err := readTargets(in)
 		if err != nil {
 			return nil, fmt.Errorf("read stdin: %w", err)
 		}
@@ -243,12 +531,12 @@ func ParseConfig() (*Config, error) {
 		cfg.URLList = domains
 		cfg.URLPattern = domains[0]
 	case cfg.ListFile != "":
-		f, err := os.Open(cfg.ListFile)
+		in, f, err := openInput(cfg.ListFile)
 		if err != nil {
 			return nil, fmt.Errorf("open list file: %w", err)
 		}
 		defer f.Close()
-		domains, err := readTargets(f)
+		domains, err := readTargets(in)
 		if err != nil {
 			return nil, fmt.Errorf("read list file: %w", err)
 		}
@@ -282,6 +570,75 @@ func (c *Config) EffectiveExclude() string {
 	}
 }
 
+// compressOutput reports whether the output file is written gzip-compressed.
+func (c *Config) compressOutput() bool {
+	return c.OutputFile != "" && (c.Compress || strings.HasSuffix(strings.ToLower(c.OutputFile), ".gz"))
+}
+
+// outputMode names the output mode, for --mode-dirs subfolders and the
+// --output-dir index, with the file extension it writes.
+func (c *Config) outputMode() (name, ext string) {
+	switch {
+	case c.Timeline && c.JSON:
+		return "timeline", ".jsonl"
+	case c.Timeline:
+		return "timeline", ".txt"
+	case c.JSON:
+		return "json", ".jsonl"
+	case c.CSV:
+		return "csv", ".csv"
+	case c.TSV:
+		return "tsv", ".tsv"
+	case c.Template != "":
+		return "template", ".txt"
+	case c.ESBulk:
+		return "es-bulk", ".ndjson"
+	case c.OpenAPI:
+		return "openapi", ".json"
+	case c.HAR:
+		return "har", ".har"
+	case c.Burp:
+		return "burp", ".xml"
+	case c.OnlyQuery:
+		return "query", ".txt"
+	case c.OnlyQueryKeys:
+		return "query-keys", ".txt"
+	case c.ExtractPaths:
+		return "paths", ".txt"
+	case c.Subs:
+		return "subs", ".txt"
+	}
+	return "urls", ".txt"
+}
+
+// matchesOutputLines reports whether the run matches what the output file
+// already holds line by line (--append, --checkpoint, --resume).
+func (c *Config) matchesOutputLines() bool {
+	return c.Append || c.Checkpoint != "" || c.Resume != ""
+}
+
+// documentMode reports whether the output mode builds one document from the
+// whole run, written when it ends.
+func (c *Config) documentMode() bool {
+	return c.OpenAPI || c.HAR || c.Burp
+}
+
+// EffectiveCollapse returns the --collapse to apply. --timeline counts each
+// URL once per period unless --collapse was given explicitly: one capture per
+// URL (urlkey) would only show when URLs were first seen, and every capture
+// (none) can be far more data than a histogram needs. --smart-dedup-latest
+// needs every capture: urlkey keeps each URL's first, not its latest.
+func (c *Config) EffectiveCollapse() string {
+	switch {
+	case c.collapseFlagSet:
+	case c.Timeline:
+		return collapseTimestamp + ":" + strconv.Itoa(periodDigits(c.TimelineBy))
+	case c.SmartDedupLatest:
+		return collapseNone
+	}
+	return c.Collapse
+}
+
 // NormalizeBaseDomain derives a clean domain for subdomain extraction.
 func (c *Config) NormalizeBaseDomain() string {
 	return baseDomainOf(c.URLPattern)
@@ -310,7 +667,15 @@ func (c *Config) validate() error {
 		{c.OnlyQueryKeys, "--only-query-keys"},
 		{c.ExtractPaths, "--extract-paths"},
 		{c.Subs, "--subs"},
-		{c.JSON, "--json"},
+		{c.JSON && !c.Timeline, "--json"}, // --timeline --json selects JSONL rows
+		{c.CSV, "--csv"},
+		{c.TSV, "--tsv"},
+		{c.Template != "", "--template"},
+		{c.Timeline, "--timeline"},
+		{c.OpenAPI, "--openapi"},
+		{c.HAR, "--har"},
+		{c.Burp, "--burp"},
+		{c.ESBulk, "--es-bulk"},
 	}
 	var active []string
 	for _, m := range exclusive {
@@ -333,18 +698,180 @@ func (c *Config) validate() error {
 	if c.Timeout <= 0 {
 		return fmt.Errorf("--timeout must be >= 1 second")
 	}
-	if c.RateLimit < 0 {
-		return fmt.Errorf("--rate must be >= 0 (0 = unlimited), got %d", c.RateLimit)
+	if c.RateLimit < 0 || math.IsNaN(c.RateLimit) || math.IsInf(c.RateLimit, 0) {
+		return fmt.Errorf("--rate must be >= 0 (0 = unlimited), got %g", c.RateLimit)
+	}
+	if c.RetryDelay < 0 {
+		return fmt.Errorf("--retry-delay must be >= 0, got %s", c.RetryDelay)
+	}
+	if c.Burst < 1 {
+		return fmt.Errorf("--burst must be >= 1, got %d", c.Burst)
 	}
 	if c.Retries < 1 {
 		return fmt.Errorf("--retries must be >= 1, got %d", c.Retries)
 	}
 
+	if c.Cursor && c.CursorLimit < 1 {
+		return fmt.Errorf("--cursor-limit must be >= 1, got %d", c.CursorLimit)
+	}
+
+	switch c.Source {
+	case "", sourceWayback, sourceCommonCrawl:
+	case sourceTimeMap:
+		if len(splitCSV(c.TimeMaps)) == 0 {
+			return fmt.Errorf("--source %s requires --timemap <urls>", sourceTimeMap)
+		}
+	default:
+		return fmt.Errorf("--source must be %s, %s, or %s, got %q",
+			sourceWayback, sourceCommonCrawl, sourceTimeMap, c.Source)
+	}
+	if c.CCIndexes != "" && c.Source != sourceCommonCrawl {
+		fmt.Fprintln(os.Stderr, "⚠ WARNING: --cc-index is ignored unless --source commoncrawl")
+	}
+	if c.Cursor && c.Source != "" && c.Source != sourceWayback {
+		return fmt.Errorf("--cursor is only supported with --source %s", sourceWayback)
+	}
+	if c.TimeMaps != "" && c.Source != sourceTimeMap {
+		fmt.Fprintln(os.Stderr, "⚠ WARNING: --timemap is ignored unless --source timemap")
+	}
+
+	if slices.Contains(c.Status, "!") || slices.Contains(c.Mime, "!") {
+		return fmt.Errorf("--status and --mime need a regex after !")
+	}
+	for _, f := range c.CDXFilters {
+		if err := checkCDXFilter(f); err != nil {
+			return fmt.Errorf("--cdx-filter: %w", err)
+		}
+	}
+
+	if c.CacheTTL < 0 {
+		return fmt.Errorf("--cache-ttl must be >= 0 (0 = never expire), got %s", c.CacheTTL)
+	}
+	if c.Offline && c.CacheDir == "" {
+		return fmt.Errorf("--offline requires --cache-dir <dir>")
+	}
+
+	// --resume keeps updating the checkpoint it loaded, so naming a second
+	// file is ambiguous. A checkpoint without -o could not be resumed without
+	// duplicating results, since dedup on resume reads the output file back;
+	// it records that one file, not --output-dir's per-target files.
+	switch {
+	case c.Checkpoint != "" && c.Resume != "":
+		return fmt.Errorf("--checkpoint and --resume are mutually exclusive (--resume keeps updating its file)")
+	case c.Checkpoint != "" && c.OutputDir != "":
+		return fmt.Errorf("--checkpoint cannot be combined with --output-dir: a checkpoint resumes a single -o file; use -o, or --output-dir with --append to skip results already written")
+	case c.Checkpoint != "" && c.OutputFile == "":
+		return fmt.Errorf("--checkpoint requires -o <file>")
+	}
+
+	if c.OutputDir != "" {
+		switch {
+		case c.OutputFile != "":
+			return fmt.Errorf("-o and --output-dir are mutually exclusive")
+		case c.Resume != "":
+			// A resumed run continues the single output file its checkpoint names.
+			return fmt.Errorf("--output-dir cannot be combined with --resume")
+		case c.documentMode():
+			return fmt.Errorf("%s builds one document for the whole run; use -o instead of --output-dir", active[0])
+		}
+	} else if c.ModeDirs {
+		fmt.Fprintln(os.Stderr, "⚠ WARNING: --mode-dirs is ignored without --output-dir")
+	}
+	if c.Append {
+		switch {
+		case c.OutputFile == "" && c.OutputDir == "":
+			return fmt.Errorf("--append requires -o <file> or --output-dir <dir>")
+		case c.Timeline || c.documentMode():
+			// Their output summarizes a run; it cannot be extended line by line.
+			return fmt.Errorf("--append cannot be combined with %s", active[0])
+		}
+	}
+
+	if c.SmartDedup {
+		switch {
+		case len(active) > 0:
+			// Record modes dedup per --collapse; the shape of a URL is not a capture.
+			return fmt.Errorf("--smart-dedup only applies to the default URL output, not %s", active[0])
+		case c.SmartDedupLatest && (c.Checkpoint != "" || c.Resume != ""):
+			// URLs are only written once a target is complete, so pages
+			// fetched before an interruption would be missing from the file.
+			return fmt.Errorf("--smart-dedup-latest cannot be combined with --checkpoint or --resume")
+		case c.SmartDedupLatest && c.collapseFlagSet && slices.Contains([]string{"", collapseURLKey}, strings.ToLower(strings.TrimSpace(c.Collapse))):
+			return fmt.Errorf("--smart-dedup-latest needs more than each URL's first capture; drop --collapse urlkey")
+		}
+	}
+
+	if c.Fields != "" {
+		if _, err := parseFields(c.Fields); err != nil {
+			return fmt.Errorf("--fields: %w", err)
+		}
+		if !c.CSV && !c.TSV {
+			fmt.Fprintln(os.Stderr, "⚠ WARNING: --fields is ignored without --csv or --tsv")
+		}
+	}
+
+	if c.Template != "" {
+		tmpl, err := parseTemplate(c.Template)
+		if err != nil {
+			return fmt.Errorf("--template: %w", err)
+		}
+		if c.matchesOutputLines() && multiLineTemplate(tmpl) {
+			// Those match what the file already holds line by line, which a
+			// record rendered on several lines never matches.
+			return fmt.Errorf("a --template rendering several lines per record cannot be combined with --append, --checkpoint, or --resume")
+		}
+	}
+
+	// Plain-text modes print each URL (or part) once whatever the collapse,
+	// so fetching more captures only costs requests.
+	if cs, err := parseCollapse(c.Collapse); err != nil {
+		return fmt.Errorf("--collapse: %w", err)
+	} else if cs.kind != collapseURLKey && !c.JSON && !c.CSV && !c.TSV && c.Template == "" && !c.Timeline && !c.ESBulk && !c.documentMode() {
+		fmt.Fprintln(os.Stderr, "⚠ WARNING: --collapse only changes output in record modes (--json, --csv, --tsv, --template, --timeline, --es-bulk, --openapi, --har, --burp)")
+	}
+
+	switch c.TimelineBy {
+	case "", periodYear, periodMonth:
+	default:
+		return fmt.Errorf("--timeline-by must be %s or %s, got %q", periodYear, periodMonth, c.TimelineBy)
+	}
+	if c.Timeline && (c.Checkpoint != "" || c.Resume != "") {
+		// Counts are only written once a target is complete, so pages
+		// fetched before an interruption would be missing from them.
+		return fmt.Errorf("--timeline cannot be combined with --checkpoint or --resume")
+	}
+	if c.documentMode() && (c.Checkpoint != "" || c.Resume != "") {
+		// The document is written once, from everything the run fetched.
+		return fmt.Errorf("%s cannot be combined with --checkpoint or --resume", active[0])
+	}
+	if c.ESBulk {
+		// Index names are lowercase and may not contain these characters;
+		// catching it here beats every batch being rejected.
+		if c.ESIndex == "" || c.ESIndex != strings.ToLower(c.ESIndex) || strings.ContainsAny(c.ESIndex, ` "*\<|,>/?#:`) {
+			return fmt.Errorf("--es-index must be a lowercase index name without spaces or \\/*?\"<>|,#:, got %q", c.ESIndex)
+		}
+		if c.ESBatch < 1 {
+			return fmt.Errorf("--es-batch must be >= 1, got %d", c.ESBatch)
+		}
+		if c.ESURL != "" {
+			if _, err := bulkURL(c.ESURL); err != nil {
+				return fmt.Errorf("--es-url: %w", err)
+			}
+		}
+	}
+
+	if !c.Timeline && (c.TimelinePaths || (c.TimelineBy != "" && c.TimelineBy != periodYear)) {
+		fmt.Fprintln(os.Stderr, "⚠ WARNING: --timeline-by and --timeline-paths are ignored without --timeline")
+	}
+
 	// --no-query is a transform on default output; it does nothing under the
 	// exclusive modes above. Warn rather than fail.
 	if c.NoQuery && len(active) == 1 {
 		fmt.Fprintf(os.Stderr, "⚠ WARNING: --no-query is ignored with %s\n", active[0])
 	}
+	if c.Compress && c.OutputFile == "" && c.OutputDir == "" {
+		fmt.Fprintln(os.Stderr, "⚠ WARNING: --compress is ignored without -o or --output-dir (stdout is never compressed)")
+	}
 	if strings.TrimSpace(c.IncludeExt) != "" && strings.TrimSpace(c.ExcludeExt) != "" {
 		fmt.Fprintln(os.Stderr, "⚠ WARNING: --include-ext takes precedence; --exclude-ext is ignored")
 	}
@@ -27,7 +27,7 @@ func TestEffectiveExclude(t *testing.T) {
 func TestValidateNumericFlags(t *testing.T) {
 	// A baseline of valid numeric values; each case overrides one field.
 	base := func() Config {
-		return Config{Workers: 20, PageWorkers: 10, Timeout: 80 * 1e9, RateLimit: 0, Retries: 3}
+		return Config{Workers: 20, PageWorkers: 10, Timeout: 80 * 1e9, RateLimit: 0, Retries: 3, Burst: 1}
 	}
 	tests := []struct {
 		name    string
@@ -44,6 +44,9 @@ func TestValidateNumericFlags(t *testing.T) {
 		{"rate negative", func(c *Config) { c.RateLimit = -3 }, true},
 		{"rate zero is valid", func(c *Config) { c.RateLimit = 0 }, false},
 		{"rate huge is valid (guarded at runtime)", func(c *Config) { c.RateLimit = 1 << 40 }, false},
+		{"rate fractional is valid", func(c *Config) { c.RateLimit = 0.5 }, false},
+		{"burst zero", func(c *Config) { c.Burst = 0 }, true},
+		{"retry-delay negative", func(c *Config) { c.RetryDelay = -1 }, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -59,7 +62,7 @@ func TestValidateNumericFlags(t *testing.T) {
 func TestValidateExclusiveModes(t *testing.T) {
 	// Start from valid numeric fields so only the mode logic is under test.
 	base := func() Config {
-		return Config{Workers: 20, PageWorkers: 10, Timeout: 80 * 1e9, Retries: 3}
+		return Config{Workers: 20, PageWorkers: 10, Timeout: 80 * 1e9, Retries: 3, Burst: 1}
 	}
 	tests := []struct {
 		name    string
@@ -73,6 +76,54 @@ func TestValidateExclusiveModes(t *testing.T) {
 		{"three modes conflict", func(c *Config) { c.OnlyQuery = true; c.ExtractPaths = true; c.Subs = true }, true},
 		{"no-query with a mode is allowed (warned)", func(c *Config) { c.NoQuery = true; c.Subs = true }, false},
 		{"no-query alone", func(c *Config) { c.NoQuery = true }, false},
+		{"template alone", func(c *Config) { c.Template = "{{.Host}}" }, false},
+		{"template with json conflicts", func(c *Config) { c.Template = "{{.URL}}"; c.JSON = true }, true},
+		{"template with unknown field", func(c *Config) { c.Template = "{{.Nope}}" }, true},
+		{"template syntax error", func(c *Config) { c.Template = "{{.URL" }, true},
+		{"multi-line template with append", func(c *Config) { c.Template = "{{.URL}}\n{{.Status}}"; c.Append = true; c.OutputFile = "out.txt" }, true},
+		{"multi-line template with checkpoint", func(c *Config) {
+			c.Template = "{{.URL}}\n{{.Status}}"
+			c.Checkpoint = "run.ckpt"
+			c.OutputFile = "out.txt"
+		}, true},
+		{"one-line template with append", func(c *Config) { c.Template = "{{.URL}}\n"; c.Append = true; c.OutputFile = "out.txt" }, false},
+		{"collapse digest", func(c *Config) { c.Collapse = "digest"; c.JSON = true }, false},
+		{"collapse invalid", func(c *Config) { c.Collapse = "timestamp:x" }, true},
+		{"timeline with json", func(c *Config) { c.Timeline = true; c.JSON = true }, false},
+		{"timeline with csv conflicts", func(c *Config) { c.Timeline = true; c.CSV = true }, true},
+		{"timeline-by invalid", func(c *Config) { c.Timeline = true; c.TimelineBy = "week" }, true},
+		{"timeline with resume", func(c *Config) { c.Timeline = true; c.Resume = "run.ckpt" }, true},
+		{"openapi with checkpoint", func(c *Config) { c.OpenAPI = true; c.Checkpoint = "run.ckpt"; c.OutputFile = "api.json" }, true},
+		{"openapi with json conflicts", func(c *Config) { c.OpenAPI = true; c.JSON = true }, true},
+		{"har alone", func(c *Config) { c.HAR = true }, false},
+		{"output-dir alone", func(c *Config) { c.OutputDir = "out" }, false},
+		{"append with -o", func(c *Config) { c.Append = true; c.OutputFile = "urls.txt" }, false},
+		{"append without output", func(c *Config) { c.Append = true }, true},
+		{"append with timeline", func(c *Config) { c.Append = true; c.OutputFile = "t.txt"; c.Timeline = true }, true},
+		{"output-dir with -o", func(c *Config) { c.OutputDir = "out"; c.OutputFile = "urls.txt" }, true},
+		{"output-dir with resume", func(c *Config) { c.OutputDir = "out"; c.Resume = "run.ckpt" }, true},
+		{"output-dir with checkpoint", func(c *Config) { c.OutputDir = "out"; c.Checkpoint = "run.ckpt" }, true},
+		{"output-dir with openapi", func(c *Config) { c.OutputDir = "out"; c.OpenAPI = true }, true},
+		{"es-bulk alone", func(c *Config) { c.ESBulk = true; c.ESIndex = "recon"; c.ESBatch = 500 }, false},
+		{"es-bulk with json conflicts", func(c *Config) { c.ESBulk = true; c.ESIndex = "recon"; c.ESBatch = 500; c.JSON = true }, true},
+		{"es-bulk uppercase index", func(c *Config) { c.ESBulk = true; c.ESIndex = "Recon"; c.ESBatch = 500 }, true},
+		{"es-bulk zero batch", func(c *Config) { c.ESBulk = true; c.ESIndex = "recon" }, true},
+		{"es-url not http", func(c *Config) { c.ESBulk = true; c.ESIndex = "recon"; c.ESBatch = 1; c.ESURL = "localhost:9200" }, true},
+		{"har with burp conflicts", func(c *Config) { c.HAR = true; c.Burp = true }, true},
+		{"burp with resume", func(c *Config) { c.Burp = true; c.Resume = "run.ckpt" }, true},
+		{"smart-dedup alone", func(c *Config) { c.SmartDedup = true }, false},
+		{"smart-dedup with no-query", func(c *Config) { c.SmartDedup = true; c.NoQuery = true }, false},
+		{"smart-dedup with json", func(c *Config) { c.SmartDedup = true; c.JSON = true }, true},
+		{"smart-dedup with subs", func(c *Config) { c.SmartDedup = true; c.Subs = true }, true},
+		{"smart-dedup-latest with checkpoint", func(c *Config) {
+			c.SmartDedup, c.SmartDedupLatest, c.Checkpoint, c.OutputFile = true, true, "run.ckpt", "urls.txt"
+		}, true},
+		{"smart-dedup-latest with collapse urlkey", func(c *Config) {
+			c.SmartDedup, c.SmartDedupLatest, c.Collapse, c.collapseFlagSet = true, true, "urlkey", true
+		}, true},
+		{"smart-dedup-latest with append", func(c *Config) {
+			c.SmartDedup, c.SmartDedupLatest, c.Append, c.OutputFile = true, true, true, "urls.txt"
+		}, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -84,3 +135,135 @@ func TestValidateExclusiveModes(t *testing.T) {
 		})
 	}
 }
+
+func TestEffectiveCollapse(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"default", Config{Collapse: "urlkey"}, "urlkey"},
+		{"timeline by year", Config{Collapse: "urlkey", Timeline: true}, "timestamp:4"},
+		{"timeline by month", Config{Collapse: "urlkey", Timeline: true, TimelineBy: "month"}, "timestamp:6"},
+		{"explicit collapse wins", Config{Collapse: "none", Timeline: true, collapseFlagSet: true}, "none"},
+		{"smart-dedup-latest", Config{Collapse: "urlkey", SmartDedup: true, SmartDedupLatest: true}, "none"},
+		{"smart-dedup-latest explicit", Config{Collapse: "digest", SmartDedup: true, SmartDedupLatest: true, collapseFlagSet: true}, "digest"},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.EffectiveCollapse(); got != tt.want {
+			t.Errorf("%s: EffectiveCollapse() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCompressOutput(t *testing.T) {
+	tests := []struct {
+		cfg  Config
+		want bool
+	}{
+		{Config{OutputFile: "urls.txt"}, false},
+		{Config{OutputFile: "urls.txt.gz"}, true},
+		{Config{OutputFile: "URLS.GZ"}, true},
+		{Config{OutputFile: "urls.txt", Compress: true}, true},
+		{Config{Compress: true}, false}, // stdout is never compressed
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.compressOutput(); got != tt.want {
+			t.Errorf("compressOutput(%q, --compress=%v) = %v, want %v", tt.cfg.OutputFile, tt.cfg.Compress, got, tt.want)
+		}
+	}
+}
+
+func TestValidateSource(t *testing.T) {
+	tests := []struct {
+		source   string
+		timeMaps string
+		wantErr  bool
+	}{
+		{"", "", false},
+		{sourceWayback, "", false},
+		{sourceCommonCrawl, "", false},
+		{sourceTimeMap, "https://arquivo.pt/wayback/timemap/link/", false},
+		{sourceTimeMap, " , ", true},
+		{"bing", "", true},
+	}
+	for _, tt := range tests {
+		c := Config{Workers: 20, PageWorkers: 10, Timeout: 80 * 1e9, Retries: 3, Burst: 1, Source: tt.source, TimeMaps: tt.timeMaps}
+		if err := c.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("validate(source=%q) error = %v, wantErr %v", tt.source, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateCDXFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*Config)
+		wantErr bool
+	}{
+		{"negated status", func(c *Config) { c.Status = []string{"2..", "!204"} }, false},
+		{"bare ! status", func(c *Config) { c.Status = []string{"!"} }, true},
+		{"bare ! mime", func(c *Config) { c.Mime = []string{"!"} }, true},
+		{"cdx-filter on length", func(c *Config) { c.CDXFilters = []string{"!length:0"} }, false},
+		{"cdx-filter unknown field", func(c *Config) { c.CDXFilters = []string{"host:x"} }, true},
+		{"cdx-filter without regex", func(c *Config) { c.CDXFilters = []string{"digest"} }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{Workers: 20, PageWorkers: 10, Timeout: 80 * 1e9, Retries: 3, Burst: 1}
+			tt.mutate(&c)
+			if err := c.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*Config)
+		wantErr bool
+	}{
+		{"cursor on wayback", func(c *Config) { c.Cursor = true }, false},
+		{"cursor limit zero", func(c *Config) { c.Cursor = true; c.CursorLimit = 0 }, true},
+		{"cursor on commoncrawl", func(c *Config) { c.Cursor = true; c.Source = sourceCommonCrawl }, true},
+		{"limit unused without cursor", func(c *Config) { c.CursorLimit = 0 }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{Workers: 20, PageWorkers: 10, Timeout: 80 * 1e9, Retries: 3, Burst: 1, CursorLimit: 100}
+			tt.mutate(&c)
+			if err := c.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateCheckpointAndCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*Config)
+		wantErr bool
+	}{
+		{"checkpoint with output", func(c *Config) { c.Checkpoint = "run.ckpt"; c.OutputFile = "out.txt" }, false},
+		{"checkpoint without output", func(c *Config) { c.Checkpoint = "run.ckpt" }, true},
+		{"resume alone", func(c *Config) { c.Resume = "run.ckpt" }, false},
+		{"checkpoint and resume", func(c *Config) {
+			c.Checkpoint, c.Resume, c.OutputFile = "a.ckpt", "b.ckpt", "out.txt"
+		}, true},
+		{"offline with cache dir", func(c *Config) { c.Offline = true; c.CacheDir = "cache" }, false},
+		{"offline without cache dir", func(c *Config) { c.Offline = true }, true},
+		{"negative cache ttl", func(c *Config) { c.CacheDir = "cache"; c.CacheTTL = -1 }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{Workers: 20, PageWorkers: 10, Timeout: 80 * 1e9, Retries: 3, Burst: 1}
+			tt.mutate(&c)
+			if err := c.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
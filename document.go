@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"sync/atomic"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
+)
+
+// document is an output mode that builds one document from the whole run,
+// every target included, and writes it once the run ends instead of
+// streaming results.
+type document interface {
+	// add records one capture. Captures arrive deduplicated per target.
+	add(rec cdx.Record)
+	// write renders the document.
+	write(w io.Writer) error
+}
+
+// printDocument feeds the target's records into the run's document.
+func (r *Runner) printDocument(resultsCh <-chan string, pagesCompleted *int32) {
+	seen := r.newDedup()
+	cols := r.cdxFields()
+	for res := range r.results(resultsCh) {
+		rec, ok := cdx.ParseRecord(res, cols)
+		if !ok || rec.Original == "" || !seen.add(r.collapse.key(rec)) {
+			continue
+		}
+		r.doc.add(rec)
+		atomic.AddInt64(&r.found, 1)
+		r.renderProgress(pagesCompleted)
+	}
+}
+
+// writeDocument writes the document mode's output when the run ends. An
+// interrupted run still writes what it collected.
+func (r *Runner) writeDocument() {
+	if r.doc == nil {
+		return
+	}
+	r.pbar.ClearLine()
+	bufw := bufio.NewWriter(r.outWriter)
+	if err := r.doc.write(bufw); err != nil {
+		r.log.warn("error writing output: %v", err)
+	}
+	r.finishOutput(bufw)
+}
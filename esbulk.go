@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
+)
+
+// Defaults for --es-index and --es-batch.
+const (
+	defaultESIndex = "gowaybackgo"
+	defaultESBatch = 500
+)
+
+// bulkGrace is how long a batch may still take once the run is cancelled, so
+// Ctrl-C never waits out the retries on an unreachable cluster.
+const bulkGrace = 5 * time.Second
+
+// esDoc is the document indexed for one record in --es-bulk mode: the URL
+// split into its parts, the CDX metadata (numbers as numbers, so the index
+// maps them as such), and where it came from. Values are sanitized.
+type esDoc struct {
+	URL       string   `json:"url"`
+	Scheme    string   `json:"scheme,omitempty"`
+	Host      string   `json:"host,omitempty"` // hostname, without the port
+	Port      string   `json:"port,omitempty"`
+	Path      string   `json:"path,omitempty"`
+	Query     string   `json:"query,omitempty"`
+	QueryKeys []string `json:"query_keys,omitempty"`
+	Extension string   `json:"extension,omitempty"`
+	Timestamp string   `json:"timestamp,omitempty"`
+	Time      string   `json:"@timestamp,omitempty"` // capture time, RFC 3339
+	Status    int      `json:"status,omitempty"`
+	Mime      string   `json:"mime,omitempty"`
+	Length    int64    `json:"length,omitempty"`
+	Digest    string   `json:"digest,omitempty"`
+	URLKey    string   `json:"urlkey,omitempty"`
+	Replay    string   `json:"replay,omitempty"`
+	Target    string   `json:"target"`
+	Source    string   `json:"source"`
+	RunID     string   `json:"run_id"`
+}
+
+// esAction is the action line preceding each document.
+type esAction struct {
+	Index struct {
+		Index string `json:"_index"`
+		ID    string `json:"_id"`
+	} `json:"index"`
+}
+
+// newESDoc builds the document of a CDX line (jsonFields columns).
+func (r *Runner) newESDoc(line string) (esDoc, bool) {
+	tr, ok := r.newTemplateRecord(line)
+	if !ok {
+		return esDoc{}, false
+	}
+	doc := esDoc{
+		URL:       tr.URL,
+		Scheme:    tr.Scheme,
+		Host:      strings.ToLower(tr.Hostname),
+		Port:      tr.Port,
+		Path:      tr.Path,
+		Query:     tr.Query,
+		Extension: tr.Extension,
+		Timestamp: tr.Timestamp,
+		Time:      tr.Time,
+		Mime:      tr.Mime,
+		Digest:    tr.Digest,
+		URLKey:    tr.URLKey,
+		Replay:    tr.Replay,
+		Target:    sanitizeForTerminal(r.currentPattern),
+		Source:    r.sourceName(),
+		RunID:     r.summary.RunID,
+	}
+	for k := range tr.Params {
+		doc.QueryKeys = append(doc.QueryKeys, k)
+	}
+	slices.Sort(doc.QueryKeys)
+	if n, err := strconv.Atoi(tr.Status); err == nil {
+		doc.Status = n
+	}
+	if n, err := strconv.ParseInt(tr.Length, 10, 64); err == nil {
+		doc.Length = n
+	}
+	return doc, true
+}
+
+// sourceName is the --source in effect, as recorded in indexed documents.
+func (r *Runner) sourceName() string {
+	if r.cfg.Source == "" {
+		return sourceWayback
+	}
+	return r.cfg.Source
+}
+
+// esDocID derives a document ID from the target and the record's dedup key,
+// so indexing the same capture again (a re-run, a later --resume) replaces
+// the document instead of duplicating it.
+func esDocID(target, key string) string {
+	sum := sha1.Sum([]byte(target + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// printESBulk writes records as Elasticsearch/OpenSearch _bulk NDJSON: an
+// index action line, then the document. With --es-url the same lines are
+// also POSTed in batches, until ctx is cancelled. Batches are posted inline,
+// so the printer waits for each (retries included); a slow cluster holds up
+// the fetchers through the full results channel rather than letting queued
+// documents pile up in memory.
+func (r *Runner) printESBulk(ctx context.Context, bufw *bufio.Writer, resultsCh <-chan string, pagesCompleted *int32) {
+	seen := r.newDedup()
+	var batch bytes.Buffer
+	for res := range r.results(resultsCh) {
+		rec, ok := cdx.ParseRecord(res, jsonFields)
+		if !ok || rec.Original == "" {
+			continue
+		}
+		key := r.collapse.key(rec)
+		if !seen.add(key) {
+			continue
+		}
+		doc, ok := r.newESDoc(res)
+		if !ok {
+			continue
+		}
+		var act esAction
+		act.Index.Index = r.cfg.ESIndex
+		act.Index.ID = esDocID(doc.Target, key)
+
+		batch.Reset()
+		enc := json.NewEncoder(&batch)
+		enc.SetEscapeHTML(false)
+		enc.Encode(act) // Encode appends the newline _bulk requires
+		enc.Encode(doc)
+
+		r.pbar.ClearLine()
+		bufw.Write(batch.Bytes())
+		bufw.Flush()
+		if r.bulk != nil {
+			r.bulk.add(ctx, batch.Bytes())
+		}
+		atomic.AddInt64(&r.found, 1)
+		r.renderProgress(pagesCompleted)
+	}
+	r.finishOutput(bufw)
+	if r.bulk != nil {
+		// Each target's batch is sent when it ends, even if interrupted.
+		r.bulk.flush(ctx)
+	}
+}
+
+// bulkPoster POSTs _bulk NDJSON to --es-url in batches of --es-batch
+// documents. It is used by the printer goroutine only.
+type bulkPoster struct {
+	url     string // the _bulk endpoint
+	hc      *http.Client
+	retries int
+	size    int // documents per request
+	logf    func(level logLevel, format string, a ...any)
+
+	buf     bytes.Buffer
+	pending int
+	indexed int // documents the cluster accepted
+	failed  int // documents rejected, or in batches that could not be sent
+}
+
+// bulkURL returns the _bulk endpoint for --es-url: a cluster or index URL
+// gets /_bulk appended; one already ending in /_bulk is used as is.
+// Credentials in the URL are sent as basic auth.
+func bulkURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%q is not an http(s) URL", raw)
+	}
+	if !strings.HasSuffix(u.Path, "/_bulk") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/_bulk"
+		u.RawPath = ""
+	}
+	return u.String(), nil
+}
+
+// add queues one action and document pair, sending the batch once it is
+// full.
+func (p *bulkPoster) add(ctx context.Context, lines []byte) {
+	p.buf.Write(lines)
+	if p.pending++; p.pending >= p.size {
+		p.flush(ctx)
+	}
+}
+
+// flush sends the queued documents. A batch that still fails after every
+// retry is counted as failed and dropped; the NDJSON output keeps a copy.
+// Once ctx is cancelled, the batch gets bulkGrace more.
+func (p *bulkPoster) flush(ctx context.Context) {
+	if p.pending == 0 {
+		return
+	}
+	n := p.pending
+	postCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	defer context.AfterFunc(ctx, func() { time.AfterFunc(bulkGrace, cancel) })()
+	rejected, err := p.post(postCtx, p.buf.Bytes())
+	p.buf.Reset()
+	p.pending = 0
+	if err != nil {
+		p.failed += n
+		p.logf(levelError, "bulk request to %s failed, %d document(s) not indexed: %v", redactURL(p.url), n, err)
+		return
+	}
+	p.indexed += n - rejected
+	p.failed += rejected
+}
+
+// bulkResponse is the part of a _bulk reply needed to find rejected items.
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// post sends one _bulk request, making up to retries attempts with the same
+// back-off as CDX requests (cdx.NextRetry): 429 and 5xx wait for Retry-After
+// (or 1s, 4s, 9s, ...), other 4xx fail fast, and network errors are retried
+// after 1s, 2s, .... It returns how many documents the cluster rejected.
+func (p *bulkPoster) post(ctx context.Context, body []byte) (rejected int, err error) {
+	var lastErr error
+	for attempt := 1; attempt <= max(p.retries, 1); attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+		if err != nil {
+			return 0, err // non-retryable
+		}
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		req.Header.Set("User-Agent", cdx.DefaultUserAgent)
+
+		resp, err := p.hc.Do(req)
+		if err == nil && resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+			var br bulkResponse
+			err := json.NewDecoder(resp.Body).Decode(&br)
+			resp.Body.Close()
+			if err != nil || !br.Errors {
+				return 0, nil // accepted; a reply without item detail is trusted
+			}
+			return p.rejected(br), nil
+		}
+		lastErr = err
+		if err == nil {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			resp.Body.Close()
+			lastErr = fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(sanitizeForTerminal(string(msg))))
+		}
+
+		backoff, shared, retry := cdx.NextRetry(resp, attempt)
+		switch {
+		case !retry:
+			return 0, lastErr
+		case attempt >= p.retries:
+			continue
+		case shared:
+			p.logf(levelWarn, "HTTP %d on bulk request; backing off %s (attempt %d/%d)",
+				resp.StatusCode, backoff, attempt, p.retries)
+		default:
+			p.logf(levelWarn, "retrying bulk request (attempt %d/%d): %v", attempt, p.retries, lastErr)
+		}
+		if !cdx.Sleep(ctx, backoff) {
+			return 0, ctx.Err()
+		}
+	}
+	return 0, lastErr
+}
+
+// rejected counts the items of br that failed and reports the first reason.
+func (p *bulkPoster) rejected(br bulkResponse) int {
+	n := 0
+	var first string
+	for _, item := range br.Items {
+		for _, res := range item {
+			if res.Error == nil && res.Status < 300 {
+				continue
+			}
+			if n++; first == "" && res.Error != nil {
+				first = sanitizeForTerminal(res.Error.Type + ": " + res.Error.Reason)
+			}
+		}
+	}
+	if n > 0 {
+		p.logf(levelWarn, "%d document(s) rejected by %s; first error: %s", n, redactURL(p.url), first)
+	}
+	return n
+}
+
+// report logs what the run sent to --es-url and returns it for the summary.
+func (p *bulkPoster) report() *bulkSummary {
+	if p.failed > 0 {
+		p.logf(levelError, "indexed %d document(s); %d were not indexed", p.indexed, p.failed)
+	} else {
+		p.logf(levelInfo, "indexed %d document(s) to %s", p.indexed, redactURL(p.url))
+	}
+	return &bulkSummary{Indexed: p.indexed, Failed: p.failed}
+}
+
+// redactURL hides the password of a URL for logging.
+func redactURL(s string) string {
+	if u, err := url.Parse(s); err == nil {
+		return u.Redacted()
+	}
+	return s
+}
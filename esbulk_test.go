@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBulkURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+		err      bool
+	}{
+		{"http://localhost:9200", "http://localhost:9200/_bulk", false},
+		{"https://es.internal:9200/", "https://es.internal:9200/_bulk", false},
+		{"http://localhost:9200/recon", "http://localhost:9200/recon/_bulk", false},
+		{"http://u:p@localhost:9200/_bulk", "http://u:p@localhost:9200/_bulk", false},
+		{"localhost:9200", "", true},
+		{"ftp://es/", "", true},
+	}
+	for _, tt := range tests {
+		got, err := bulkURL(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("bulkURL(%q) = %q, %v; want %q, err %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestESDocID(t *testing.T) {
+	a := esDocID("example.com", "http://example.com/a")
+	if a != esDocID("example.com", "http://example.com/a") {
+		t.Error("esDocID is not deterministic")
+	}
+	if a == esDocID("example.org", "http://example.com/a") {
+		t.Error("esDocID ignores the target")
+	}
+}
+
+// bulkStandIn is a local stand-in for a cluster's _bulk API. Each request is
+// answered by the next status in statuses (200 once they run out); a 200
+// reply marks the documents whose URL contains "reject" as failed.
+type bulkStandIn struct {
+	mu       sync.Mutex
+	statuses []int
+	requests int
+	docs     []esDoc
+}
+
+func (b *bulkStandIn) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.requests++
+	if req.URL.Path != "/_bulk" || req.Header.Get("Content-Type") != "application/x-ndjson" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if len(b.statuses) > 0 {
+		st := b.statuses[0]
+		b.statuses = b.statuses[1:]
+		if st != http.StatusOK {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "busy", st)
+			return
+		}
+	}
+	body, _ := io.ReadAll(req.Body)
+	lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+	var items []string
+	failed := false
+	for i := 1; i < len(lines); i += 2 {
+		var doc esDoc
+		json.Unmarshal([]byte(lines[i]), &doc)
+		b.docs = append(b.docs, doc)
+		if strings.Contains(doc.URL, "reject") {
+			failed = true
+			items = append(items, `{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"bad"}}}`)
+		} else {
+			items = append(items, `{"index":{"status":201}}`)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmtBool := map[bool]string{true: "true", false: "false"}
+	io.WriteString(w, `{"errors":`+fmtBool[failed]+`,"items":[`+strings.Join(items, ",")+`]}`)
+}
+
+func bulkPair(url string) []byte {
+	return []byte(`{"index":{"_index":"t","_id":"x"}}` + "\n" + `{"url":"` + url + `"}` + "\n")
+}
+
+func TestBulkPoster(t *testing.T) {
+	stand := &bulkStandIn{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	srv := httptest.NewServer(stand)
+	defer srv.Close()
+
+	var warnings atomic.Int32
+	p := &bulkPoster{url: srv.URL + "/_bulk", hc: srv.Client(), retries: 3, size: 2,
+		logf: func(level logLevel, format string, a ...any) {
+			if level == levelWarn {
+				warnings.Add(1)
+			}
+		}}
+	p.add(context.Background(), bulkPair("http://example.com/a"))
+	p.add(context.Background(), bulkPair("http://example.com/reject")) // full: sent, after two retries
+	p.add(context.Background(), bulkPair("http://example.com/b"))
+	p.flush(context.Background())
+
+	if stand.requests != 4 {
+		t.Errorf("requests = %d, want 4 (503, 429, then two batches)", stand.requests)
+	}
+	if p.indexed != 2 || p.failed != 1 {
+		t.Errorf("indexed %d, failed %d; want 2, 1", p.indexed, p.failed)
+	}
+	if warnings.Load() != 3 {
+		t.Errorf("warnings = %d, want 3 (two back-offs, one rejection)", warnings.Load())
+	}
+}
+
+func TestBulkPosterFailsFast(t *testing.T) {
+	stand := &bulkStandIn{statuses: []int{http.StatusUnauthorized}}
+	srv := httptest.NewServer(stand)
+	defer srv.Close()
+
+	p := &bulkPoster{url: srv.URL + "/_bulk", hc: srv.Client(), retries: 3, size: 10,
+		logf: func(logLevel, string, ...any) {}}
+	if _, err := p.post(context.Background(), bulkPair("http://example.com/a")); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("post error = %v, want HTTP 401", err)
+	}
+	if stand.requests != 1 {
+		t.Errorf("requests = %d, want 1: a 4xx is not retried", stand.requests)
+	}
+}
+
+func TestBulkPosterGivesUp(t *testing.T) {
+	stand := &bulkStandIn{statuses: []int{502, 502, 502}}
+	srv := httptest.NewServer(stand)
+	defer srv.Close()
+
+	p := &bulkPoster{url: srv.URL + "/_bulk", hc: srv.Client(), retries: 3, size: 10,
+		logf: func(logLevel, string, ...any) {}}
+	p.add(context.Background(), bulkPair("http://example.com/a"))
+	p.flush(context.Background())
+	if stand.requests != 3 || p.failed != 1 || p.indexed != 0 {
+		t.Errorf("requests %d, failed %d, indexed %d; want 3, 1, 0", stand.requests, p.failed, p.indexed)
+	}
+	if p.pending != 0 || p.buf.Len() != 0 {
+		t.Error("failed batch left queued")
+	}
+}
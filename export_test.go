@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
+)
+
+func exportRecords() []cdx.Record {
+	return []cdx.Record{
+		{Original: "https://example.com/search?q=a%20b&page=2", Timestamp: "20210304050607", StatusCode: "200", MimeType: "application/json"},
+		{Original: "http://example.com/</item>", Timestamp: "20200101000000", StatusCode: "-", MimeType: "text/html"},
+		{Original: "ftp://example.com/file", Timestamp: "20200101000000"},
+	}
+}
+
+func TestHARDocument(t *testing.T) {
+	d := newHARDoc(true)
+	for _, rec := range exportRecords() {
+		d.add(rec)
+	}
+	var buf bytes.Buffer
+	if err := d.write(&buf); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var log harLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, buf.String())
+	}
+	if log.Log.Version != "1.2" || len(log.Log.Entries) != 3 {
+		t.Fatalf("version %q, %d entries; want 1.2, 3", log.Log.Version, len(log.Log.Entries))
+	}
+	// Sorted by URL: ftp, http, https.
+	e := log.Log.Entries[2]
+	if e.Request.URL != "https://example.com/search?q=a%20b&page=2" || e.Request.Method != "GET" {
+		t.Errorf("request = %+v", e.Request)
+	}
+	want := []harNV{{"q", "a b"}, {"page", "2"}}
+	if len(e.Request.QueryString) != 2 || e.Request.QueryString[0] != want[0] || e.Request.QueryString[1] != want[1] {
+		t.Errorf("queryString = %v, want %v", e.Request.QueryString, want)
+	}
+	if e.Response.Status != 200 || e.Response.Content.MimeType != "application/json" || e.Response.BodySize != -1 {
+		t.Errorf("response = %+v", e.Response)
+	}
+	if e.StartedDateTime != "2021-03-04T05:06:07Z" {
+		t.Errorf("startedDateTime = %q", e.StartedDateTime)
+	}
+	if !strings.Contains(e.Comment, "web.archive.org/web/20210304050607/") {
+		t.Errorf("comment = %q, want the snapshot link", e.Comment)
+	}
+	if got := log.Log.Entries[1].Response.Status; got != 0 {
+		t.Errorf("status of a capture without one = %d, want 0", got)
+	}
+}
+
+func TestBurpDocument(t *testing.T) {
+	d := newBurpDoc(false)
+	for _, rec := range exportRecords() {
+		d.add(rec)
+	}
+	var buf bytes.Buffer
+	if err := d.write(&buf); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "<?xml") {
+		t.Errorf("missing XML declaration:\n%s", buf.String())
+	}
+	var doc burpItems
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not XML: %v\n%s", err, buf.String())
+	}
+	if len(doc.Items) != 2 {
+		t.Fatalf("%d items, want 2 (ftp skipped)", len(doc.Items))
+	}
+	it := doc.Items[0]
+	if it.URL != "http://example.com/</item>" || it.Port != "80" || it.Status != "" || it.Response.Data != "" {
+		t.Errorf("item without status = %+v", it)
+	}
+	it = doc.Items[1]
+	if it.Host.Name != "example.com" || it.Port != "443" || it.Protocol != "https" || it.Path != "/search?q=a%20b&page=2" {
+		t.Errorf("item = %+v", it)
+	}
+	if it.Status != "200" || it.MimeType != "JSON" {
+		t.Errorf("status %q, mimetype %q; want 200, JSON", it.Status, it.MimeType)
+	}
+	req, err := base64.StdEncoding.DecodeString(it.Request.Data)
+	if err != nil || string(req) != "GET /search?q=a%20b&page=2 HTTP/1.1\r\nHost: example.com\r\n\r\n" {
+		t.Errorf("request = %q, %v", req, err)
+	}
+	resp, err := base64.StdEncoding.DecodeString(it.Response.Data)
+	if err != nil || !strings.HasPrefix(string(resp), "HTTP/1.1 200 \r\nContent-Type: application/json\r\n") {
+		t.Errorf("response = %q, %v", resp, err)
+	}
+}
+
+func TestBurpMimeType(t *testing.T) {
+	tests := map[string]string{
+		"text/html; charset=utf-8": "HTML",
+		"application/javascript":   "script",
+		"image/png":                "PNG",
+		"image/svg+xml":            "XML",
+		"text/plain":               "text",
+		"application/octet-stream": "",
+		"":                         "",
+	}
+	for in, want := range tests {
+		if got := burpMimeType(in); got != want {
+			t.Errorf("burpMimeType(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// exitIncomplete is the exit status of a run that finished but could not
+// fetch everything: some pages (or whole targets) still failed after the
+// retry pass. It differs from the generic failure status 1 and from the flag
+// package's usage status 2, so scripts can tell a partial dataset apart.
+const exitIncomplete = 3
+
+// errIncomplete is returned (wrapped) by Run when results are partial.
+var errIncomplete = errors.New("results are incomplete")
+
+// firstBatchKey stands in for the resume key of a cursor walk's first batch,
+// which has none, so that its failure is still told apart from a failed target.
+const firstBatchKey = "(first batch)"
+
+// failure is one unit of work that could not be fetched, as written to the
+// --failed-report file (one JSON object per line).
+type failure struct {
+	Target    string `json:"target"`
+	Page      int    `json:"page"`                 // -1 when the whole target (or cursor walk) failed
+	ResumeKey string `json:"resume_key,omitempty"` // cursor batch that failed (--cursor mode); firstBatchKey for the first
+	Error     string `json:"error"`
+}
+
+// recordFailure notes work that is still missing after every retry.
+func (r *Runner) recordFailure(target string, page int, resumeKey string, err error) {
+	r.failuresMu.Lock()
+	defer r.failuresMu.Unlock()
+	r.failures = append(r.failures, failure{Target: target, Page: page, ResumeKey: resumeKey, Error: err.Error()})
+}
+
+// describeFailures counts fs by kind for messages, e.g. "1 target(s) and
+// 3 page(s)": whole targets, cursor batches, and pages.
+func describeFailures(fs []failure) string {
+	var targets, batches, pages int
+	for _, f := range fs {
+		switch {
+		case f.ResumeKey != "":
+			batches++
+		case f.Page < 0:
+			targets++
+		default:
+			pages++
+		}
+	}
+	var parts []string
+	for _, c := range []struct {
+		n    int
+		unit string
+	}{{targets, "target(s)"}, {batches, "cursor batch(es)"}, {pages, "page(s)"}} {
+		if c.n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", c.n, c.unit))
+		}
+	}
+	if len(parts) > 1 {
+		return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+	}
+	return strings.Join(parts, "")
+}
+
+// reportFailures tells the user what is missing: in the --failed-report file
+// when set, otherwise one log line per failure. It returns describeFailures of
+// the failures, "" when there are none.
+func (r *Runner) reportFailures() string {
+	r.failuresMu.Lock()
+	defer r.failuresMu.Unlock()
+	if len(r.failures) == 0 {
+		return ""
+	}
+	sort.SliceStable(r.failures, func(i, j int) bool {
+		a, b := r.failures[i], r.failures[j]
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		return a.Page < b.Page
+	})
+	desc := describeFailures(r.failures)
+
+	if path := r.cfg.FailedReport; path != "" {
+		if err := writeFailures(path, r.failures); err != nil {
+			r.log.errf("write failed-page report: %v", err)
+		} else {
+			r.log.errf("%s could not be fetched; results are incomplete (see %s)", desc, path)
+			return desc
+		}
+	}
+	r.log.errf("%s could not be fetched; results are incomplete:", desc)
+	for _, f := range r.failures {
+		if f.ResumeKey != "" {
+			r.log.errf("  %s batch %s: %s", f.Target, f.ResumeKey, f.Error)
+			continue
+		}
+		if f.Page < 0 {
+			r.log.errf("  %s: %s", f.Target, f.Error)
+			continue
+		}
+		r.log.errf("  %s page %d: %s", f.Target, f.Page, f.Error)
+	}
+	return desc
+}
+
+// writeFailures writes fs to path as JSONL.
+func writeFailures(path string, fs []failure) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, fl := range fs {
+		if err := enc.Encode(fl); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return f.Close()
+}
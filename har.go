@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
+)
+
+// capture is one archived URL as the proxy-export documents (--har, --burp)
+// describe it. Values are sanitized; the archive's metadata stands in for a
+// response that was never requested.
+type capture struct {
+	URL      string
+	Time     time.Time // capture time; zero if the timestamp did not parse
+	Status   int       // 0 when the archive recorded none
+	Mime     string
+	Snapshot string // Wayback snapshot link, if any
+}
+
+// captureList collects captures for a proxy-export document. Safe for
+// concurrent use.
+type captureList struct {
+	links bool // record Wayback snapshot links
+
+	mu    sync.Mutex
+	items []capture
+}
+
+func (l *captureList) add(rec cdx.Record) {
+	c := capture{
+		URL:  sanitizeForTerminal(rec.Original),
+		Mime: sanitizeForTerminal(rec.MimeType),
+	}
+	if t, err := rec.Time(); err == nil {
+		c.Time = t
+	}
+	if n, err := strconv.Atoi(rec.StatusCode); err == nil && n >= 100 && n <= 999 {
+		c.Status = n
+	}
+	if l.links && rec.Timestamp != "" {
+		c.Snapshot = sanitizeForTerminal(rec.SnapshotURL())
+	}
+	l.mu.Lock()
+	l.items = append(l.items, c)
+	l.mu.Unlock()
+}
+
+// sorted returns the captures ordered by URL, then time, so output does not
+// depend on the order concurrent workers delivered them in.
+func (l *captureList) sorted() []capture {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := append([]capture(nil), l.items...)
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].URL != out[j].URL {
+			return out[i].URL < out[j].URL
+		}
+		return out[i].Time.Before(out[j].Time)
+	})
+	return out
+}
+
+// comment describes where a synthetic entry came from.
+func (c capture) comment() string {
+	s := "gowaybackgo: archived capture, not live traffic"
+	if c.Snapshot != "" {
+		s += "; snapshot " + c.Snapshot
+	}
+	return s
+}
+
+// harDoc writes captures as an HTTP Archive (HAR 1.2) log for --har: one entry
+// per URL, with the archived status and MIME type as the recorded response.
+type harDoc struct{ captureList }
+
+// HAR 1.2 types; only the members the format requires plus a few optional
+// ones.
+type (
+	harLog struct {
+		Log harBody `json:"log"`
+	}
+	harBody struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	}
+	harCreator struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	harEntry struct {
+		StartedDateTime string      `json:"startedDateTime"`
+		Time            int         `json:"time"`
+		Request         harRequest  `json:"request"`
+		Response        harResponse `json:"response"`
+		Cache           struct{}    `json:"cache"`
+		Timings         harTimings  `json:"timings"`
+		Comment         string      `json:"comment,omitempty"`
+	}
+	harRequest struct {
+		Method      string  `json:"method"`
+		URL         string  `json:"url"`
+		HTTPVersion string  `json:"httpVersion"`
+		Cookies     []harNV `json:"cookies"`
+		Headers     []harNV `json:"headers"`
+		QueryString []harNV `json:"queryString"`
+		HeadersSize int     `json:"headersSize"`
+		BodySize    int     `json:"bodySize"`
+	}
+	harResponse struct {
+		Status      int        `json:"status"`
+		StatusText  string     `json:"statusText"`
+		HTTPVersion string     `json:"httpVersion"`
+		Cookies     []harNV    `json:"cookies"`
+		Headers     []harNV    `json:"headers"`
+		Content     harContent `json:"content"`
+		RedirectURL string     `json:"redirectURL"`
+		HeadersSize int        `json:"headersSize"`
+		BodySize    int        `json:"bodySize"`
+	}
+	harNV struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	harContent struct {
+		Size     int    `json:"size"`
+		MimeType string `json:"mimeType"`
+	}
+	harTimings struct {
+		Send    int `json:"send"`
+		Wait    int `json:"wait"`
+		Receive int `json:"receive"`
+	}
+)
+
+func newHARDoc(links bool) *harDoc {
+	return &harDoc{captureList{links: links}}
+}
+
+func (d *harDoc) write(w io.Writer) error {
+	log := harLog{Log: harBody{
+		Version: "1.2",
+		Creator: harCreator{Name: "gowaybackgo", Version: appVersion()},
+		Entries: []harEntry{},
+	}}
+	for _, c := range d.sorted() {
+		log.Log.Entries = append(log.Log.Entries, harEntryOf(c))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
+
+// harEntryOf builds the HAR entry of c. Sizes the archive does not report are
+// -1, as HAR specifies for unknown values.
+func harEntryOf(c capture) harEntry {
+	e := harEntry{
+		Request: harRequest{
+			Method:      "GET",
+			URL:         c.URL,
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNV{},
+			Headers:     []harNV{},
+			QueryString: []harNV{},
+			HeadersSize: -1,
+			BodySize:    0,
+		},
+		Response: harResponse{
+			Status:      c.Status,
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNV{},
+			Headers:     []harNV{},
+			Content:     harContent{Size: -1, MimeType: c.Mime},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		StartedDateTime: c.Time.Format(time.RFC3339), // required; year 1 if unknown
+		Comment:         c.comment(),
+	}
+	if u, err := url.Parse(c.URL); err == nil {
+		e.Request.Headers = append(e.Request.Headers, harNV{Name: "Host", Value: u.Host})
+		for _, kv := range strings.Split(u.RawQuery, "&") {
+			if kv == "" {
+				continue
+			}
+			k, v, _ := strings.Cut(kv, "=")
+			if uk, err := url.QueryUnescape(k); err == nil {
+				k = uk
+			}
+			if uv, err := url.QueryUnescape(v); err == nil {
+				v = uv
+			}
+			e.Request.QueryString = append(e.Request.QueryString, harNV{Name: sanitizeForTerminal(k), Value: sanitizeForTerminal(v)})
+		}
+	}
+	if c.Mime != "" {
+		e.Response.Headers = append(e.Response.Headers, harNV{Name: "Content-Type", Value: c.Mime})
+	}
+	return e
+}
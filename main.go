@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -73,6 +74,9 @@ func main() {
 
 	if err := runner.Run(ctx); err != nil {
 		// Run already reported the failure(s) via its logger; just set the code.
+		if errors.Is(err, errIncomplete) {
+			os.Exit(exitIncomplete)
+		}
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
+)
+
+// Kinds of path segment told apart by segmentKind. Anything but segStatic is
+// a value (an ID, a key) rather than part of the route.
+const (
+	segStatic = ""
+	segInt    = "int"
+	segUUID   = "uuid"
+	segHash   = "hash"
+)
+
+var (
+	uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hashRe = regexp.MustCompile(`^[0-9a-fA-F]{16,128}$`)
+)
+
+// segmentKind classifies one (unescaped) path segment: all digits, a UUID, a
+// long hex string such as a hash or object ID, or static text.
+func segmentKind(seg string) string {
+	switch {
+	case seg == "":
+		return segStatic
+	case strings.Trim(seg, "0123456789") == "":
+		return segInt
+	case uuidRe.MatchString(seg):
+		return segUUID
+	case hashRe.MatchString(seg):
+		return segHash
+	}
+	return segStatic
+}
+
+// openAPIDoc infers an OpenAPI 3 skeleton from archived URLs (--openapi):
+// URLs are grouped into endpoint templates by replacing variable path
+// segments with parameters, and the query parameters seen for each endpoint
+// are typed from their observed values. Safe for concurrent use.
+type openAPIDoc struct {
+	targets []string
+
+	mu        sync.Mutex
+	servers   map[string]bool
+	endpoints map[string]*oaEndpoint // by path template
+	captures  int
+}
+
+// oaEndpoint accumulates what was seen for one path template.
+type oaEndpoint struct {
+	pathParams []oaParameter
+	query      map[string]*paramStats
+	statuses   map[string]string // status code -> a MIME type seen with it
+	captures   int
+}
+
+// paramStats infers a parameter's type from the values observed for it.
+type paramStats struct {
+	seen                    int
+	notInt, notNum, notBool bool
+	notUUID                 bool
+	example                 string
+}
+
+func (p *paramStats) observe(v string) {
+	if v == "" {
+		return
+	}
+	if p.seen == 0 {
+		p.example = v
+	}
+	p.seen++
+	if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+		p.notInt = true
+	}
+	if _, err := strconv.ParseFloat(v, 64); err != nil {
+		p.notNum = true
+	}
+	if v != "true" && v != "false" {
+		p.notBool = true
+	}
+	if !uuidRe.MatchString(v) {
+		p.notUUID = true
+	}
+}
+
+// schema returns the narrowest type every observed value fits, with the
+// first value as a typed example.
+func (p *paramStats) schema() (oaSchema, any) {
+	switch {
+	case p.seen == 0:
+		return oaSchema{Type: "string"}, nil
+	case !p.notInt:
+		n, _ := strconv.ParseInt(p.example, 10, 64)
+		return oaSchema{Type: "integer"}, n
+	case !p.notNum:
+		f, _ := strconv.ParseFloat(p.example, 64)
+		return oaSchema{Type: "number"}, f
+	case !p.notBool:
+		return oaSchema{Type: "boolean"}, p.example == "true"
+	case !p.notUUID:
+		return oaSchema{Type: "string", Format: "uuid"}, p.example
+	}
+	return oaSchema{Type: "string"}, p.example
+}
+
+// OpenAPI document types; only what the skeleton uses.
+type (
+	oaDocument struct {
+		OpenAPI string                `json:"openapi"`
+		Info    oaInfo                `json:"info"`
+		Servers []oaServer            `json:"servers,omitempty"`
+		Paths   map[string]oaPathItem `json:"paths"`
+	}
+	oaInfo struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Version     string `json:"version"`
+	}
+	oaServer struct {
+		URL string `json:"url"`
+	}
+	oaPathItem struct {
+		Get oaOperation `json:"get"`
+	}
+	oaOperation struct {
+		Parameters []oaParameter         `json:"parameters,omitempty"`
+		Responses  map[string]oaResponse `json:"responses"`
+		Captures   int                   `json:"x-archived-captures"`
+	}
+	oaParameter struct {
+		Name     string   `json:"name"`
+		In       string   `json:"in"`
+		Required bool     `json:"required,omitempty"`
+		Schema   oaSchema `json:"schema"`
+		Example  any      `json:"example,omitempty"`
+	}
+	oaSchema struct {
+		Type    string `json:"type"`
+		Format  string `json:"format,omitempty"`
+		Pattern string `json:"pattern,omitempty"`
+	}
+	oaResponse struct {
+		Description string `json:"description"`
+	}
+)
+
+func newOpenAPIDoc(targets []string) *openAPIDoc {
+	return &openAPIDoc{
+		targets:   targets,
+		servers:   make(map[string]bool),
+		endpoints: make(map[string]*oaEndpoint),
+	}
+}
+
+// pathTemplate turns an escaped URL path into an OpenAPI path template and
+// its path parameters. Variable segments are named after their kind, numbered
+// when a path has several of one kind: /users/42/posts/7 becomes
+// /users/{id}/posts/{id2}.
+func pathTemplate(escaped string) (string, []oaParameter) {
+	escaped = strings.TrimSuffix(escaped, "/")
+	if escaped == "" {
+		return "/", nil
+	}
+	segs := strings.Split(strings.TrimPrefix(escaped, "/"), "/")
+	var params []oaParameter
+	used := map[string]int{}
+	for i, seg := range segs {
+		raw, err := url.PathUnescape(seg)
+		if err != nil {
+			raw = seg
+		}
+		kind := segmentKind(raw)
+		if kind == segStatic {
+			// Braces would read as template syntax.
+			segs[i] = strings.NewReplacer("{", "%7B", "}", "%7D").Replace(seg)
+			continue
+		}
+		name := map[string]string{segInt: "id", segUUID: "uuid", segHash: "hash"}[kind]
+		if used[name]++; used[name] > 1 {
+			name += strconv.Itoa(used[name])
+		}
+		segs[i] = "{" + name + "}"
+		p := oaParameter{Name: name, In: "path", Required: true, Example: raw}
+		switch kind {
+		case segInt:
+			p.Schema = oaSchema{Type: "integer"}
+			if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+				p.Example = n
+			}
+		case segUUID:
+			p.Schema = oaSchema{Type: "string", Format: "uuid"}
+		case segHash:
+			p.Schema = oaSchema{Type: "string", Pattern: "^[0-9a-fA-F]+$"}
+		}
+		params = append(params, p)
+	}
+	return "/" + strings.Join(segs, "/"), params
+}
+
+func (d *openAPIDoc) add(rec cdx.Record) {
+	u, err := url.Parse(rec.Original)
+	if err != nil || u.Host == "" {
+		return
+	}
+	tmpl, params := pathTemplate(sanitizeForTerminal(u.EscapedPath()))
+	server := sanitizeForTerminal(strings.ToLower(u.Scheme + "://" + u.Host))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.captures++
+	d.servers[server] = true
+	ep := d.endpoints[tmpl]
+	if ep == nil {
+		ep = &oaEndpoint{pathParams: params, query: make(map[string]*paramStats), statuses: make(map[string]string)}
+		d.endpoints[tmpl] = ep
+	}
+	ep.captures++
+	for k, vs := range u.Query() {
+		k = sanitizeForTerminal(k)
+		if k == "" {
+			continue
+		}
+		ps := ep.query[k]
+		if ps == nil {
+			ps = &paramStats{}
+			ep.query[k] = ps
+		}
+		for _, v := range vs {
+			ps.observe(sanitizeForTerminal(v))
+		}
+	}
+	if st := rec.StatusCode; len(st) == 3 && segmentKind(st) == segInt {
+		if _, ok := ep.statuses[st]; !ok {
+			ep.statuses[st] = sanitizeForTerminal(rec.MimeType)
+		}
+	}
+}
+
+// build assembles the OpenAPI document. Caller holds d.mu.
+func (d *openAPIDoc) build() oaDocument {
+	doc := oaDocument{
+		OpenAPI: "3.0.3",
+		Info: oaInfo{
+			Title: "Archived API of " + sanitizeForTerminal(strings.Join(d.targets, ", ")),
+			Description: fmt.Sprintf("Skeleton inferred by gowaybackgo %s from %d archived URLs. "+
+				"Endpoints, parameters, and types reflect what web archives captured, not a published contract.",
+				appVersion(), d.captures),
+			Version: time.Now().UTC().Format(time.DateOnly),
+		},
+		Paths: make(map[string]oaPathItem, len(d.endpoints)),
+	}
+	for s := range d.servers {
+		doc.Servers = append(doc.Servers, oaServer{URL: s})
+	}
+	sort.Slice(doc.Servers, func(i, j int) bool { return doc.Servers[i].URL < doc.Servers[j].URL })
+
+	for tmpl, ep := range d.endpoints {
+		op := oaOperation{
+			Parameters: append([]oaParameter(nil), ep.pathParams...),
+			Responses:  make(map[string]oaResponse),
+			Captures:   ep.captures,
+		}
+		names := make([]string, 0, len(ep.query))
+		for k := range ep.query {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			schema, example := ep.query[k].schema()
+			op.Parameters = append(op.Parameters, oaParameter{Name: k, In: "query", Schema: schema, Example: example})
+		}
+		for st, mime := range ep.statuses {
+			desc := "Archived capture returned " + st
+			if mime != "" {
+				desc += " (" + mime + ")"
+			}
+			op.Responses[st] = oaResponse{Description: desc}
+		}
+		if len(op.Responses) == 0 {
+			op.Responses["default"] = oaResponse{Description: "No status recorded by the archive"}
+		}
+		doc.Paths[tmpl] = oaPathItem{Get: op}
+	}
+	return doc
+}
+
+func (d *openAPIDoc) write(w io.Writer) error {
+	d.mu.Lock()
+	doc := d.build()
+	d.mu.Unlock()
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
+)
+
+func TestSegmentKind(t *testing.T) {
+	tests := map[string]string{
+		"":                                     segStatic,
+		"users":                                segStatic,
+		"v1":                                   segStatic,
+		"42":                                   segInt,
+		"0007":                                 segInt,
+		"3f2504e0-4f89-11d3-9a0c-0305e82c3301": segUUID,
+		"d41d8cd98f00b204e9800998ecf8427e":     segHash,
+		"deadbeef":                             segStatic, // too short for a hash
+		"cafe":                                 segStatic,
+	}
+	for in, want := range tests {
+		if got := segmentKind(in); got != want {
+			t.Errorf("segmentKind(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestPathTemplate(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   string
+		params []string
+	}{
+		{"", "/", nil},
+		{"/", "/", nil},
+		{"/api/v1/users/", "/api/v1/users", nil},
+		{"/api/users/42", "/api/users/{id}", []string{"id"}},
+		{"/users/42/posts/7", "/users/{id}/posts/{id2}", []string{"id", "id2"}},
+		{"/o/3f2504e0-4f89-11d3-9a0c-0305e82c3301/f/d41d8cd98f00b204e9800998ecf8427e", "/o/{uuid}/f/{hash}", []string{"uuid", "hash"}},
+		{"/a%7Bb%7D/x", "/a%7Bb%7D/x", nil},
+	}
+	for _, tt := range tests {
+		got, params := pathTemplate(tt.in)
+		var names []string
+		for _, p := range params {
+			names = append(names, p.Name)
+			if p.In != "path" || !p.Required {
+				t.Errorf("pathTemplate(%q): param %+v not a required path param", tt.in, p)
+			}
+		}
+		if got != tt.want || !reflect.DeepEqual(names, tt.params) {
+			t.Errorf("pathTemplate(%q) = %q %v, want %q %v", tt.in, got, names, tt.want, tt.params)
+		}
+	}
+}
+
+func TestParamStatsSchema(t *testing.T) {
+	tests := []struct {
+		values      []string
+		wantType    string
+		wantFormat  string
+		wantExample any
+	}{
+		{nil, "string", "", nil},
+		{[]string{"1", "25", ""}, "integer", "", int64(1)},
+		{[]string{"1", "2.5"}, "number", "", 1.0},
+		{[]string{"true", "false"}, "boolean", "", true},
+		{[]string{"3f2504e0-4f89-11d3-9a0c-0305e82c3301"}, "string", "uuid", "3f2504e0-4f89-11d3-9a0c-0305e82c3301"},
+		{[]string{"7", "abc"}, "string", "", "7"},
+	}
+	for _, tt := range tests {
+		var p paramStats
+		for _, v := range tt.values {
+			p.observe(v)
+		}
+		s, ex := p.schema()
+		if s.Type != tt.wantType || s.Format != tt.wantFormat || ex != tt.wantExample {
+			t.Errorf("values %q: schema %+v example %#v, want %s/%s %#v", tt.values, s, ex, tt.wantType, tt.wantFormat, tt.wantExample)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	d := newOpenAPIDoc([]string{"example.com/api"})
+	for _, u := range []struct{ url, status string }{
+		{"https://example.com/api/users/1?fields=name&limit=10", "200"},
+		{"https://example.com/api/users/2?limit=20&debug=true", "404"},
+		{"http://example.com/api/search?q=x", ""},
+	} {
+		d.add(cdx.Record{Original: u.url, StatusCode: u.status, MimeType: "application/json"})
+	}
+	var buf bytes.Buffer
+	if err := d.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var doc oaDocument
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if doc.OpenAPI != "3.0.3" || len(doc.Servers) != 2 || len(doc.Paths) != 2 {
+		t.Fatalf("doc = %+v", doc)
+	}
+	users := doc.Paths["/api/users/{id}"].Get
+	if users.Captures != 2 || len(users.Responses) != 2 || users.Responses["404"].Description == "" {
+		t.Errorf("users operation = %+v", users)
+	}
+	var got []string
+	for _, p := range users.Parameters {
+		got = append(got, p.In+":"+p.Name+":"+p.Schema.Type)
+	}
+	want := []string{"path:id:integer", "query:debug:boolean", "query:fields:string", "query:limit:integer"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parameters = %v, want %v", got, want)
+	}
+	if _, ok := doc.Paths["/api/search"].Get.Responses["default"]; !ok {
+		t.Error("endpoint without a status should have a default response")
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// openOutput opens path as the output file, alongside stdout. With appendTo
+// (--append, --resume) the file is continued rather than truncated, and what
+// it already holds seeds dedup so only new results are written. With gz only
+// the file is compressed; stdout stays a plain stream.
+func (r *Runner) openOutput(path string, gz, appendTo bool) error {
+	var f *os.File
+	var err error
+	r.outAppend = appendTo
+	r.outStart = outputCounts{r.summary.Results, r.summary.Known}
+	r.headerDone = false // a CSV/TSV header per file
+	if appendTo {
+		f, r.known, err = openAppend(path, gz, r.outputKey)
+		if err != nil {
+			return fmt.Errorf("open output file: %w", err)
+		}
+		if r.cfg.Resume != "" {
+			r.log.info("resuming %s (%d results already written)", path, len(r.known))
+		} else {
+			r.log.info("appending to %s (%d results already there)", path, len(r.known))
+		}
+	} else if r.cfg.Checkpoint != "" {
+		// --resume continues the file under the name the checkpoint records,
+		// so it is written in place; the checkpoint tracks what is missing.
+		f, err = os.Create(path)
+		if err != nil {
+			return fmt.Errorf("create output file: %w", err)
+		}
+	} else {
+		// Results go to a temp file that only replaces path once the run is
+		// complete (see closeOutputAs).
+		f, err = os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+		if err != nil {
+			return fmt.Errorf("create output file: %w", err)
+		}
+		r.outTemp = f.Name()
+		f.Chmod(0o644) // CreateTemp's 0600 is too strict for a results file
+	}
+	r.outFile, r.outPath = f, path
+	var w io.Writer = f
+	if gz {
+		// Each checkpoint save ends a gzip member and a resumed run appends
+		// new ones; readers of the file see one continuous stream.
+		r.outGzip = gzip.NewWriter(f)
+		w = r.outGzip
+	}
+	r.outBase = r.outWriter
+	r.outWriter = io.MultiWriter(r.outBase, w)
+	return nil
+}
+
+// closeOutput closes the -o file at the end of the run, as complete only if
+// the run's status is ok, or incomplete only because --es-url fell short.
+// Safe to call when no output file is open.
+func (r *Runner) closeOutput() {
+	status := r.summary.Status
+	if status == statusIncomplete && !slices.ContainsFunc(r.summary.Targets, func(ts targetSummary) bool {
+		return ts.Status != statusOK && ts.Status != statusSkipped
+	}) {
+		status = statusOK
+	}
+	r.closeOutputAs(status, r.summary.Targets, r.notStarted())
+}
+
+// closeOutputAs closes the output file and reports where results were saved
+// (to stderr, so stdout stays a clean result stream): once at the end of the
+// run for -o, after each target for --output-dir. status says whether what it
+// holds is complete. A complete temp file is renamed into place; an incomplete
+// one is kept as <file>.partial, with a <file>.partial.incomplete.json sidecar
+// naming the targets and pages that are missing (in-place files get just the
+// sidecar). It returns the name the results were saved under.
+func (r *Runner) closeOutputAs(status string, targets []targetSummary, notStarted []string) string {
+	if r.outGzip != nil {
+		// Writes the end of the gzip stream; without it the file is truncated.
+		if err := r.outGzip.Close(); err != nil {
+			r.log.warn("error writing output: %v", err)
+		}
+		r.outGzip = nil
+	}
+	if r.outFile == nil {
+		return ""
+	}
+	if err := r.outFile.Close(); err != nil {
+		r.log.warn("error writing output: %v", err)
+	}
+	r.outFile = nil
+	r.outWriter = r.outBase
+	r.known = nil
+
+	complete := status == statusOK
+	saved := r.outPath
+	if tmp := r.outTemp; tmp != "" {
+		r.outTemp = ""
+		if !complete {
+			saved = r.outPath + partialSuffix
+		}
+		if err := os.Rename(tmp, saved); err != nil {
+			r.log.errf("save output: %v (results are in %s)", err, tmp)
+			return tmp
+		}
+	}
+	if complete {
+		removeStalePartial(r.outPath)
+	} else {
+		sidecar := saved + incompleteSuffix
+		if err := r.writeIncomplete(sidecar, saved, status, targets, notStarted); err != nil {
+			r.log.errf("write %s: %v", sidecar, err)
+		}
+		r.log.warn("results in %s are incomplete (%s); see %s", saved, status, sidecar)
+		return saved
+	}
+	if r.outAppend {
+		r.log.info("appended %d new results to %s (%d already there)",
+			r.summary.Results-r.outStart.results, saved, r.summary.Known-r.outStart.known)
+		return saved
+	}
+	r.log.info("saved results to %s", saved)
+	return saved
+}
+
+// syncOutput makes what the output file holds so far survive a crash: it ends
+// the current gzip member and starts the next (--resume keeps complete members
+// and drops only an unfinished last one), and syncs the file to disk. It must
+// not run while the printer writes.
+func (r *Runner) syncOutput() {
+	if r.outFile == nil {
+		return
+	}
+	if r.outGzip != nil {
+		if err := r.outGzip.Close(); err != nil {
+			r.log.warn("error writing output: %v", err)
+		}
+		r.outGzip.Reset(r.outFile)
+	}
+	if err := r.outFile.Sync(); err != nil {
+		r.log.warn("sync output: %v", err)
+	}
+}
+
+// outputCounts are the run's result counts when the output file was opened,
+// so closing it can report what it gained.
+type outputCounts struct{ results, known int64 }
+
+// writeFileAtomic replaces path with data via a temp file in the same
+// directory and a rename, so a crash mid-write never leaves it truncated.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// outputIndexName is the file in an --output-dir that maps targets to files.
+const outputIndexName = "index.json"
+
+// outputDir writes one output file per target for --output-dir, and keeps
+// the directory's index up to date after each target.
+type outputDir struct {
+	path  string // directory holding the files (with --mode-dirs, the mode's subfolder)
+	ext   string // file extension for the mode, with .gz when compressed
+	gz    bool
+	index outputIndex
+	files map[string]string // file name -> target, to keep names unique
+}
+
+// outputIndex is the --output-dir index file. Entries from earlier runs into
+// the same directory are kept, and updated when a target is run again.
+type outputIndex struct {
+	Mode    string             `json:"mode"`
+	Targets []outputIndexEntry `json:"targets"`
+}
+
+type outputIndexEntry struct {
+	Target  string    `json:"target"`
+	File    string    `json:"file"` // relative to the index
+	Results int64     `json:"results"`
+	Known   int64     `json:"known,omitempty"` // skipped, already in the file (--append)
+	Status  string    `json:"status"`          // as in --summary
+	Updated time.Time `json:"updated"`
+}
+
+// openOutputDir creates the --output-dir directory (and mode subfolder) and
+// loads the index a previous run left there.
+func openOutputDir(cfg *Config) (*outputDir, error) {
+	mode, ext := cfg.outputMode()
+	d := &outputDir{path: cfg.OutputDir, ext: ext, gz: cfg.Compress, files: make(map[string]string)}
+	if cfg.ModeDirs {
+		d.path = filepath.Join(d.path, mode)
+	}
+	if d.gz {
+		d.ext += ".gz"
+	}
+	if err := os.MkdirAll(d.path, 0o755); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(d.path, outputIndexName))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &d.index); err != nil {
+			return nil, fmt.Errorf("read %s: %w", filepath.Join(d.path, outputIndexName), err)
+		}
+	}
+	// Each target keeps its file across runs, so the files and the index's
+	// mode label stay right only while the mode and compression do.
+	if d.index.Mode != "" && d.index.Mode != mode {
+		return nil, fmt.Errorf("%s already holds %s output; write %s output to another --output-dir or use --mode-dirs", d.path, d.index.Mode, mode)
+	}
+	for _, e := range d.index.Targets {
+		if !strings.HasSuffix(strings.TrimSuffix(e.File, partialSuffix), d.ext) {
+			return nil, fmt.Errorf("%s already holds %s, not a %s file; keep --compress as in earlier runs or use another --output-dir", d.path, e.File, d.ext)
+		}
+		d.files[e.File] = e.Target
+	}
+	d.index.Mode = mode
+	return d, nil
+}
+
+// fileFor returns the file name of target: the same name every run, unique
+// within the directory.
+func (d *outputDir) fileFor(target string) string {
+	for _, e := range d.index.Targets {
+		if e.Target == target {
+			return strings.TrimSuffix(e.File, partialSuffix)
+		}
+	}
+	base := targetFileName(target)
+	name := base + d.ext
+	for n := 2; ; n++ {
+		if owner, ok := d.files[name]; !ok || owner == target {
+			break
+		}
+		name = fmt.Sprintf("%s-%d%s", base, n, d.ext)
+	}
+	d.files[name] = target
+	return name
+}
+
+// record adds or updates the index entry of ts and rewrites the index.
+func (d *outputDir) record(ts *targetSummary, file string) error {
+	e := outputIndexEntry{Target: ts.Target, File: file, Results: ts.Results, Known: ts.Known, Status: ts.Status, Updated: time.Now().UTC()}
+	i := sort.Search(len(d.index.Targets), func(i int) bool { return d.index.Targets[i].Target >= e.Target })
+	if i < len(d.index.Targets) && d.index.Targets[i].Target == e.Target {
+		d.index.Targets[i] = e
+	} else {
+		d.index.Targets = append(d.index.Targets, outputIndexEntry{})
+		copy(d.index.Targets[i+1:], d.index.Targets[i:])
+		d.index.Targets[i] = e
+	}
+	data, err := json.MarshalIndent(d.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(d.path, outputIndexName), append(data, '\n'))
+}
+
+// maxTargetFileName caps the length of a file name derived from a target, so
+// long URL patterns stay within file system limits.
+const maxTargetFileName = 100
+
+// targetFileName derives a safe file name (without extension) from a target
+// pattern: no scheme, a leading wildcard spelled out, and anything but
+// letters, digits, dots, and dashes replaced by underscores. Overlong names are
+// cut and suffixed with a hash of the target so they stay distinct.
+func targetFileName(target string) string {
+	s := strings.TrimSpace(target)
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+3:]
+	}
+	if rest, ok := strings.CutPrefix(s, "*."); ok {
+		s = "wildcard." + rest
+	}
+	var b strings.Builder
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-':
+			b.WriteRune(c)
+		default:
+			if !strings.HasSuffix(b.String(), "_") {
+				b.WriteByte('_')
+			}
+		}
+	}
+	// No hidden files, no "." or "..".
+	name := strings.Trim(b.String(), "._-")
+	if len(name) > maxTargetFileName {
+		sum := sha1.Sum([]byte(target))
+		name = name[:maxTargetFileName-9] + "-" + hex.EncodeToString(sum[:4])
+	}
+	if name == "" {
+		name = "target"
+	}
+	return name
+}
+
+// openTargetOutput opens the --output-dir file of target as the output.
+func (r *Runner) openTargetOutput(target string) error {
+	if r.outDir == nil {
+		return nil
+	}
+	path := filepath.Join(r.outDir.path, r.outDir.fileFor(target))
+	return r.openOutput(path, r.outDir.gz, r.cfg.Append)
+}
+
+// closeTargetOutput closes the target's --output-dir file, complete if the
+// target is, and records it in the index.
+func (r *Runner) closeTargetOutput(ts *targetSummary) {
+	if r.outDir == nil {
+		return
+	}
+	saved := r.closeOutputAs(ts.Status, []targetSummary{*ts}, nil)
+	if saved == "" {
+		return
+	}
+	if err := r.outDir.record(ts, filepath.Base(saved)); err != nil {
+		r.log.errf("write output index: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTargetFileName(t *testing.T) {
+	tests := map[string]string{
+		"example.com":                    "example.com",
+		"*.example.com":                  "wildcard.example.com",
+		"https://example.com/api/v1/*":   "example.com_api_v1",
+		"example.com:8080/a?b=c":         "example.com_8080_a_b_c",
+		"../../etc/passwd":               "etc_passwd",
+		".hidden":                        "hidden",
+		"***":                            "target",
+		"Example.COM/Path with spaces/x": "Example.COM_Path_with_spaces_x",
+	}
+	for in, want := range tests {
+		if got := targetFileName(in); got != want {
+			t.Errorf("targetFileName(%q) = %q, want %q", in, got, want)
+		}
+	}
+	long := "example.com/" + strings.Repeat("a", 300)
+	got := targetFileName(long)
+	if len(got) != maxTargetFileName || got == targetFileName(long+"b") {
+		t.Errorf("targetFileName(long) = %q (%d bytes); want %d bytes, distinct per target", got, len(got), maxTargetFileName)
+	}
+}
+
+func TestOutputDir(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{OutputDir: dir, JSON: true, ModeDirs: true, Compress: true}
+	d, err := openOutputDir(cfg)
+	if err != nil {
+		t.Fatalf("openOutputDir: %v", err)
+	}
+	if d.path != filepath.Join(dir, "json") {
+		t.Errorf("path = %q, want the json subfolder", d.path)
+	}
+	a := d.fileFor("example.com/a b")
+	b := d.fileFor("example.com/a_b") // same sanitized name
+	if a != "example.com_a_b.jsonl.gz" || b != "example.com_a_b-2.jsonl.gz" {
+		t.Errorf("files = %q, %q; want distinct names", a, b)
+	}
+	if again := d.fileFor("example.com/a b"); again != a {
+		t.Errorf("fileFor is not stable: %q then %q", a, again)
+	}
+	if err := d.record(&targetSummary{Target: "example.com/a_b", Results: 2, Status: statusOK}, b); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	// A later run into the same directory keeps the name and the entry.
+	d2, err := openOutputDir(cfg)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if got := d2.fileFor("example.com/a_b"); got != b {
+		t.Errorf("file after reopening = %q, want %q", got, b)
+	}
+	if got := d2.fileFor("example.com/a b"); got == b {
+		t.Errorf("new target reuses %q", b)
+	}
+	if len(d2.index.Targets) != 1 || d2.index.Targets[0].Results != 2 {
+		t.Errorf("index = %+v", d2.index)
+	}
+	if _, err := os.Stat(filepath.Join(d.path, outputIndexName)); err != nil {
+		t.Errorf("index file: %v", err)
+	}
+
+	// Files of another mode or compression must not be reused or relabelled.
+	for _, other := range []*Config{
+		{OutputDir: dir, JSON: true, ModeDirs: true},
+		{OutputDir: filepath.Join(dir, "json"), CSV: true, Compress: true},
+	} {
+		if _, err := openOutputDir(other); err == nil {
+			t.Errorf("openOutputDir(%+v) into the json files: want an error", *other)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// Names marking an output file that does not hold everything: an interrupted
+// or failed run keeps its results as <file>.partial, and writes which targets
+// and pages are missing to <name>.incomplete.json next to it.
+const (
+	partialSuffix    = ".partial"
+	incompleteSuffix = ".incomplete.json"
+)
+
+// incompleteOutput is the sidecar written next to an output file whose run
+// did not complete.
+type incompleteOutput struct {
+	File       string             `json:"file"`
+	RunID      string             `json:"run_id"`
+	Status     string             `json:"status"` // as in --summary
+	Targets    []incompleteTarget `json:"targets"`
+	NotStarted []string           `json:"not_started,omitempty"` // targets the run never reached
+}
+
+// incompleteTarget is a target whose results in the file are partial.
+type incompleteTarget struct {
+	Target        string   `json:"target"`
+	Status        string   `json:"status"`
+	Error         string   `json:"error,omitempty"`
+	Pages         int      `json:"pages"`
+	FailedPages   []int    `json:"failed_pages,omitempty"`
+	FailedBatches []string `json:"failed_batches,omitempty"` // resume keys (--cursor mode)
+}
+
+// writeIncomplete writes the sidecar of the output saved as file, listing
+// the targets that are not ok, with the pages that still failed.
+func (r *Runner) writeIncomplete(path, file, status string, targets []targetSummary, notStarted []string) error {
+	doc := incompleteOutput{
+		File:       filepath.Base(file),
+		RunID:      r.summary.RunID,
+		Status:     status,
+		Targets:    []incompleteTarget{},
+		NotStarted: notStarted,
+	}
+	if doc.Status == "" {
+		doc.Status = statusInterrupted // the run ended without a verdict
+	}
+	r.failuresMu.Lock()
+	failures := slices.Clone(r.failures)
+	r.failuresMu.Unlock()
+	for _, ts := range targets {
+		if ts.Status == statusOK || ts.Status == statusSkipped {
+			continue
+		}
+		it := incompleteTarget{Target: ts.Target, Status: ts.Status, Error: ts.Error, Pages: ts.Pages}
+		for _, f := range failures {
+			switch {
+			case f.Target != ts.Target:
+			case f.ResumeKey != "":
+				it.FailedBatches = append(it.FailedBatches, f.ResumeKey)
+			case f.Page >= 0:
+				it.FailedPages = append(it.FailedPages, f.Page)
+			}
+		}
+		slices.Sort(it.FailedPages)
+		doc.Targets = append(doc.Targets, it)
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+// notStarted returns the run's targets that have no summary entry: those a
+// cancelled run never reached.
+func (r *Runner) notStarted() []string {
+	targets := r.cfg.URLList
+	if len(targets) == 0 {
+		targets = []string{r.cfg.URLPattern}
+	}
+	var out []string
+	for _, t := range targets {
+		if !slices.ContainsFunc(r.summary.Targets, func(ts targetSummary) bool { return ts.Target == t }) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// removeStalePartial removes the partial file and sidecars an earlier,
+// incomplete run left for path, once path itself is complete.
+func removeStalePartial(path string) {
+	for _, p := range []string{path + partialSuffix, path + partialSuffix + incompleteSuffix, path + incompleteSuffix} {
+		os.Remove(p)
+	}
+}
@@ -2,15 +2,25 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
 )
 
 // fakeCDX mimics the Wayback CDX API: a showNumPages reply, then two pages of
@@ -67,10 +77,11 @@ func newPipelineRunner(t *testing.T, srv *httptest.Server, cfg *Config, out *byt
 	if err != nil {
 		t.Fatalf("CompileExtRegex: %v", err)
 	}
+	client := &cdx.Client{HTTPClient: srv.Client(), Endpoint: srv.URL, Retries: cfg.Retries}
 	return &Runner{
 		cfg:            cfg,
-		client:         srv.Client(),
-		baseURL:        srv.URL,
+		client:         client,
+		source:         client,
 		log:            newLogger(cfg.Silent, false),
 		extRegex:       re,
 		includeMode:    includeMode,
@@ -153,6 +164,327 @@ func TestPipelineJSON(t *testing.T) {
 	}
 }
 
+// TestPipelineCollapse checks that --collapse reaches the server and that JSON
+// dedup follows it: /a has two captures on different days of 2020.
+func TestPipelineCollapse(t *testing.T) {
+	for _, tt := range []struct {
+		collapse  string
+		wantParam string
+		wantLines int
+	}{
+		{"", "urlkey", 3},
+		{"none", "", 4},
+		{"timestamp:4", "timestamp:4", 3},
+		{"timestamp:8", "timestamp:8", 4},
+	} {
+		t.Run(tt.collapse, func(t *testing.T) {
+			inner := fakeCDX(t)
+			defer inner.Close()
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if q := req.URL.Query(); q.Get("page") != "" && q.Get("collapse") != tt.wantParam {
+					t.Errorf("collapse=%q, want %q", q.Get("collapse"), tt.wantParam)
+				}
+				inner.Config.Handler.ServeHTTP(w, req)
+			}))
+			defer srv.Close()
+
+			var buf bytes.Buffer
+			r := newPipelineRunner(t, srv, &Config{JSON: true, ExcludeDefaults: true}, &buf)
+			r.collapse, _ = parseCollapse(tt.collapse)
+			if err := r.Run(context.Background()); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if got := outputLines(buf.String()); len(got) != tt.wantLines {
+				t.Errorf("got %d records, want %d: %v", len(got), tt.wantLines, got)
+			}
+		})
+	}
+}
+
+func TestPipelineCSV(t *testing.T) {
+	srv := fakeCDX(t)
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	r := newPipelineRunner(t, srv, &Config{CSV: true, ExcludeDefaults: true, Workers: 1}, &buf)
+	// fakeCDX only returns metadata columns when timestamp is requested.
+	// Dedup is by URL even though the original column is not printed; one
+	// worker keeps the first capture of /a deterministic.
+	r.fields, _ = parseFields("host,path,timestamp,extension")
+	r.tableKeyCol = -1
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	got := outputLines(buf.String())
+	want := []string{
+		"host,path,timestamp,extension",
+		"example.com,/a,20200101,",
+		"example.com,/c,20210101,",
+		"sub.example.com,/d,20210101,",
+	}
+	if len(got) == 0 || got[0] != want[0] {
+		t.Fatalf("first line = %v, want header %q", got, want[0])
+	}
+	sort.Strings(got[1:])
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestPipelineTemplate(t *testing.T) {
+	srv := fakeCDX(t)
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	r := newPipelineRunner(t, srv, &Config{Template: "{{.Hostname}} {{.Status}}", ExcludeDefaults: true}, &buf)
+	r.tmpl, _ = parseTemplate(r.cfg.Template)
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	got := outputLines(buf.String())
+	sort.Strings(got)
+	// Deduplicated by rendered text: /a and /c render differently only by
+	// status.
+	want := []string{"example.com 200", "example.com 301", "sub.example.com 200"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Distinct text still counts one capture per URL under the default
+	// --collapse: /a was captured twice.
+	buf.Reset()
+	r = newPipelineRunner(t, srv, &Config{Template: "{{.URL}} {{.Timestamp}}", ExcludeDefaults: true}, &buf)
+	r.tmpl, _ = parseTemplate(r.cfg.Template)
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if got := outputLines(buf.String()); len(got) != 3 {
+		t.Errorf("got %v, want one line per URL", got)
+	}
+}
+
+// TestPipelineTemplateMultiLine renders one record on two lines, which the
+// up-front probe misses. With --append it is not written and the run is
+// incomplete; otherwise it is printed as rendered.
+func TestPipelineTemplateMultiLine(t *testing.T) {
+	srv := fakeCDX(t)
+	defer srv.Close()
+	const text = `{{.URL}}{{if eq .Path "/c"}}{{"\n"}}moved{{end}}`
+
+	for _, appendMode := range []bool{false, true} {
+		var buf bytes.Buffer
+		r := newPipelineRunner(t, srv, &Config{Template: text, Append: appendMode, ExcludeDefaults: true}, &buf)
+		r.tmpl, _ = parseTemplate(text)
+		if multiLineTemplate(r.tmpl) {
+			t.Fatal("probe record should not reach the line break")
+		}
+		err := r.Run(context.Background())
+		got := outputLines(buf.String())
+		sort.Strings(got)
+		want := []string{"http://example.com/a", "http://example.com/c", "http://sub.example.com/d", "moved"}
+		if appendMode {
+			want = []string{"http://example.com/a", "http://sub.example.com/d"}
+			if !errors.Is(err, errIncomplete) {
+				t.Errorf("append: Run error = %v, want incomplete", err)
+			}
+		} else if err != nil {
+			t.Errorf("Run: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("append=%v: got %v, want %v", appendMode, got, want)
+		}
+	}
+}
+
+func TestPipelineTimeline(t *testing.T) {
+	srv := fakeCDX(t)
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	r := newPipelineRunner(t, srv, &Config{Timeline: true, JSON: true, ExcludeDefaults: true}, &buf)
+	r.collapse, _ = parseCollapse(r.cfg.EffectiveCollapse())
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	var got []timelineRow
+	for _, l := range outputLines(buf.String()) {
+		var row timelineRow
+		if err := json.Unmarshal([]byte(l), &row); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", l, err)
+		}
+		got = append(got, row)
+	}
+	// /a's two 2020 captures count once: one URL per year.
+	if len(got) != 2 || got[0].Host != "example.com" || got[1].Host != "sub.example.com" {
+		t.Fatalf("rows = %+v, want example.com and sub.example.com", got)
+	}
+	if want := map[string]int{"2020": 1, "2021": 1}; !reflect.DeepEqual(got[0].Counts, want) || got[0].Total != 2 {
+		t.Errorf("example.com counts = %v total %d, want %v", got[0].Counts, got[0].Total, want)
+	}
+}
+
+// TestPipelineHTMLReport checks that --html-report fetches the metadata it
+// tabulates without changing what the default mode prints.
+func TestPipelineHTMLReport(t *testing.T) {
+	srv := fakeCDX(t)
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "report.html")
+	var buf bytes.Buffer
+	r := newPipelineRunner(t, srv, &Config{HTMLReport: path, ExcludeDefaults: true}, &buf)
+	r.report = newHTMLReport(true)
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	got := outputLines(buf.String())
+	sort.Strings(got)
+	want := []string{"http://example.com/a", "http://example.com/c", "http://sub.example.com/d"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stdout = %v, want %v", got, want)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read report: %v", err)
+	}
+	for _, s := range []string{"3 unique URLs", "sub.example.com", "https://web.archive.org/web/20210101/http://example.com/c", ">301<"} {
+		if !strings.Contains(string(data), s) {
+			t.Errorf("report lacks %q", s)
+		}
+	}
+}
+
+// TestPipelineOpenAPI runs two targets and expects one document covering
+// both, written when the run ends.
+func TestPipelineOpenAPI(t *testing.T) {
+	srv := fakeCDX(t)
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	cfg := &Config{OpenAPI: true, ExcludeDefaults: true, URLList: []string{"example.com", "example.com/c"}}
+	r := newPipelineRunner(t, srv, cfg, &buf)
+	r.doc = newOpenAPIDoc(cfg.URLList)
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	var doc oaDocument
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not one JSON document: %v\n%s", err, buf.String())
+	}
+	var paths []string
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	if want := []string{"/a", "/c", "/d"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("paths = %v, want %v", paths, want)
+	}
+	if doc.Info.Title != "Archived API of example.com, example.com/c" {
+		t.Errorf("title = %q", doc.Info.Title)
+	}
+}
+
+// TestPipelineHAR checks that --har honours the default mode's filters: the
+// excluded .js capture and the duplicate /a are left out.
+func TestPipelineHAR(t *testing.T) {
+	srv := fakeCDX(t)
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	cfg := &Config{HAR: true, ExcludeDefaults: true}
+	r := newPipelineRunner(t, srv, cfg, &buf)
+	r.doc = newHARDoc(false)
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	var log harLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("output is not one JSON document: %v\n%s", err, buf.String())
+	}
+	var urls []string
+	for _, e := range log.Log.Entries {
+		urls = append(urls, e.Request.URL)
+	}
+	want := []string{"http://example.com/a", "http://example.com/c", "http://sub.example.com/d"}
+	if !reflect.DeepEqual(urls, want) {
+		t.Errorf("entries = %v, want %v", urls, want)
+	}
+	if got := log.Log.Entries[1].Response.Status; got != 301 {
+		t.Errorf("status of /c = %d, want 301", got)
+	}
+}
+
+// TestPipelineESBulk checks the _bulk NDJSON output and that --es-url sends
+// the same documents to the cluster, in batches.
+func TestPipelineESBulk(t *testing.T) {
+	srv := fakeCDX(t)
+	defer srv.Close()
+	stand := &bulkStandIn{}
+	es := httptest.NewServer(stand)
+	defer es.Close()
+
+	var buf bytes.Buffer
+	cfg := &Config{ESBulk: true, ESIndex: "recon", ESBatch: 2, ExcludeDefaults: true}
+	r := newPipelineRunner(t, srv, cfg, &buf)
+	r.bulk = &bulkPoster{url: es.URL + "/_bulk", hc: es.Client(), retries: 1, size: cfg.ESBatch, logf: r.notify}
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	lines := outputLines(buf.String())
+	if len(lines) != 6 {
+		t.Fatalf("got %d lines, want 3 action/document pairs:\n%s", len(lines), buf.String())
+	}
+	// Workers run concurrently, so pairs are looked up by URL, not position.
+	docs := make(map[string]esDoc)
+	for i := 0; i < len(lines); i += 2 {
+		var act esAction
+		if err := json.Unmarshal([]byte(lines[i]), &act); err != nil || act.Index.Index != "recon" || len(act.Index.ID) != 40 {
+			t.Errorf("action line = %s (%v)", lines[i], err)
+		}
+		var doc esDoc
+		if err := json.Unmarshal([]byte(lines[i+1]), &doc); err != nil {
+			t.Fatalf("document line: %v", err)
+		}
+		docs[doc.URL] = doc
+	}
+	doc, ok := docs["http://example.com/a"]
+	if !ok || doc.Host != "example.com" || doc.Path != "/a" || doc.Status != 200 ||
+		doc.Target != "example.com" || doc.Source != sourceWayback || doc.RunID == "" || !strings.HasPrefix(doc.Time, "2020-01-0") {
+		t.Errorf("document = %+v", doc)
+	}
+	if stand.requests != 2 || len(stand.docs) != 3 || r.bulk.indexed != 3 {
+		t.Errorf("cluster got %d requests, %d docs (indexed %d); want 2, 3, 3", stand.requests, len(stand.docs), r.bulk.indexed)
+	}
+}
+
+// TestPipelineESBulkFailed checks that documents the cluster never got make
+// the run incomplete, while the NDJSON file, which has them all, is saved.
+func TestPipelineESBulkFailed(t *testing.T) {
+	srv := fakeCDX(t)
+	defer srv.Close()
+	stand := &bulkStandIn{statuses: []int{http.StatusUnauthorized}} // first batch lost
+	es := httptest.NewServer(stand)
+	defer es.Close()
+	path := filepath.Join(t.TempDir(), "docs.ndjson")
+
+	var buf bytes.Buffer
+	cfg := &Config{ESBulk: true, ESIndex: "recon", ESBatch: 2, ExcludeDefaults: true, OutputFile: path}
+	r := newPipelineRunner(t, srv, cfg, &buf)
+	r.bulk = &bulkPoster{url: es.URL + "/_bulk", hc: es.Client(), retries: 1, size: cfg.ESBatch, logf: r.notify}
+	if err := r.openOutput(path, false, false); err != nil {
+		t.Fatalf("openOutput: %v", err)
+	}
+	if err := r.Run(context.Background()); !errors.Is(err, errIncomplete) {
+		t.Fatalf("Run = %v, want errIncomplete", err)
+	}
+	if r.summary.Status != statusIncomplete || r.summary.ESBulk == nil || *r.summary.ESBulk != (bulkSummary{Indexed: 1, Failed: 2}) {
+		t.Errorf("summary status %s, es_bulk %+v; want incomplete, 1 indexed, 2 failed", r.summary.Status, r.summary.ESBulk)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("output file: %v", err)
+	}
+}
+
 func TestPipelineSubs(t *testing.T) {
 	srv := fakeCDX(t)
 	defer srv.Close()
@@ -169,6 +501,788 @@ func TestPipelineSubs(t *testing.T) {
 	}
 }
 
+// fakeCommonCrawl mimics the Common Crawl index server: collinfo.json lists
+// one crawl whose index reports two pages of JSON-lines records. Page 1 repeats
+// a URL from page 0 so dedup across pages is exercised.
+func fakeCommonCrawl(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/collinfo.json" {
+			fmt.Fprintln(w, `[{"id":"CC-MAIN-2024-33","name":"August 2024"},{"id":"CC-MAIN-2024-30","name":"July 2024"}]`)
+			return
+		}
+		if req.URL.Path != "/CC-MAIN-2024-33-index" {
+			http.NotFound(w, req)
+			return
+		}
+		q := req.URL.Query()
+		if q.Get("output") != "json" {
+			t.Errorf("Common Crawl request without output=json: %s", req.URL)
+		}
+		if q.Get("showNumPages") == "true" {
+			fmt.Fprintln(w, `{"pages": 2, "pageSize": 5, "blocks": 7}`)
+			return
+		}
+		switch q.Get("page") {
+		case "0":
+			fmt.Fprintln(w, `{"urlkey":"com,example)/cc","timestamp":"20240801000000","url":"http://example.com/cc","mime":"text/html","status":"200"}`)
+			fmt.Fprintln(w, `{"urlkey":"com,example)/app.js","timestamp":"20240801000000","url":"http://example.com/app.js","mime":"application/javascript","status":"200"}`)
+		case "1":
+			fmt.Fprintln(w, `{"urlkey":"com,example)/cc","timestamp":"20240802000000","url":"http://example.com/cc","mime":"text/html","status":"404"}`)
+			fmt.Fprintln(w, `{"urlkey":"com,example)/only","timestamp":"20240802000000","url":"http://example.com/only in cc","mime":"text/html","status":"200"}`)
+		}
+	}))
+}
+
+func TestPipelineCommonCrawl(t *testing.T) {
+	srv := fakeCommonCrawl(t)
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	// One page fetcher and one worker keep pages in order, so the page-0
+	// capture of /cc is the one dedup keeps.
+	r := newPipelineRunner(t, srv, &Config{JSON: true, ExcludeDefaults: true, PageWorkers: 1, Workers: 1}, &buf)
+	r.source = &cdx.CommonCrawl{Client: r.client, Server: srv.URL}
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	got := outputLines(buf.String())
+	seen := map[string]jsonRecord{}
+	for _, l := range got {
+		var rec jsonRecord
+		if err := json.Unmarshal([]byte(l), &rec); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", l, err)
+		}
+		seen[rec.URL] = rec
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d lines, want 2 (filtered + deduped): %v", len(got), got)
+	}
+	if rec := seen["http://example.com/cc"]; rec.Status != "200" || rec.Timestamp != "20240801000000" {
+		t.Errorf("record for /cc = %+v, want the first capture (status 200)", rec)
+	}
+	if _, ok := seen["http://example.com/only%20in%20cc"]; !ok {
+		t.Errorf("URL with a space should arrive percent-encoded, got %v", got)
+	}
+}
+
+// TestPipelineTimeMap sweeps two archives' TimeMaps in one run; the URL both
+// archives hold is printed once, and the extension filter still applies. The
+// second archive has no wildcard support, so it is asked for the exact URL.
+func TestPipelineTimeMap(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/a/example.com*":
+			fmt.Fprintln(w, `<http://example.com/>; rel="original",`)
+			fmt.Fprintln(w, `<http://a.example/20200101000000/http://example.com/page>; rel="memento",`)
+			fmt.Fprintln(w, `<http://a.example/20200101000000/http://example.com/app.js>; rel="memento"`)
+		case "/b/example.com": // b serves exact URLs only; wildcards are 404
+			fmt.Fprintln(w, `<http://b.example/20210101000000/http://example.com/page>; rel="memento",`)
+			fmt.Fprintln(w, `<http://b.example/20210101000000/http://example.com/other>; rel="memento"`)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	r := newPipelineRunner(t, srv, &Config{ExcludeDefaults: true}, &buf)
+	r.source = cdx.NewTimeMap(r.client, srv.URL+"/a/", srv.URL+"/b/")
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	got := outputLines(buf.String())
+	sort.Strings(got)
+	want := []string{"http://example.com/other", "http://example.com/page"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v (deduped across archives, app.js filtered)", got, want)
+	}
+}
+
+// fakeCursorCDX answers showNumPages with garbage and serves two resume-key
+// batches. It fails the test if a numbered page is requested, since guessing
+// page numbers is what truncates large targets.
+func fakeCursorCDX(t *testing.T, numPagesHits *int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		switch {
+		case q.Get("showNumPages") == "true":
+			atomic.AddInt32(numPagesHits, 1)
+			fmt.Fprintln(w, "error: try again")
+		case q.Get("page") != "":
+			t.Errorf("numbered page requested in cursor mode: %s", req.URL.RawQuery)
+		case q.Get("resumeKey") == "":
+			fmt.Fprint(w, "http://example.com/a\nhttp://example.com/b\n\nnext-key\n")
+		case q.Get("resumeKey") == "next-key":
+			fmt.Fprint(w, "http://example.com/b\nhttp://example.com/c\n")
+		}
+	}))
+}
+
+func TestPipelineCursor(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		cursor        bool
+		wantCountHits int32
+	}{
+		{"fallback when page count is unparsable", false, 1},
+		{"forced with --cursor", true, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits int32
+			srv := fakeCursorCDX(t, &hits)
+			defer srv.Close()
+
+			var buf bytes.Buffer
+			// One worker keeps lines in server order, which the output is
+			// compared in.
+			r := newPipelineRunner(t, srv, &Config{Cursor: tt.cursor, CursorLimit: 2, Workers: 1}, &buf)
+			if err := r.Run(context.Background()); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			got := outputLines(buf.String())
+			want := []string{"http://example.com/a", "http://example.com/b", "http://example.com/c"}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			if atomic.LoadInt32(&hits) != tt.wantCountHits {
+				t.Errorf("showNumPages requests = %d, want %d", hits, tt.wantCountHits)
+			}
+		})
+	}
+}
+
+// TestPipelineCursorRetry fails one batch of fakeCursorCDX a set number of
+// times. One failure is recovered by the batch's retry; a batch that keeps
+// failing is reported by its resume key and counted as a failed page.
+func TestPipelineCursorRetry(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		resumeKey  string // of the failing batch
+		failures   int32
+		wantLines  int
+		wantReport string
+	}{
+		{"recovered on the retry", "next-key", 1, 3, ""},
+		{"first batch still failing", "", 100, 0,
+			`{"target":"example.com","page":-1,"resume_key":"(first batch)","error":"walk CDX results: HTTP 404"}` + "\n"},
+		{"later batch still failing", "next-key", 100, 2,
+			`{"target":"example.com","page":-1,"resume_key":"next-key","error":"walk CDX results: HTTP 404"}` + "\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var countHits, hits int32
+			inner := fakeCursorCDX(t, &countHits)
+			defer inner.Close()
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.URL.Query().Get("resumeKey") == tt.resumeKey && atomic.AddInt32(&hits, 1) <= tt.failures {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				inner.Config.Handler.ServeHTTP(w, req)
+			}))
+			defer srv.Close()
+
+			report := filepath.Join(t.TempDir(), "failed.jsonl")
+			var buf bytes.Buffer
+			r := newPipelineRunner(t, srv, &Config{Cursor: true, CursorLimit: 2, Retries: 1, FailedReport: report}, &buf)
+			err := r.Run(context.Background())
+
+			if got := len(outputLines(buf.String())); got != tt.wantLines {
+				t.Errorf("got %d result lines, want %d", got, tt.wantLines)
+			}
+			data, _ := os.ReadFile(report)
+			if string(data) != tt.wantReport {
+				t.Errorf("report = %q, want %q", data, tt.wantReport)
+			}
+			if incomplete := errors.Is(err, errIncomplete); incomplete != (tt.wantReport != "") {
+				t.Errorf("Run error = %v, want incomplete=%v", err, tt.wantReport != "")
+			} else if incomplete && !strings.HasSuffix(err.Error(), ": 1 cursor batch(es) failed") {
+				t.Errorf("Run error = %v, want it to count 1 failed batch", err)
+			}
+			if got := atomic.LoadInt32(&hits); got != 2 {
+				t.Errorf("failing batch requested %d times, want 2 (one retry)", got)
+			}
+			if ts := r.summary.Targets[0]; tt.wantReport != "" && ts.PagesFailed != 1 {
+				t.Errorf("pages_failed = %d, want 1", ts.PagesFailed)
+			}
+		})
+	}
+}
+
+// TestPipelineSmartDedup serves several variations of two URL shapes over
+// two pages: --smart-dedup prints the first of each, --smart-dedup-latest
+// the most recently captured.
+func TestPipelineSmartDedup(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		if q.Get("showNumPages") == "true" {
+			fmt.Fprintln(w, "1")
+			return
+		}
+		withTS := strings.Contains(q.Get("fl"), "timestamp")
+		seen := make(map[string]bool)
+		for _, row := range []string{
+			"http://example.com/item?id=1 20200101000000",
+			"http://example.com/blog/2019/01/post-a 20190105000000",
+			"http://example.com/item?id=7 20230101000000",
+			"http://example.com/blog/2019/02/post-b 20190210000000",
+			"http://example.com/item?id=3 20210101000000",
+			"http://example.com/item?id=1 20240101000000", // recaptured
+		} {
+			u, _, _ := strings.Cut(row, " ")
+			if q.Get("collapse") == "urlkey" && seen[u] {
+				continue // Wayback keeps each URL's first capture
+			}
+			seen[u] = true
+			if !withTS {
+				row = u
+			}
+			fmt.Fprintln(w, row)
+		}
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		name   string
+		latest bool
+		want   []string
+	}{
+		{"first of each shape", false, []string{"http://example.com/item?id=1", "http://example.com/blog/2019/01/post-a"}},
+		{"latest of each shape", true, []string{"http://example.com/item?id=1", "http://example.com/blog/2019/02/post-b"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			// One worker keeps lines in server order, so "first" is defined.
+			cfg := &Config{Workers: 1, SmartDedup: true, SmartDedupLatest: tt.latest}
+			r := newPipelineRunner(t, srv, cfg, &buf)
+			r.collapse, _ = parseCollapse(cfg.EffectiveCollapse())
+			if err := r.Run(context.Background()); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if got := outputLines(buf.String()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPipelineGzipOutput writes a .gz output file, then appends to it as a
+// resumed run would: the file decompresses to every result once, while stdout
+// stays plain.
+func TestPipelineGzipOutput(t *testing.T) {
+	srv := fakeCDX(t)
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "urls.txt.gz")
+
+	run := func(pattern string) []string {
+		t.Helper()
+		var buf bytes.Buffer
+		cfg := &Config{URLPattern: pattern, OutputFile: path, ExcludeDefaults: true}
+		r := newPipelineRunner(t, srv, cfg, &buf)
+		f, known, err := openAppend(path, cfg.compressOutput(), r.outputKey)
+		if err != nil {
+			t.Fatalf("openAppend: %v", err)
+		}
+		r.known = known
+		r.outFile, r.outGzip = f, gzip.NewWriter(f)
+		r.outWriter = io.MultiWriter(&buf, r.outGzip)
+		if err := r.Run(context.Background()); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		return outputLines(buf.String())
+	}
+	if got := run("example.com"); len(got) != 3 {
+		t.Fatalf("first run printed %v, want 3 URLs", got)
+	}
+	if got := run("example.com/"); len(got) != 0 {
+		t.Errorf("second run printed %v, want nothing new", got)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("output is not gzip: %v", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("read gzip output: %v", err)
+	}
+	want := []string{"http://example.com/a", "http://example.com/c", "http://sub.example.com/d"}
+	got := outputLines(string(data))
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("file holds %v, want %v", got, want)
+	}
+}
+
+// TestPipelineOutputDir runs two targets into --output-dir: each gets its own
+// file, stdout still gets everything, and the index maps targets to files.
+func TestPipelineOutputDir(t *testing.T) {
+	srv := fakeCDX(t)
+	defer srv.Close()
+	dir := t.TempDir()
+
+	var buf bytes.Buffer
+	cfg := &Config{URLList: []string{"example.com", "*.example.com"}, OutputDir: dir, ExcludeDefaults: true}
+	r := newPipelineRunner(t, srv, cfg, &buf)
+	var err error
+	if r.outDir, err = openOutputDir(cfg); err != nil {
+		t.Fatalf("openOutputDir: %v", err)
+	}
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if got := len(outputLines(buf.String())); got != 6 {
+		t.Errorf("stdout has %d lines, want 6", got)
+	}
+	for _, name := range []string{"example.com.txt", "wildcard.example.com.txt"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("per-target file: %v", err)
+		}
+		if got := len(outputLines(string(data))); got != 3 {
+			t.Errorf("%s has %d lines, want 3", name, got)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, outputIndexName))
+	if err != nil {
+		t.Fatalf("index: %v", err)
+	}
+	var idx outputIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		t.Fatalf("index is not JSON: %v", err)
+	}
+	if idx.Mode != "urls" || len(idx.Targets) != 2 {
+		t.Fatalf("index = %+v", idx)
+	}
+	for _, e := range idx.Targets {
+		if e.Results != 3 || e.Status != statusOK {
+			t.Errorf("index entry = %+v, want 3 results, ok", e)
+		}
+	}
+}
+
+// TestPipelineAppend re-runs into an existing output file with --append:
+// only URLs the file lacks are written, and the summary counts the rest as
+// known.
+func TestPipelineAppend(t *testing.T) {
+	srv := fakeCDX(t)
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "urls.txt")
+	if err := os.WriteFile(path, []byte("http://example.com/a\nhttp://other.com/x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	cfg := &Config{OutputFile: path, Append: true, ExcludeDefaults: true}
+	r := newPipelineRunner(t, srv, cfg, &buf)
+	if err := r.openOutput(path, false, true); err != nil {
+		t.Fatalf("openOutput: %v", err)
+	}
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	want := []string{"http://example.com/c", "http://sub.example.com/d"}
+	got := outputLines(buf.String())
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stdout = %v, want only the new URLs %v", got, want)
+	}
+	data, _ := os.ReadFile(path)
+	if lines := outputLines(string(data)); len(lines) != 4 || lines[0] != "http://example.com/a" {
+		t.Errorf("file = %q, want the old lines followed by the new", data)
+	}
+	if r.summary.Results != 2 || r.summary.Known != 1 {
+		t.Errorf("summary results %d, known %d; want 2, 1", r.summary.Results, r.summary.Known)
+	}
+}
+
+// TestPipelineAtomicOutput checks that -o only replaces the file once the run
+// is complete: a run whose page 1 keeps failing leaves urls.txt untouched and
+// keeps its results as urls.txt.partial, with a sidecar naming the page.
+func TestPipelineAtomicOutput(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		fail     bool
+		wantFile string
+	}{
+		{"complete run replaces the file", false, "urls.txt"},
+		{"incomplete run is kept as partial", true, "urls.txt" + partialSuffix},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := fakeCDX(t)
+			defer inner.Close()
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if tt.fail && req.URL.Query().Get("page") == "1" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				inner.Config.Handler.ServeHTTP(w, req)
+			}))
+			defer srv.Close()
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "urls.txt")
+			if err := os.WriteFile(path, []byte("old\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			cfg := &Config{OutputFile: path, Retries: 1, ExcludeDefaults: true}
+			r := newPipelineRunner(t, srv, cfg, &buf)
+			if err := r.openOutput(path, false, false); err != nil {
+				t.Fatalf("openOutput: %v", err)
+			}
+			r.Run(context.Background())
+
+			data, err := os.ReadFile(filepath.Join(dir, tt.wantFile))
+			if err != nil {
+				t.Fatalf("results file: %v", err)
+			}
+			if got := outputLines(string(data)); len(got) != len(outputLines(buf.String())) {
+				t.Errorf("%s holds %v, want what stdout got", tt.wantFile, got)
+			}
+			if tmp, _ := filepath.Glob(filepath.Join(dir, "*.tmp*")); len(tmp) > 0 {
+				t.Errorf("temp files left behind: %v", tmp)
+			}
+			sidecar := filepath.Join(dir, tt.wantFile+incompleteSuffix)
+			if !tt.fail {
+				if _, err := os.Stat(sidecar); err == nil {
+					t.Errorf("complete run wrote %s", sidecar)
+				}
+				return
+			}
+			if old, _ := os.ReadFile(path); string(old) != "old\n" {
+				t.Errorf("incomplete run changed %s to %q", path, old)
+			}
+			data, err = os.ReadFile(sidecar)
+			if err != nil {
+				t.Fatalf("sidecar: %v", err)
+			}
+			var doc incompleteOutput
+			if err := json.Unmarshal(data, &doc); err != nil {
+				t.Fatalf("sidecar is not JSON: %v", err)
+			}
+			if doc.Status != statusIncomplete || len(doc.Targets) != 1 || !reflect.DeepEqual(doc.Targets[0].FailedPages, []int{1}) {
+				t.Errorf("sidecar = %+v, want example.com page 1 incomplete", doc)
+			}
+		})
+	}
+}
+
+// TestPipelineOutputDirCSV checks that every --output-dir file gets its own
+// CSV header.
+func TestPipelineOutputDirCSV(t *testing.T) {
+	srv := fakeCDX(t)
+	defer srv.Close()
+	dir := t.TempDir()
+
+	var buf bytes.Buffer
+	cfg := &Config{URLList: []string{"example.com", "example.org"}, OutputDir: dir, CSV: true, ExcludeDefaults: true}
+	r := newPipelineRunner(t, srv, cfg, &buf)
+	r.fields, _ = parseFields("original,statuscode")
+	var err error
+	if r.outDir, err = openOutputDir(cfg); err != nil {
+		t.Fatalf("openOutputDir: %v", err)
+	}
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for _, name := range []string{"example.com.csv", "example.org.csv"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(data), "original,statuscode\n") {
+			t.Errorf("%s lacks the header:\n%s", name, data)
+		}
+	}
+}
+
+// TestPipelineResume resumes a --list run whose first target finished and
+// whose second had page 0 fetched: only page 1 of the second target is
+// requested, and a URL the output already holds is not written again.
+func TestPipelineResume(t *testing.T) {
+	var mu sync.Mutex
+	var requested []string
+	inner := fakeCDX(t)
+	defer inner.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		mu.Lock()
+		requested = append(requested, q.Get("url")+" page="+q.Get("page"))
+		mu.Unlock()
+		inner.Config.Handler.ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	r := newPipelineRunner(t, srv, &Config{URLList: []string{"done.com", "example.com"}}, &buf)
+	query := func(target string) string {
+		r.currentPattern = target
+		return r.checkpointQuery()
+	}
+	cp := newCheckpoint(filepath.Join(t.TempDir(), "run.ckpt"), "out.txt")
+	cp.useQuery("done.com", query("done.com"))
+	cp.finish("done.com")
+	cp.useQuery("example.com", query("example.com"))
+	cp.startPages("example.com", 2)
+	cp.pageDone("example.com", 0)
+	r.checkpoint = cp
+	r.known = map[string]struct{}{"http://example.com/c": {}}
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if got, want := outputLines(buf.String()), []string{"http://sub.example.com/d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("output = %v, want %v", got, want)
+	}
+	for _, req := range requested {
+		if strings.HasPrefix(req, "done.com") || strings.HasSuffix(req, "page=0") {
+			t.Errorf("resumed run re-requested finished work: %s", req)
+		}
+	}
+	loaded, err := loadCheckpoint(cp.path)
+	if err != nil {
+		t.Fatalf("loadCheckpoint: %v", err)
+	}
+	if !loaded.isDone("example.com") {
+		t.Error("example.com should be marked done after its last page")
+	}
+}
+
+// TestPipelineResumeOtherQuery resumes a target checkpointed as done under
+// other flags: that progress does not apply, so the target is fetched again.
+func TestPipelineResumeOtherQuery(t *testing.T) {
+	srv := fakeCDX(t)
+	defer srv.Close()
+	cp := newCheckpoint(filepath.Join(t.TempDir(), "run.ckpt"), "out.txt")
+	cp.useQuery("example.com", "made with --status 404")
+	cp.finish("example.com")
+
+	var buf bytes.Buffer
+	r := newPipelineRunner(t, srv, &Config{ExcludeDefaults: true}, &buf)
+	r.checkpoint = cp
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if got := outputLines(buf.String()); len(got) != 3 {
+		t.Errorf("output = %v, want the target's 3 URLs", got)
+	}
+	if ts := cp.Targets["example.com"]; !ts.Done || ts.Query != r.checkpointQuery() {
+		t.Errorf("checkpoint entry = %+v, want done under this run's query", ts)
+	}
+}
+
+// TestPipelineCheckpointMidTarget checks that a long target is checkpointed
+// every checkpointEvery pages, and that whenever the checkpoint is read, the
+// output file already holds the results of every page it marks done.
+func TestPipelineCheckpointMidTarget(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "urls.txt")
+	ckpt := filepath.Join(dir, "run.ckpt")
+	pages := 2*checkpointEvery + 1
+	var mu sync.Mutex
+	maxSeen := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		if q.Get("showNumPages") == "true" {
+			fmt.Fprintln(w, pages)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if cp, err := loadCheckpoint(ckpt); err == nil && cp.Targets["example.com"] != nil {
+			data, _ := os.ReadFile(path)
+			done := cp.Targets["example.com"].Completed
+			for _, p := range done {
+				if !strings.Contains(string(data), fmt.Sprintf("/page%d\n", p)) {
+					t.Errorf("checkpoint marks page %d done, but the output lacks its result", p)
+				}
+			}
+			maxSeen = max(maxSeen, len(done))
+		}
+		fmt.Fprintf(w, "http://example.com/page%s\n", q.Get("page"))
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	cfg := &Config{OutputFile: path, Checkpoint: ckpt}
+	r := newPipelineRunner(t, srv, cfg, &buf)
+	r.checkpoint = newCheckpoint(ckpt, path)
+	if err := r.openOutput(path, false, false); err != nil {
+		t.Fatalf("openOutput: %v", err)
+	}
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if maxSeen < checkpointEvery {
+		t.Errorf("largest checkpoint seen mid-target covered %d pages, want at least %d", maxSeen, checkpointEvery)
+	}
+}
+
+// TestPipelineResumeGzipAfterCrash copies a compressed checkpointed output
+// file as a crash would leave it, once the first target is checkpointed and
+// while the second runs: resuming from the copy must keep the first target's
+// results, since the checkpoint says they need not be fetched again.
+func TestPipelineResumeGzipAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "urls.txt.gz")
+	crashed := filepath.Join(dir, "crashed.txt.gz")
+	inner := fakeCDX(t)
+	defer inner.Close()
+	var once sync.Once
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Query().Get("url"), "example.org") {
+			once.Do(func() {
+				data, err := os.ReadFile(path)
+				if err == nil {
+					err = os.WriteFile(crashed, data, 0o644)
+				}
+				if err != nil {
+					t.Errorf("copy output: %v", err)
+				}
+			})
+		}
+		inner.Config.Handler.ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	cfg := &Config{URLList: []string{"example.com", "example.org"}, OutputFile: path, Checkpoint: filepath.Join(dir, "run.ckpt"), ExcludeDefaults: true}
+	r := newPipelineRunner(t, srv, cfg, &buf)
+	r.checkpoint = newCheckpoint(cfg.Checkpoint, path)
+	if err := r.openOutput(path, true, false); err != nil {
+		t.Fatalf("openOutput: %v", err)
+	}
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	f, known, err := openAppend(crashed, true, r.outputKey)
+	if err != nil {
+		t.Fatalf("openAppend: %v", err)
+	}
+	f.Close()
+	for _, u := range []string{"http://example.com/a", "http://example.com/c", "http://sub.example.com/d"} {
+		if _, ok := known[u]; !ok {
+			t.Errorf("resume lost %s of the checkpointed target; known = %v", u, known)
+		}
+	}
+}
+
+// TestPipelineRetryPass fails page 1 of fakeCDX a set number of times. One
+// failure is recovered by the deferred retry pass; a page that keeps failing
+// ends up in the --failed-report file and makes Run report incompleteness.
+func TestPipelineRetryPass(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		failures   int32
+		wantLines  int
+		wantReport string
+	}{
+		{"recovered on the retry pass", 1, 4, ""},
+		{"still failing is reported", 100, 2, `{"target":"example.com","page":1,"error":"HTTP 404"}` + "\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := fakeCDX(t)
+			defer inner.Close()
+			var hits int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.URL.Query().Get("page") == "1" && atomic.AddInt32(&hits, 1) <= tt.failures {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				inner.Config.Handler.ServeHTTP(w, req)
+			}))
+			defer srv.Close()
+
+			report := filepath.Join(t.TempDir(), "failed.jsonl")
+			var buf bytes.Buffer
+			r := newPipelineRunner(t, srv, &Config{Retries: 1, FailedReport: report}, &buf)
+			err := r.Run(context.Background())
+
+			if got := len(outputLines(buf.String())); got != tt.wantLines {
+				t.Errorf("got %d result lines, want %d", got, tt.wantLines)
+			}
+			data, _ := os.ReadFile(report)
+			if string(data) != tt.wantReport {
+				t.Errorf("report = %q, want %q", data, tt.wantReport)
+			}
+			if incomplete := errors.Is(err, errIncomplete); incomplete != (tt.wantReport != "") {
+				t.Errorf("Run error = %v, want incomplete=%v", err, tt.wantReport != "")
+			} else if incomplete && !strings.HasSuffix(err.Error(), ": 1 page(s) failed") {
+				t.Errorf("Run error = %v, want it to count 1 failed page", err)
+			}
+		})
+	}
+}
+
+func TestPipelineSummary(t *testing.T) {
+	inner := fakeCDX(t)
+	defer inner.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("page") == "1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		inner.Config.Handler.ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "summary.json")
+	var buf bytes.Buffer
+	r := newPipelineRunner(t, srv, &Config{Retries: 1, Summary: path}, &buf)
+	r.Run(context.Background())
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read summary: %v", err)
+	}
+	var got struct {
+		Status   string `json:"status"`
+		ExitCode int    `json:"exit_code"`
+		Results  int64  `json:"results"`
+		Targets  []struct {
+			Target         string           `json:"target"`
+			Pattern        string           `json:"pattern"`
+			Status         string           `json:"status"`
+			Pages          int              `json:"pages"`
+			PagesSucceeded int              `json:"pages_succeeded"`
+			PagesFailed    int              `json:"pages_failed"`
+			Requests       int64            `json:"requests"`
+			HTTPStatus     map[string]int64 `json:"http_status"`
+			Results        int64            `json:"results"`
+			Bytes          int64            `json:"bytes"`
+		} `json:"targets"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("parse summary: %v\n%s", err, data)
+	}
+	if got.Status != statusIncomplete || got.ExitCode != exitIncomplete || got.Results != 2 || len(got.Targets) != 1 {
+		t.Fatalf("summary = %+v", got)
+	}
+	ts := got.Targets[0]
+	if ts.Target != "example.com" || ts.Pattern != "example.com*" || ts.Status != statusIncomplete {
+		t.Errorf("target identity/status = %q %q %q", ts.Target, ts.Pattern, ts.Status)
+	}
+	if ts.Pages != 2 || ts.PagesSucceeded != 1 || ts.PagesFailed != 1 || ts.Results != 2 {
+		t.Errorf("pages %d ok %d failed %d results %d; want 2/1/1/2", ts.Pages, ts.PagesSucceeded, ts.PagesFailed, ts.Results)
+	}
+	// Page count + page 0 + page 1 on both passes.
+	if ts.Requests != 4 || ts.HTTPStatus["200"] != 2 || ts.HTTPStatus["404"] != 2 || ts.Bytes == 0 {
+		t.Errorf("requests %d, statuses %v, bytes %d", ts.Requests, ts.HTTPStatus, ts.Bytes)
+	}
+}
+
 // TestPipelineCancelMidFlight drives the pipeline against a server that blocks
 // on each page request, then cancels — exercising the fetch/dispatch/shutdown
 // cancellation paths under the race detector. It must return, not hang.
@@ -36,6 +36,7 @@ type PBar struct {
 	Width      int // preferred bar width; shrunk to fit the terminal
 	DoneStr    string
 	OngoingStr string
+	Unit       string // what an open-ended bar (Total <= 0) counts, e.g. "results"
 
 	mu          sync.Mutex
 	out         *os.File // /dev/tty when available, otherwise nil (disabled)
@@ -72,7 +73,8 @@ func NewPBar(total int, enabled, color bool) *PBar {
 
 // Render updates the bar to curr. No-op without a TTY. Intermediate redraws are
 // throttled to minRenderInterval; the terminal update for curr == Total always
-// draws so the bar reliably reaches 100%.
+// draws so the bar reliably reaches 100%. An open-ended bar (Total <= 0) is
+// always throttled; Finish draws its final count.
 func (p *PBar) Render(curr int) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -80,7 +82,7 @@ func (p *PBar) Render(curr int) {
 	if p.out == nil {
 		return
 	}
-	if curr < p.Total && time.Since(p.lastDraw) < minRenderInterval {
+	if (p.Total <= 0 || curr < p.Total) && time.Since(p.lastDraw) < minRenderInterval {
 		return
 	}
 	p.draw()
@@ -99,7 +101,16 @@ func (p *PBar) draw() {
 	cols := p.columns()
 
 	if p.Total <= 0 {
-		fmt.Fprint(p.out, ansiClearLine, truncateRunes(fmt.Sprintf("Progress: %d", p.curr), cols))
+		// Open-ended: no bar or ETA, just the running count and elapsed time.
+		unit := p.Unit
+		if unit == "" {
+			unit = "done"
+		}
+		line := fmt.Sprintf("%d %s %s", p.curr, unit, formatDuration(time.Since(p.start)))
+		if p.status != "" {
+			line += " [" + p.status + "]"
+		}
+		fmt.Fprint(p.out, ansiClearLine, truncateRunes(line, cols))
 		p.lastDraw = time.Now()
 		return
 	}
@@ -64,6 +64,20 @@ func TestDrawContent(t *testing.T) {
 	}
 }
 
+func TestDrawOpenEnded(t *testing.T) {
+	t.Setenv("COLUMNS", "100")
+	p := &PBar{Total: 0, Unit: "results", start: time.Now().Add(-65 * time.Second)}
+	out := captureDraw(t, p, 1234)
+	for _, want := range []string{"1234 results", "1:05"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("open-ended draw missing %q\ngot: %q", want, out)
+		}
+	}
+	if strings.Contains(out, "eta") || strings.Contains(out, "%") {
+		t.Errorf("open-ended draw should have no ETA or percentage: %q", out)
+	}
+}
+
 func TestFormatDuration(t *testing.T) {
 	tests := []struct {
 		d    time.Duration
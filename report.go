@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
+)
+
+// maxReportRows caps the URL table of --html-report so the page stays usable
+// in a browser; the breakdowns still count every URL.
+const maxReportRows = 50000
+
+// reportFields are the CDX columns --html-report needs, fetched in every
+// output mode when a report is requested.
+var reportFields = []string{cdx.FieldOriginal, cdx.FieldTimestamp, cdx.FieldStatusCode, cdx.FieldMimeType}
+
+// htmlReport collects the results of a whole run for --html-report. Workers
+// add to it concurrently; it is rendered once when the run ends.
+type htmlReport struct {
+	links bool // link rows to Wayback snapshots
+
+	mu       sync.Mutex
+	seen     map[string]struct{}
+	rows     []reportRow
+	total    int
+	hosts    map[string]int
+	statuses map[string]int
+	mimes    map[string]int
+	exts     map[string]int
+}
+
+// reportRow is one URL of the report table. Values are sanitized; the
+// template HTML-escapes them.
+type reportRow struct {
+	URL    string
+	Link   string // Wayback snapshot, or the URL itself for other sources
+	Host   string
+	Status string
+	Mime   string
+	Ext    string
+	Date   string // capture date, yyyy-mm-dd
+}
+
+// reportCount is one bar of a breakdown.
+type reportCount struct {
+	Name string
+	N    int
+	Pct  float64 // share of the largest bar, for its width
+}
+
+func newHTMLReport(links bool) *htmlReport {
+	return &htmlReport{
+		links:    links,
+		seen:     make(map[string]struct{}),
+		hosts:    make(map[string]int),
+		statuses: make(map[string]int),
+		mimes:    make(map[string]int),
+		exts:     make(map[string]int),
+	}
+}
+
+// add records rec under dedup key key, once per run.
+func (h *htmlReport) add(key string, rec cdx.Record) {
+	row := reportRow{
+		URL:    sanitizeForTerminal(rec.Original),
+		Status: sanitizeForTerminal(rec.StatusCode),
+		Mime:   sanitizeForTerminal(rec.MimeType),
+	}
+	row.Link = row.URL
+	if h.links && rec.Timestamp != "" {
+		row.Link = sanitizeForTerminal(rec.SnapshotURL())
+	}
+	if t, err := rec.Time(); err == nil {
+		row.Date = t.Format(time.DateOnly)
+	}
+	if u, err := url.Parse(rec.Original); err == nil {
+		row.Host = sanitizeForTerminal(strings.ToLower(u.Hostname()))
+		row.Ext = sanitizeForTerminal(strings.ToLower(strings.TrimPrefix(path.Ext(u.Path), ".")))
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.seen[key]; ok {
+		return
+	}
+	h.seen[key] = struct{}{}
+	h.total++
+	if len(h.rows) < maxReportRows {
+		h.rows = append(h.rows, row)
+	}
+	if row.Host != "" {
+		h.hosts[row.Host]++
+	}
+	h.statuses[orNone(row.Status)]++
+	h.mimes[orNone(row.Mime)]++
+	h.exts[orNone(row.Ext)]++
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+// breakdown sorts counts by frequency (then name) for display.
+func breakdown(counts map[string]int) []reportCount {
+	out := make([]reportCount, 0, len(counts))
+	top := 0
+	for name, n := range counts {
+		out = append(out, reportCount{Name: name, N: n})
+		top = max(top, n)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].N != out[j].N {
+			return out[i].N > out[j].N
+		}
+		return out[i].Name < out[j].Name
+	})
+	for i := range out {
+		out[i].Pct = float64(out[i].N) * 100 / float64(top)
+	}
+	return out
+}
+
+// writeHTMLReport renders the --html-report file, if set, from what the run
+// collected and its summary.
+func (r *Runner) writeHTMLReport() {
+	if r.cfg.HTMLReport == "" || r.report == nil {
+		return
+	}
+	h := r.report
+	h.mu.Lock()
+	data := struct {
+		Generated string
+		Version   string
+		Summary   runSummary
+		Rows      []reportRow
+		Total     int
+		Hosts     []reportCount
+		Statuses  []reportCount
+		Mimes     []reportCount
+		Exts      []reportCount
+	}{
+		Generated: time.Now().UTC().Format(time.RFC3339),
+		Version:   appVersion(),
+		Summary:   r.summary,
+		Rows:      h.rows,
+		Total:     h.total,
+		Hosts:     breakdown(h.hosts),
+		Statuses:  breakdown(h.statuses),
+		Mimes:     breakdown(h.mimes),
+		Exts:      breakdown(h.exts),
+	}
+	var buf bytes.Buffer
+	err := reportTemplate.Execute(&buf, data)
+	h.mu.Unlock()
+	if err == nil {
+		err = os.WriteFile(r.cfg.HTMLReport, buf.Bytes(), 0o644)
+	}
+	if err != nil {
+		r.log.errf("write HTML report: %v", err)
+		return
+	}
+	r.log.info("wrote HTML report to %s", r.cfg.HTMLReport)
+}
+
+// reportTemplate is the whole --html-report page. Everything is inline so the
+// file works offline and can be mailed around; html/template escapes every
+// archived value for the context it lands in (text, attribute, or URL).
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"seconds": func(s float64) string { return (time.Duration(s * float64(time.Second))).Round(time.Second).String() },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>gowaybackgo report</title>
+<style>
+body{font:14px/1.4 system-ui,sans-serif;margin:0 auto;max-width:1200px;padding:1em 2em;color:#222}
+h1{font-size:1.5em}h2{font-size:1.15em;margin-top:2em;border-bottom:1px solid #ddd}
+table{border-collapse:collapse;width:100%}th,td{text-align:left;padding:.25em .5em;border-bottom:1px solid #eee;vertical-align:top}
+th{background:#f6f6f6;position:sticky;top:0}#urls th{cursor:pointer;user-select:none}
+#urls th[data-dir=asc]::after{content:" \25B2"}#urls th[data-dir=desc]::after{content:" \25BC"}
+td.url{word-break:break-all;font-family:ui-monospace,monospace;font-size:12px}
+.grid{display:grid;grid-template-columns:repeat(auto-fit,minmax(320px,1fr));gap:1.5em}
+.bars td:first-child{width:40%;word-break:break-all}.bars td:last-child{width:60px;text-align:right}
+.bar{background:#4a7bd0;height:.9em;min-width:1px}.muted{color:#777}
+.ok{color:#187a2f}.incomplete,.interrupted{color:#b36b00}.failed{color:#c0262d}
+input{font:inherit;padding:.3em .5em;width:100%;box-sizing:border-box;margin:.5em 0}
+.scroll{max-height:70vh;overflow:auto}ul.hosts{columns:3 220px;font-family:ui-monospace,monospace;font-size:12px}
+</style>
+</head>
+<body>
+<h1>gowaybackgo report</h1>
+<p class="muted">Generated {{.Generated}} by gowaybackgo {{.Version}}.
+Run <span class="{{.Summary.Status}}">{{.Summary.Status}}</span>, {{.Total}} unique URLs, {{seconds .Summary.Duration}}.</p>
+
+<h2>Targets</h2>
+<table>
+<tr><th>Target</th><th>Status</th><th>Pages</th><th>Failed</th><th>Requests</th><th>Retries</th><th>Results</th><th>Duration</th></tr>
+{{range .Summary.Targets}}<tr><td>{{.Target}}</td><td class="{{.Status}}">{{.Status}}{{if .Error}}: {{.Error}}{{end}}</td><td>{{.PagesSucceeded}}/{{.Pages}}</td><td>{{.PagesFailed}}</td><td>{{.Requests}}</td><td>{{.Retries}}</td><td>{{.Results}}</td><td>{{seconds .Duration}}</td></tr>
+{{end}}</table>
+
+<div class="grid">
+<div><h2>Status codes</h2>{{template "bars" .Statuses}}</div>
+<div><h2>MIME types</h2>{{template "bars" .Mimes}}</div>
+<div><h2>Extensions</h2>{{template "bars" .Exts}}</div>
+</div>
+
+<h2>Hosts ({{len .Hosts}})</h2>
+<ul class="hosts">{{range .Hosts}}<li>{{.Name}} <span class="muted">({{.N}})</span></li>{{end}}</ul>
+
+<h2>URLs</h2>
+{{if lt (len .Rows) .Total}}<p class="muted">Showing the first {{len .Rows}} of {{.Total}} URLs; use -o for the full list.</p>{{end}}
+<input id="q" type="search" placeholder="Filter URLs, hosts, statuses, MIME types...">
+<div class="scroll">
+<table id="urls">
+<thead><tr><th>URL</th><th>Host</th><th data-num="1">Status</th><th>MIME</th><th>Ext</th><th>Captured</th></tr></thead>
+<tbody>
+{{range .Rows}}<tr><td class="url"><a href="{{.Link}}" rel="noreferrer noopener" target="_blank">{{.URL}}</a></td><td>{{.Host}}</td><td>{{.Status}}</td><td>{{.Mime}}</td><td>{{.Ext}}</td><td>{{.Date}}</td></tr>
+{{end}}</tbody>
+</table>
+</div>
+<script>
+(function () {
+  var table = document.getElementById("urls"), body = table.tBodies[0], q = document.getElementById("q");
+  var rows = Array.prototype.slice.call(body.rows), timer;
+  q.addEventListener("input", function () {
+    clearTimeout(timer);
+    timer = setTimeout(function () {
+      var v = q.value.toLowerCase();
+      rows.forEach(function (r) { r.style.display = r.textContent.toLowerCase().indexOf(v) < 0 ? "none" : ""; });
+    }, 150);
+  });
+  Array.prototype.forEach.call(table.tHead.rows[0].cells, function (th, i) {
+    th.addEventListener("click", function () {
+      var asc = th.dataset.dir !== "asc", num = th.dataset.num;
+      Array.prototype.forEach.call(table.tHead.rows[0].cells, function (c) { delete c.dataset.dir; });
+      th.dataset.dir = asc ? "asc" : "desc";
+      rows.sort(function (a, b) {
+        var x = a.cells[i].textContent, y = b.cells[i].textContent;
+        var d = num ? (parseInt(x, 10) || 0) - (parseInt(y, 10) || 0) : x.localeCompare(y);
+        return asc ? d : -d;
+      });
+      rows.forEach(function (r) { body.appendChild(r); });
+    });
+  });
+})();
+</script>
+</body>
+</html>
+{{define "bars"}}<table class="bars">{{range .}}<tr><td>{{.Name}}</td><td><div class="bar" style="width:{{printf "%.1f" .Pct}}%"></div></td><td>{{.N}}</td></tr>{{end}}</table>{{end}}
+`))
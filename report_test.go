@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
+)
+
+func TestHTMLReportEscapes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.html")
+	r := &Runner{cfg: &Config{HTMLReport: path}, log: newLogger(true, false)}
+	r.report = newHTMLReport(false)
+	for _, u := range []string{
+		`http://example.com/"><script>alert(1)</script>`,
+		`javascript:alert(document.cookie)`,
+		"http://example.com/a\x1b[31m",
+	} {
+		rec := cdx.Record{Original: u, Timestamp: "20200101000000", StatusCode: "200", MimeType: `text/html"><b>`}
+		r.report.add(u, rec)
+	}
+	r.report.add("dup", cdx.Record{Original: "http://example.com/x.js"})
+	r.report.add("dup", cdx.Record{Original: "http://example.com/x.js"})
+	r.finishRun(statusOK, 0)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read report: %v", err)
+	}
+	html := string(data)
+	for _, bad := range []string{"<script>alert", `href="javascript:`, "\x1b", `"><b>`} {
+		if strings.Contains(html, bad) {
+			t.Errorf("report contains unescaped %q", bad)
+		}
+	}
+	for _, want := range []string{"&lt;script&gt;alert(1)&lt;/script&gt;", "4 unique URLs", "#ZgotmplZ", "example.com"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("report lacks %q", want)
+		}
+	}
+	if strings.Contains(html, "<link") || strings.Contains(html, "src=") {
+		t.Error("report must not reference external assets")
+	}
+}
+
+func TestBreakdown(t *testing.T) {
+	got := breakdown(map[string]int{"200": 6, "404": 3, "301": 3})
+	if len(got) != 3 || got[0].Name != "200" || got[0].Pct != 100 || got[1].Name != "301" || got[2].Pct != 50 {
+		t.Errorf("breakdown = %+v", got)
+	}
+}
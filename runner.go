@@ -2,47 +2,38 @@ package main
 
 import (
 	"bufio"
+	"compress/gzip"
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"net/http"
 	"net/url"
 	"os"
 	"regexp"
-	"strconv"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"text/template"
 	"time"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
 )
 
 // statsInterval is how often --stats prints a progress line.
 const statsInterval = 5 * time.Second
 
-// userAgent is sent on every CDX request. web.archive.org throttles or blocks
-// the default Go client UA, so identify the tool explicitly.
-const userAgent = "gowaybackgo (+github.com/OoS-MaMaD/gowaybackgo)"
-
-// cdxBaseURL is the Wayback CDX endpoint. Held as a Runner field (defaulting
-// here) so tests can point the whole pipeline at a local server.
-const cdxBaseURL = "https://web.archive.org/cdx/search/cdx"
-
 const (
 	colorRed    = "\033[31m"
 	colorYellow = "\033[33m"
 )
 
-// sleepCtx waits for d or until ctx is cancelled. Returns false if cancelled.
-func sleepCtx(ctx context.Context, d time.Duration) bool {
-	select {
-	case <-time.After(d):
-		return true
-	case <-ctx.Done():
-		return false
-	}
-}
-
 // notify surfaces a transient message. When an interactive progress bar is
 // active it shows on the bar's status line; otherwise it goes to the leveled
 // logger (which honors --silent). This keeps the pretty on-bar status for
@@ -59,19 +50,46 @@ func (r *Runner) notify(level logLevel, format string, a ...any) {
 // Runner encapsulates the orchestration needed to fetch CDX pages and process results.
 type Runner struct {
 	cfg            *Config
-	client         *http.Client
-	baseURL        string // CDX endpoint; overridable in tests
+	client         *cdx.Client // CDX API client; its Endpoint is overridable in tests
+	source         cdx.Source  // URL index queried for each target (--source)
 	log            *logger
 	color          bool // ANSI color enabled for progress/logs
 	extRegex       *regexp.Regexp
+	urlFilter      *urlFilter // --match-*/--filter-* regexes; nil when none are set
 	includeMode    bool
 	currentPattern string // target currently being processed (per --stdin domain)
 	baseDomain     string
 	outFile        *os.File
+	outPath        string       // name of outFile, for messages
+	outTemp        string       // temp file outFile really is, renamed to outPath when complete
+	outBase        io.Writer    // outWriter without the output file (stdout)
+	outAppend      bool         // outFile was continued, not truncated (--append, --resume)
+	outStart       outputCounts // run counts when outFile was opened
+	outGzip        *gzip.Writer // compresses outFile (.gz or --compress); nil otherwise
 	outWriter      io.Writer
 	pbar           *PBar
-	found          int64            // results emitted for the current target (atomic)
-	rateLimiter    <-chan time.Time // nil when no rate limiting
+	found          int64               // results emitted for the current target (atomic)
+	cursorMode     bool                // current target is walked with resume keys
+	checkpoint     *checkpoint         // --checkpoint/--resume progress; nil when disabled
+	inflight       sync.WaitGroup      // lines queued and results not yet printed, for syncCheckpoint
+	fetchGate      sync.RWMutex        // read-held while a page queues its lines, for syncCheckpoint
+	known          map[string]struct{} // results already in the output file (--append, --resume)
+	knownHits      int64               // results skipped as already known, current target (atomic)
+	failures       []failure           // work still missing after retries, for the report
+	failuresMu     sync.Mutex
+	summary        runSummary         // --summary document, filled in per target
+	cur            *targetSummary     // summary entry of the current target
+	stats          *cdx.Stats         // HTTP counters for the current target
+	pagesOK        int32              // pages fetched successfully for the current target (atomic)
+	fields         []string           // --csv/--tsv columns
+	tableKeyCol    int                // index of "original" in fields, or -1
+	headerDone     bool               // CSV/TSV header row written
+	tmpl           *template.Template // --template output format; nil otherwise
+	collapse       collapseSpec       // which captures count as one result (--collapse)
+	report         *htmlReport        // --html-report collector; nil when disabled
+	doc            document           // document mode output (--openapi, --har, --burp); nil otherwise
+	bulk           *bulkPoster        // --es-url batches; nil otherwise
+	outDir         *outputDir         // --output-dir files and index; nil otherwise
 }
 
 // NewRunner builds a Runner with compiled filters and output writers prepared.
@@ -81,7 +99,7 @@ func NewRunner(cfg *Config) (*Runner, error) {
 		return nil, fmt.Errorf("compile extension regex: %w", err)
 	}
 
-	client := &http.Client{Timeout: cfg.Timeout}
+	hc := &http.Client{Timeout: cfg.Timeout}
 	// An explicit --proxy wins; otherwise the default transport already honours
 	// HTTP_PROXY/HTTPS_PROXY from the environment.
 	if cfg.Proxy != "" {
@@ -89,49 +107,189 @@ func NewRunner(cfg *Config) (*Runner, error) {
 		if perr != nil {
 			return nil, fmt.Errorf("parse proxy URL %q: %w", cfg.Proxy, perr)
 		}
-		client.Transport = &http.Transport{Proxy: http.ProxyURL(pu)}
+		hc.Transport = &http.Transport{Proxy: http.ProxyURL(pu)}
+	}
+	client := cdx.NewClient(hc)
+	client.Retries = cfg.Retries
+	// One limiter for the whole run: every page fetcher, retry, and target
+	// draws from it, so a 429 slows and pauses them all together. With --rate
+	// 0 it throttles only after push-back, until requests succeed again.
+	client.Limiter = cdx.NewLimiter(cfg.RateLimit, cfg.Burst)
+	if cfg.CacheDir != "" {
+		client.Cache = cdx.NewDiskCache(cfg.CacheDir, cfg.CacheTTL)
+		client.Offline = cfg.Offline
 	}
 
 	// Bar renders to /dev/tty (always a terminal), so its color depends only on
 	// NO_COLOR/--nc. Logs go to stderr, so they additionally require stderr to be
 	// a terminal.
 	noColor := cfg.NoColor || os.Getenv("NO_COLOR") != ""
+	collapse, err := parseCollapse(cfg.EffectiveCollapse())
+	if err != nil {
+		return nil, fmt.Errorf("--collapse: %w", err)
+	}
+	urlFilter, err := newURLFilter(cfg)
+	if err != nil {
+		return nil, err
+	}
 	r := &Runner{
 		cfg:            cfg,
+		collapse:       collapse,
 		client:         client,
-		baseURL:        cdxBaseURL,
 		log:            newLogger(cfg.Silent, !noColor && isTerminal(os.Stderr.Fd())),
 		color:          !noColor,
 		extRegex:       extRegex,
+		urlFilter:      urlFilter,
 		includeMode:    includeMode,
 		currentPattern: cfg.URLPattern,
 		baseDomain:     baseDomainOf(cfg.URLPattern),
 		outWriter:      os.Stdout,
 	}
-
-	// Set up rate limiter using a ticker channel if requested. Floor the interval
-	// at 1ns so an extreme --rate (> 1e9) can't divide to a zero interval, which
-	// would panic NewTicker; such a rate degrades to effectively unlimited.
-	if cfg.RateLimit > 0 {
-		interval := time.Second / time.Duration(cfg.RateLimit)
-		if interval < 1 {
-			interval = 1
+	if cfg.CSV || cfg.TSV {
+		if r.fields, err = parseFields(cfg.Fields); err != nil {
+			return nil, fmt.Errorf("--fields: %w", err)
+		}
+		r.tableKeyCol = -1
+		for i, f := range r.fields {
+			if f == cdx.FieldOriginal {
+				r.tableKeyCol = i
+				break
+			}
 		}
-		r.rateLimiter = time.NewTicker(interval).C
+	}
+	switch {
+	case cfg.OpenAPI:
+		targets := cfg.URLList
+		if len(targets) == 0 {
+			targets = []string{cfg.URLPattern}
+		}
+		r.doc = newOpenAPIDoc(targets)
+	case cfg.HAR:
+		r.doc = newHARDoc(r.waybackLinks())
+	case cfg.Burp:
+		r.doc = newBurpDoc(r.waybackLinks())
+	}
+	if cfg.HTMLReport != "" {
+		r.report = newHTMLReport(r.waybackLinks())
+	}
+	if cfg.ESURL != "" {
+		endpoint, err := bulkURL(cfg.ESURL)
+		if err != nil {
+			return nil, fmt.Errorf("--es-url: %w", err)
+		}
+		// Not through --proxy: that is for reaching the archives, and the
+		// cluster is usually internal.
+		r.bulk = &bulkPoster{
+			url:     endpoint,
+			hc:      &http.Client{Timeout: cfg.Timeout},
+			retries: cfg.Retries,
+			size:    cfg.ESBatch,
+			logf:    r.notify,
+		}
+	}
+	if cfg.Template != "" {
+		if r.tmpl, err = parseTemplate(cfg.Template); err != nil {
+			return nil, fmt.Errorf("--template: %w", err)
+		}
+	}
+	// Retry notices show on the progress bar when one is active.
+	client.Logf = func(format string, a ...any) { r.notify(levelWarn, format, a...) }
+	r.source = newSource(cfg, client)
+
+	if err := r.openCheckpoint(); err != nil {
+		return nil, err
 	}
 
 	if cfg.OutputFile != "" {
-		f, err := os.Create(cfg.OutputFile)
-		if err != nil {
-			return nil, fmt.Errorf("create output file: %w", err)
+		if err := r.openOutput(cfg.OutputFile, cfg.compressOutput(), cfg.Resume != "" || cfg.Append); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.OutputDir != "" {
+		if r.outDir, err = openOutputDir(cfg); err != nil {
+			return nil, fmt.Errorf("--output-dir: %w", err)
 		}
-		r.outFile = f
-		r.outWriter = io.MultiWriter(os.Stdout, f)
 	}
 
 	return r, nil
 }
 
+// openCheckpoint sets up --checkpoint (a fresh progress file) or --resume (an
+// existing one, which keeps being updated). A resumed run writes to the output
+// file recorded in the checkpoint; naming a different one is an error, since
+// dedup against the earlier results would silently not apply.
+func (r *Runner) openCheckpoint() error {
+	cfg := r.cfg
+	switch {
+	case cfg.Resume != "":
+		cp, err := loadCheckpoint(cfg.Resume)
+		if err != nil {
+			return fmt.Errorf("load checkpoint: %w", err)
+		}
+		if cfg.OutputFile == "" {
+			cfg.OutputFile = cp.Output
+		}
+		if cfg.OutputFile != cp.Output {
+			return fmt.Errorf("checkpoint %s was written for output %q, not %q", cfg.Resume, cp.Output, cfg.OutputFile)
+		}
+		r.checkpoint = cp
+	case cfg.Checkpoint != "":
+		r.checkpoint = newCheckpoint(cfg.Checkpoint, cfg.OutputFile)
+	}
+	return nil
+}
+
+// checkpointEvery is how many pages (or cursor batches) of a target complete
+// between checkpoint saves, so a crash costs at most that much refetching.
+const checkpointEvery = 20
+
+// syncCheckpoint saves progress in the middle of a target. Pages count as
+// done once their lines are queued, before their results are written, so it
+// first stops page fetchers from queueing more and waits until everything
+// queued has been printed: the checkpoint then covers only written results.
+func (r *Runner) syncCheckpoint() {
+	if r.checkpoint == nil {
+		return
+	}
+	r.fetchGate.Lock()
+	defer r.fetchGate.Unlock()
+	r.inflight.Wait()
+	r.saveCheckpoint()
+}
+
+// checkpointQuery identifies what the current target is fetched with, so
+// checkpointed progress is only reused for the same query: the index and the
+// CDX parameters, which decide what each page or batch holds.
+func (r *Runner) checkpointQuery() string {
+	sum := sha1.Sum(fmt.Appendf(nil, "%s\x00%s\x00%s\x00%+v", r.sourceName(), r.cfg.CCIndexes, r.cfg.TimeMaps, r.query()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// saveCheckpoint persists progress, warning rather than failing the run when
+// the checkpoint cannot be written. The output is synced first, so the
+// checkpoint never covers results a crash could still lose.
+func (r *Runner) saveCheckpoint() {
+	if r.checkpoint == nil {
+		return
+	}
+	r.syncOutput()
+	if err := r.checkpoint.save(); err != nil {
+		r.log.warn("save checkpoint: %v", err)
+	}
+}
+
+// newSource returns the URL index selected by --source. Every source shares the
+// client's transport, so proxy, timeout, retries, and user agent apply alike.
+func newSource(cfg *Config, client *cdx.Client) cdx.Source {
+	switch cfg.Source {
+	case sourceCommonCrawl:
+		return cdx.NewCommonCrawl(client, splitCSV(cfg.CCIndexes)...)
+	case sourceTimeMap:
+		return cdx.NewTimeMap(client, splitCSV(cfg.TimeMaps)...)
+	}
+	return client
+}
+
 // Run executes the full fetch/process/print pipeline.
 // If multiple URLList entries are set (via --stdin), each domain is processed
 // sequentially so results are not interleaved.
@@ -146,6 +304,8 @@ func (r *Runner) Run(ctx context.Context) error {
 	// left later domains writing to a closed handle through the MultiWriter,
 	// which silently dropped their output.
 	defer r.closeOutput()
+	r.summary.Started = time.Now()
+	r.summary.RunID = newRunID(r.summary.Started)
 
 	var lastErr error
 	failed := 0
@@ -157,20 +317,68 @@ func (r *Runner) Run(ctx context.Context) error {
 		// Point the run at the current domain without mutating shared Config.
 		r.currentPattern = domain
 		r.baseDomain = baseDomainOf(domain)
-		if err := r.runSingle(ctx); err != nil {
+		if r.checkpoint.useQuery(domain, r.checkpointQuery()) {
+			r.log.warn("checkpointed progress for %s was made with other flags or another source; starting it over", domain)
+		}
+		if r.checkpoint.isDone(domain) {
+			r.log.info("skipping %s: completed in checkpoint", domain)
+			r.skipTarget(domain)
+			continue
+		}
+		ts := r.beginTarget(domain)
+		err := r.openTargetOutput(domain)
+		if err == nil {
+			err = r.runSingle(ctx)
+		}
+		if ctx.Err() != nil {
+			err = nil // cancellation is reported as interrupted, not failed
+		}
+		r.endTarget(ctx, ts, err)
+		r.closeTargetOutput(ts)
+		// Save after every target, including one cut short by Ctrl-C, so
+		// --resume picks up from the last completed page.
+		r.saveCheckpoint()
+		if err != nil {
 			if ctx.Err() != nil {
 				break // cancelled mid-domain: stop cleanly
 			}
 			// One domain failing shouldn't abandon the rest of a --stdin batch.
 			r.log.errf("processing %q: %v", domain, err)
+			r.recordFailure(domain, -1, "", err)
 			lastErr = err
 			failed++
 		}
 	}
-	// Surface an error (non-zero exit) only when every domain failed; a partial
-	// batch still exits 0 so the domains that succeeded are honored.
-	if lastErr != nil && failed == len(domains) {
+	// Every domain failing is a plain error. Anything less, including pages
+	// that failed within a domain, is reported as an incomplete dataset with
+	// its own exit status, so the domains that succeeded are still honored but
+	// a partial result is never mistaken for a full one.
+	r.writeDocument()
+	var missing []string
+	if desc := r.reportFailures(); desc != "" {
+		missing = append(missing, desc+" failed")
+	}
+	if r.bulk != nil {
+		// Documents the cluster lacks make the indexed dataset incomplete.
+		if r.summary.ESBulk = r.bulk.report(); r.summary.ESBulk.Failed > 0 {
+			missing = append(missing, fmt.Sprintf("%d document(s) not indexed", r.summary.ESBulk.Failed))
+		}
+	}
+	switch {
+	case lastErr != nil && failed == len(domains):
+		r.finishRun(statusFailed, 1)
 		return lastErr
+	case len(missing) > 0:
+		status := statusIncomplete
+		if ctx.Err() != nil {
+			status = statusInterrupted
+		}
+		r.finishRun(status, exitIncomplete)
+		return fmt.Errorf("%w: %s", errIncomplete, strings.Join(missing, ", "))
+	case ctx.Err() != nil:
+		r.finishRun(statusInterrupted, 0)
+	default:
+		r.finishRun(statusOK, 0)
 	}
 	return nil
 }
@@ -179,71 +387,219 @@ func (r *Runner) runSingle(ctx context.Context) error {
 	// Reset so the page-count phase (before the bar exists) logs to stderr rather
 	// than through a previous domain's finished bar. found is per-target.
 	r.pbar = nil
+	r.cursorMode = false
 	atomic.StoreInt64(&r.found, 0)
 
-	pages, err := r.fetchPageCount(ctx)
+	cs, canCursor := r.source.(cdx.CursorSource)
+	if r.cfg.Cursor && canCursor {
+		return r.runCursor(ctx, cs)
+	}
+
+	// The source retries like page fetches do; a transient 429/5xx on the count
+	// request must not abort the domain. r.pbar is nil here, so retry messages
+	// go to stderr.
+	pages, err := r.source.NumPages(ctx, r.query())
+	if errors.Is(err, cdx.ErrBadPageCount) {
+		// Guessing a single page would silently truncate a large target, so
+		// walk it with resume keys when the source supports that.
+		if canCursor {
+			r.log.warn("%v; walking results with resume keys instead", err)
+			return r.runCursor(ctx, cs)
+		}
+		r.log.warn("%v, defaulting to 1 page", err)
+		pages, err = 1, nil
+	}
 	if err != nil {
 		return err
 	}
 
 	if pages <= 0 {
 		r.log.info("no pages reported by CDX for %s; nothing to do", r.currentPattern)
+		r.checkpoint.finish(r.currentPattern)
 		return nil
 	}
 
-	// The bar is for interactive runs; --silent and --stats suppress it.
-	r.pbar = NewPBar(pages, !r.cfg.Silent && !r.cfg.Stats, r.color)
-	r.pbar.Render(0)
+	r.cur.Pages = pages
+	done, changed := r.checkpoint.startPages(r.currentPattern, pages)
+	r.cur.PagesResumed = len(done)
+	if changed {
+		r.log.warn("page count for %s changed since the checkpoint; fetching every page again", r.currentPattern)
+	} else if len(done) > 0 {
+		r.log.info("resuming %s: %d/%d pages already fetched", r.currentPattern, len(done), pages)
+	}
+
+	r.runPipeline(ctx, pages, func(jobs chan<- string, pagesCompleted *int32) {
+		// Pages a resumed checkpoint already covers count as done.
+		todo := make([]int, 0, pages)
+		for p := 0; p < pages; p++ {
+			if done[p] {
+				atomic.AddInt32(pagesCompleted, 1)
+				continue
+			}
+			todo = append(todo, p)
+		}
+		failed := r.fetchPages(ctx, todo, jobs, pagesCompleted)
+
+		// Pages that exhausted their retries get one more pass once the rest
+		// are in, after a longer pause: by then a rate-limit or outage has
+		// often cleared. Their lines are deduped against the first attempt.
+		if len(failed) > 0 && ctx.Err() == nil {
+			r.notify(levelWarn, "%d page(s) failed; retrying them in %s", len(failed), r.cfg.RetryDelay)
+			retry := make([]int, len(failed))
+			for i, f := range failed {
+				retry[i] = f.page
+			}
+			select {
+			case <-time.After(r.cfg.RetryDelay):
+				failed = r.fetchPages(ctx, retry, jobs, nil)
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			return // interrupted: the checkpoint, not the report, covers it
+		}
+		for _, f := range failed {
+			r.recordFailure(r.currentPattern, f.page, "", f.err)
+		}
+	})
+	// Failed pages leave the target open so a resumed run retries them.
+	if ctx.Err() == nil && r.checkpoint.allPagesDone(r.currentPattern) {
+		r.checkpoint.finish(r.currentPattern)
+	}
+	return nil
+}
+
+// runCursor walks the current target with resume keys (showResumeKey) rather
+// than page numbers: one sequential request per batch of --cursor-limit
+// results, until the server stops returning a key. The total is unknown up
+// front, so progress is reported in results found.
+func (r *Runner) runCursor(ctx context.Context, cs cdx.CursorSource) error {
+	r.cursorMode = true
+	q := r.query()
+	q.Limit = r.cfg.CursorLimit
+
+	var walkErr error
+	failedKey := ""
+	finished, retried := false, false
+	r.runPipeline(ctx, 0, func(jobs chan<- string, batches *int32) {
+		key := r.checkpoint.resumeKey(r.currentPattern)
+		if key != "" {
+			r.log.info("resuming %s from its checkpointed resume key", r.currentPattern)
+		}
+		for ctx.Err() == nil {
+			next, err := cs.Cursor(ctx, q, key, func(line string) error {
+				r.inflight.Add(1)
+				jobs <- line
+				return nil
+			})
+			if err != nil && !retried && ctx.Err() == nil {
+				// Like a failed page, a batch that exhausted its retries gets
+				// one more attempt after a longer pause. The walk can't go on
+				// without its key, so that happens right away. Lines it
+				// already passed on are deduped against the second attempt.
+				retried = true
+				r.notify(levelWarn, "cursor batch failed: %v; retrying it in %s", err, r.cfg.RetryDelay)
+				select {
+				case <-time.After(r.cfg.RetryDelay):
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				walkErr = err
+				failedKey = key
+				if key == "" {
+					failedKey = firstBatchKey
+				}
+				return
+			}
+			retried = false
+			atomic.AddInt32(batches, 1)
+			atomic.AddInt32(&r.pagesOK, 1)
+			r.cur.Pages++
+			r.renderProgress(batches)
+			if next == "" || next == key {
+				finished = true
+				return
+			}
+			key = next
+			r.checkpoint.setResumeKey(r.currentPattern, key)
+			if r.cur.Pages%checkpointEvery == 0 {
+				r.syncCheckpoint()
+			}
+		}
+	})
+	if finished {
+		r.checkpoint.finish(r.currentPattern)
+	}
+	if walkErr != nil && ctx.Err() == nil {
+		// Results before the failed batch were already printed, so this is
+		// an incomplete target rather than a failed one.
+		r.notify(levelError, "walk CDX results: %v", walkErr)
+		r.cur.Pages++
+		r.recordFailure(r.currentPattern, -1, failedKey, fmt.Errorf("walk CDX results: %w", walkErr))
+	}
+	return nil
+}
+
+// pageWorkers returns the page-fetcher count. Clamped defensively; validate()
+// already rejects < 1, but this keeps a directly-constructed Runner from
+// panicking on a negative channel size.
+func (r *Runner) pageWorkers() int {
+	if r.cfg.PageWorkers < 1 {
+		return 1
+	}
+	return r.cfg.PageWorkers
+}
 
-	// Clamp defensively; validate() already rejects < 1, but this keeps a
-	// directly-constructed Runner from panicking on a negative channel size.
-	pageWorkers := r.cfg.PageWorkers
-	if pageWorkers < 1 {
-		pageWorkers = 1
+// runPipeline runs feed, which sends raw CDX lines to jobs and counts the
+// pages (or cursor batches) it completes, through the worker pool and the
+// printer, returning once everything fed has been printed. total is the page
+// count for the progress bar; 0 makes the bar an open-ended results counter.
+func (r *Runner) runPipeline(ctx context.Context, total int, feed func(jobs chan<- string, completed *int32)) {
+	// The bar is for interactive runs; --silent and --stats suppress it.
+	r.pbar = NewPBar(total, !r.cfg.Silent && !r.cfg.Stats, r.color)
+	if total <= 0 {
+		r.pbar.Unit = "results"
 	}
+	r.pbar.Render(0)
 
 	// Size the jobs channel to twice the number of page workers so fetchers are
 	// never blocked for long, but memory use stays bounded.
-	jobsBuf := pageWorkers * 2
+	jobsBuf := r.pageWorkers() * 2
 	if jobsBuf < 64 {
 		jobsBuf = 64
 	}
-
-	pageJobs := make(chan int, pageWorkers)
 	jobs := make(chan string, jobsBuf)
 	resultsCh := make(chan string, jobsBuf)
 
-	var pagesCompleted int32
-	fetchWg := r.startPageFetchers(ctx, pageJobs, jobs, &pagesCompleted)
+	var completed int32
 	workerWg := r.startWorkers(jobs, resultsCh)
-	printWg := r.startPrinter(resultsCh, &pagesCompleted)
+	printWg := r.startPrinter(ctx, resultsCh, &completed)
 
 	// --stats prints periodic progress to stderr; stop it when the run ends.
 	if r.cfg.Stats && !r.cfg.Silent {
-		defer r.startStats(ctx, pages, &pagesCompleted)()
+		defer r.startStats(ctx, total, &completed)()
 	}
 
-	// Dispatch page numbers, but stop early if the run is cancelled. Without the
-	// ctx.Done() case, a cancellation that drains all fetchers would leave this
-	// send blocking forever once pageJobs fills, deadlocking shutdown.
-dispatch:
-	for p := 0; p < pages; p++ {
-		select {
-		case pageJobs <- p:
-		case <-ctx.Done():
-			break dispatch
-		}
-	}
-	close(pageJobs)
-
-	fetchWg.Wait()
+	feed(jobs, &completed)
 	close(jobs)
 	workerWg.Wait()
 	close(resultsCh)
 	printWg.Wait()
 
 	r.pbar.Finish()
-	return nil
+}
+
+// renderProgress redraws the bar: pages completed normally, results found in
+// cursor mode, where the number of batches is not known in advance.
+func (r *Runner) renderProgress(pagesCompleted *int32) {
+	if r.cursorMode {
+		r.pbar.Render(int(atomic.LoadInt64(&r.found)))
+		return
+	}
+	r.pbar.Render(int(atomic.LoadInt32(pagesCompleted)))
 }
 
 // startStats launches a goroutine that periodically reports progress on stderr
@@ -258,6 +614,12 @@ func (r *Runner) startStats(ctx context.Context, pages int, pagesCompleted *int3
 		for {
 			select {
 			case <-t.C:
+				if pages <= 0 {
+					r.log.info("progress: %d batches, %d found, %s elapsed",
+						atomic.LoadInt32(pagesCompleted),
+						atomic.LoadInt64(&r.found), formatDuration(time.Since(start)))
+					continue
+				}
 				r.log.info("progress: %d/%d pages, %d found, %s elapsed",
 					atomic.LoadInt32(pagesCompleted), pages,
 					atomic.LoadInt64(&r.found), formatDuration(time.Since(start)))
@@ -272,205 +634,200 @@ func (r *Runner) startStats(ctx context.Context, pages int, pagesCompleted *int3
 	return func() { once.Do(func() { close(stop) }) }
 }
 
+// jsonFields is the CDX column list requested in JSON mode, in the order
+// parseCDXRecord expects.
+var jsonFields = []string{
+	cdx.FieldOriginal, cdx.FieldTimestamp, cdx.FieldStatusCode, cdx.FieldMimeType,
+	cdx.FieldDigest, cdx.FieldLength, cdx.FieldURLKey,
+}
+
 // cdxFields returns the CDX fl= column list for the current output mode. JSON
-// mode needs the extra metadata columns; every other mode only prints the URL.
-func (r *Runner) cdxFields() string {
-	if r.cfg.JSON {
-		return "original,timestamp,statuscode,mimetype"
+// and template modes need the extra metadata columns, and the timeline only
+// the timestamp; every other mode only prints the URL. --html-report adds the
+// columns it tabulates.
+func (r *Runner) cdxFields() []string {
+	var cols []string
+	switch {
+	case r.cfg.Timeline:
+		cols = []string{cdx.FieldOriginal, cdx.FieldTimestamp}
+	case r.cfg.documentMode():
+		cols = reportFields
+	case r.cfg.JSON || r.cfg.Template != "" || r.cfg.ESBulk:
+		cols = jsonFields
+	case r.cfg.CSV || r.cfg.TSV:
+		cols = tableCDXFields(r.fields)
+		if f := r.collapse.field(); f != "" && !slices.Contains(cols, f) {
+			cols = append(cols, f) // needed for the dedup key, not printed
+		}
+	case r.cfg.SmartDedupLatest:
+		cols = []string{cdx.FieldOriginal, cdx.FieldTimestamp}
+	default:
+		cols = []string{cdx.FieldOriginal}
+	}
+	if r.report != nil {
+		// Appended after the mode's own columns, which keep their positions.
+		for _, f := range reportFields {
+			if !slices.Contains(cols, f) {
+				cols = append(slices.Clip(cols), f)
+			}
+		}
 	}
-	return "original"
+	return cols
 }
 
-// cdxFilters returns the CDX filter= params derived from --status/--mime.
+// cdxFilters returns the CDX filter= params derived from --status/--mime
+// and --cdx-filter. The server requires every filter to hold.
 func (r *Runner) cdxFilters() []string {
-	var f []string
-	if r.cfg.Status != "" {
-		f = append(f, "statuscode:"+r.cfg.Status)
-	}
-	if r.cfg.Mime != "" {
-		f = append(f, "mimetype:"+r.cfg.Mime)
-	}
-	return f
+	f := fieldFilters(cdx.FieldStatusCode, r.cfg.Status)
+	f = append(f, fieldFilters(cdx.FieldMimeType, r.cfg.Mime)...)
+	return append(f, r.cfg.CDXFilters...)
 }
 
-// cdxURL builds a CDX API request URL. When numPages is true it asks only for
-// the page count; otherwise it requests a specific results page. from/to/status/
-// mime filters apply to both so the page count matches the fetched results.
-func (r *Runner) cdxURL(page int, numPages bool) string {
-	v := url.Values{}
-	v.Set("url", normalizeURLForCDX(r.currentPattern, r.cfg.Subs))
-	if numPages {
-		v.Set("showNumPages", "true")
-	} else {
-		v.Set("fl", r.cdxFields())
-		v.Set("collapse", "urlkey")
-		v.Set("page", strconv.Itoa(page))
+// fieldFilters turns the values of a repeatable --status/--mime flag into
+// filter= params on field: the plain values joined in one alternation, as any
+// of them may match, and one negated filter per "!value", as none may.
+func fieldFilters(field string, values []string) []string {
+	var keep, f []string
+	for _, v := range values {
+		if neg, ok := strings.CutPrefix(v, "!"); ok {
+			f = append(f, "!"+field+":"+neg)
+			continue
+		}
+		keep = append(keep, v)
 	}
-	if r.cfg.From != "" {
-		v.Set("from", r.cfg.From)
+	switch len(keep) {
+	case 0:
+		return f
+	case 1:
+		return append([]string{field + ":" + keep[0]}, f...)
 	}
-	if r.cfg.To != "" {
-		v.Set("to", r.cfg.To)
+	return append([]string{field + ":(" + strings.Join(keep, "|") + ")"}, f...)
+}
+
+// cdxFilterFields are the fields --cdx-filter accepts. The Common Crawl
+// source translates their names for its server.
+var cdxFilterFields = []string{
+	cdx.FieldOriginal, cdx.FieldURLKey, cdx.FieldDigest, cdx.FieldLength,
+	cdx.FieldStatusCode, cdx.FieldMimeType,
+}
+
+// checkCDXFilter checks that f is a "[!]field:regex" filter on a supported
+// field. The regex is left to the server, whose syntax is not Go's.
+func checkCDXFilter(f string) error {
+	name, expr, ok := strings.Cut(strings.TrimPrefix(f, "!"), ":")
+	switch {
+	case !ok || expr == "":
+		return fmt.Errorf("%q is not [!]field:regex", f)
+	case !slices.Contains(cdxFilterFields, name):
+		return fmt.Errorf("unknown field %q in %q (want one of %s)", name, f, strings.Join(cdxFilterFields, ", "))
 	}
-	for _, f := range r.cdxFilters() {
-		v.Add("filter", f)
+	return nil
+}
+
+// query builds the CDX query for the current target. from/to/status/mime
+// filters apply to both the page count and the page fetches, so the count
+// matches the fetched results.
+func (r *Runner) query() cdx.Query {
+	return cdx.Query{
+		URL:      normalizeURLForCDX(r.currentPattern, r.cfg.Subs),
+		From:     r.cfg.From,
+		To:       r.cfg.To,
+		Filters:  r.cdxFilters(),
+		Fields:   r.cdxFields(),
+		Collapse: r.collapse.param(),
 	}
-	return r.baseURL + "?" + v.Encode()
 }
 
-func (r *Runner) fetchPageCount(ctx context.Context) (int, error) {
-	// Retry like page fetches do; a transient 429/5xx on the count request must
-	// not abort the domain. r.pbar is nil here, so retry messages go to stderr.
-	resp, err := r.fetchWithRetry(ctx, r.cdxURL(0, true), nil)
-	if err != nil {
-		return 0, fmt.Errorf("fetch page count: %w", err)
+// pageFailure is a page whose fetch failed after all of the client's retries.
+type pageFailure struct {
+	page int
+	err  error
+}
+
+// fetchPages fetches pages with the page-worker pool, sending their lines to
+// jobs, and returns the pages that failed in page order. pagesCompleted, when
+// non-nil, is advanced for every page attempted (failed ones included) to
+// drive the progress bar; the retry pass passes nil so pages aren't counted
+// twice.
+func (r *Runner) fetchPages(ctx context.Context, pages []int, jobs chan<- string, pagesCompleted *int32) []pageFailure {
+	var (
+		mu     sync.Mutex
+		failed []pageFailure
+	)
+	onFail := func(p int, err error) {
+		mu.Lock()
+		failed = append(failed, pageFailure{p, err})
+		mu.Unlock()
 	}
-	defer resp.Body.Close()
+	pageJobs := make(chan int, r.pageWorkers())
+	fetchWg := r.startPageFetchers(ctx, pageJobs, jobs, pagesCompleted, onFail)
 
-	scanner := bufio.NewScanner(resp.Body)
-	numStr := ""
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			numStr = line
-			break
+	// Dispatch page numbers, but stop early if the run is cancelled. Without
+	// the ctx.Done() case, a cancellation that drains all fetchers would
+	// leave this send blocking forever once pageJobs fills, deadlocking
+	// shutdown.
+dispatch:
+	for _, p := range pages {
+		select {
+		case pageJobs <- p:
+		case <-ctx.Done():
+			break dispatch
 		}
 	}
-	if err := scanner.Err(); err != nil {
-		return 0, fmt.Errorf("read page-count response: %w", err)
-	}
+	close(pageJobs)
+	fetchWg.Wait()
 
-	if numStr == "" {
-		return 0, nil
-	}
-	pages, err := strconv.Atoi(numStr)
-	if err != nil {
-		r.log.warn("could not parse page count (%s), defaulting to 1 page", sanitizeForTerminal(numStr))
-		return 1, nil
-	}
-	return pages, nil
+	sort.Slice(failed, func(i, j int) bool { return failed[i].page < failed[j].page })
+	return failed
 }
 
-func (r *Runner) startPageFetchers(ctx context.Context, pageJobs <-chan int, jobs chan<- string, pagesCompleted *int32) *sync.WaitGroup {
+func (r *Runner) startPageFetchers(ctx context.Context, pageJobs <-chan int, jobs chan<- string, pagesCompleted *int32, onFail func(page int, err error)) *sync.WaitGroup {
 	var fetchWg sync.WaitGroup
-	pageConcurrency := r.cfg.PageWorkers
-	if pageConcurrency < 1 {
-		pageConcurrency = 1
-	}
+	pageConcurrency := r.pageWorkers()
 
+	q := r.query()
 	fetchWg.Add(pageConcurrency)
 	for i := 0; i < pageConcurrency; i++ {
 		go func() {
 			defer fetchWg.Done()
 			for p := range pageJobs {
-				// Honour context cancellation before dispatching each page.
+				// Honour context cancellation before dispatching each page. Rate
+				// limiting happens per request inside the client.
 				if ctx.Err() != nil {
 					return
 				}
 
-				// Apply rate limiting if configured.
-				if r.rateLimiter != nil {
-					select {
-					case <-r.rateLimiter:
-					case <-ctx.Done():
-						return
-					}
+				r.fetchGate.RLock()
+				err := r.source.Page(ctx, q, p, func(line string) error {
+					r.inflight.Add(1)
+					jobs <- line
+					return nil
+				})
+				done := 0
+				if err == nil {
+					done = r.checkpoint.pageDone(r.currentPattern, p)
 				}
-
-				pageURL := r.cdxURL(p, false)
-
-				respP, ierr := r.fetchWithRetry(ctx, pageURL, pagesCompleted)
-				if ierr != nil || respP == nil {
-					r.notify(levelError, "fetching CDX page %d: %v", p, ierr)
-					atomic.AddInt32(pagesCompleted, 1)
-					r.pbar.Render(int(atomic.LoadInt32(pagesCompleted)))
-					continue
+				r.fetchGate.RUnlock()
+				switch {
+				case err == nil:
+					atomic.AddInt32(&r.pagesOK, 1)
+				case ctx.Err() == nil:
+					r.notify(levelError, "fetching CDX page %d: %v", p, err)
+					onFail(p, err)
 				}
-
-				sc := bufio.NewScanner(respP.Body)
-				sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
-				for sc.Scan() {
-					line := strings.TrimSpace(sc.Text())
-					if line != "" {
-						jobs <- line
-					}
+				if pagesCompleted != nil {
+					atomic.AddInt32(pagesCompleted, 1)
+					r.renderProgress(pagesCompleted)
 				}
-				if err := sc.Err(); err != nil {
-					r.notify(levelWarn, "error reading CDX page %d: %v", p, err)
-					r.pbar.Render(int(atomic.LoadInt32(pagesCompleted)))
+				if done > 0 && done%checkpointEvery == 0 {
+					r.syncCheckpoint()
 				}
-				respP.Body.Close()
-				atomic.AddInt32(pagesCompleted, 1)
-				r.pbar.Render(int(atomic.LoadInt32(pagesCompleted)))
 			}
 		}()
 	}
 	return &fetchWg
 }
 
-// fetchWithRetry attempts up to cfg.Retries fetches with exponential back-off.
-// It surfaces non-2xx HTTP status codes as errors and respects context
-// cancellation between attempts.
-func (r *Runner) fetchWithRetry(ctx context.Context, pageURL string, pagesCompleted *int32) (*http.Response, error) {
-	var lastErr error
-	maxRetries := r.cfg.Retries
-	if maxRetries < 1 {
-		maxRetries = 1
-	}
-
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		// Check context before every attempt.
-		if ctx.Err() != nil {
-			return nil, ctx.Err()
-		}
-
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
-		if err != nil {
-			return nil, err // non-retryable
-		}
-		req.Header.Set("User-Agent", userAgent)
-
-		resp, err := r.client.Do(req)
-		switch {
-		case err != nil:
-			lastErr = err
-		case resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices:
-			return resp, nil
-		default:
-			lastErr = fmt.Errorf("HTTP %d", resp.StatusCode)
-			resp.Body.Close()
-
-			// 429 (rate limited) and 5xx are transient: long back-off then retry.
-			if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
-				backoff := time.Duration(attempt*attempt) * time.Second // 1s, 4s, 9s
-				r.notify(levelWarn, "HTTP %d on page fetch; backing off %s (attempt %d/%d)",
-					resp.StatusCode, backoff, attempt, maxRetries)
-				if !sleepCtx(ctx, backoff) {
-					return nil, ctx.Err()
-				}
-				continue
-			}
-			// Other 4xx won't change on retry — fail fast.
-			if resp.StatusCode >= 400 {
-				return nil, lastErr
-			}
-		}
-
-		if attempt < maxRetries {
-			backoff := time.Duration(attempt) * time.Second
-			r.notify(levelWarn, "retrying page fetch (attempt %d/%d): %v",
-				attempt, maxRetries, lastErr)
-			if pagesCompleted != nil && r.pbar != nil {
-				r.pbar.Render(int(atomic.LoadInt32(pagesCompleted)))
-			}
-			if !sleepCtx(ctx, backoff) {
-				return nil, ctx.Err()
-			}
-		}
-	}
-	return nil, lastErr
-}
-
 func (r *Runner) startWorkers(jobs <-chan string, resultsCh chan<- string) *sync.WaitGroup {
 	var workerWg sync.WaitGroup
 	workerCount := r.cfg.Workers
@@ -484,24 +841,39 @@ func (r *Runner) startWorkers(jobs <-chan string, resultsCh chan<- string) *sync
 			defer workerWg.Done()
 			for line := range jobs {
 				for _, processed := range r.processLine(line) {
+					r.inflight.Add(1) // before the line's own count is released
 					resultsCh <- processed
 				}
+				r.inflight.Done()
 			}
 		}()
 	}
 	return &workerWg
 }
 
+// waybackLinks reports whether records come from the Wayback Machine, so
+// that snapshot and replay links to web.archive.org point at real captures.
+func (r *Runner) waybackLinks() bool {
+	return r.cfg.Source == "" || r.cfg.Source == sourceWayback
+}
+
+// recordMode reports whether the output mode prints whole CDX records rather
+// than a URL or a part of one.
+func (r *Runner) recordMode() bool {
+	return r.cfg.JSON || r.cfg.CSV || r.cfg.TSV || r.cfg.Template != "" || r.cfg.Timeline || r.cfg.ESBulk || r.cfg.documentMode()
+}
+
 func (r *Runner) processLine(line string) []string {
 	line = strings.TrimSpace(line)
 	if line == "" {
 		return nil
 	}
 
-	// In JSON mode the CDX line carries several space-separated columns; the URL
-	// is the first. Filter on it and pass the whole record through for printJSON.
+	// In record modes (JSON, CSV/TSV, template, timeline, bulk, documents) the CDX line carries several
+	// space-separated columns; the URL is the first. Filter on it and pass the
+	// whole record through to the printer.
 	rawURL := line
-	if r.cfg.JSON {
+	if r.recordMode() || r.report != nil || r.cfg.SmartDedupLatest {
 		if fields := strings.Fields(line); len(fields) > 0 {
 			rawURL = fields[0]
 		}
@@ -524,9 +896,21 @@ func (r *Runner) processLine(line string) []string {
 		}
 	}
 
-	if r.cfg.JSON {
+	if r.urlFilter != nil && !r.urlFilter.keep(rawURL, u) {
+		return nil
+	}
+
+	if r.report != nil {
+		if rec, ok := cdx.ParseRecord(line, r.cdxFields()); ok {
+			r.report.add(r.collapse.key(rec), rec)
+		}
+	}
+
+	if r.recordMode() {
 		return []string{line}
 	}
+	record := line
+	line = rawURL // --html-report columns are not printed
 
 	if r.cfg.OnlyQuery {
 		if err == nil && u.RawQuery != "" {
@@ -562,25 +946,71 @@ func (r *Runner) processLine(line string) []string {
 
 	if r.cfg.NoQuery && err == nil {
 		u.RawQuery = ""
-		return []string{u.String()}
+		line = u.String()
 	}
 
+	if r.cfg.SmartDedupLatest {
+		// printLatestShapes needs the capture time to pick the newest URL.
+		if rec, ok := cdx.ParseRecord(record, r.cdxFields()); ok && rec.Timestamp != "" {
+			line += " " + rec.Timestamp
+		}
+	}
 	return []string{line}
 }
 
-func (r *Runner) startPrinter(resultsCh <-chan string, pagesCompleted *int32) *sync.WaitGroup {
+// results ranges over resultsCh for a printer, counting each result as
+// handled once the printer is done with it (see syncCheckpoint). Printers
+// read every result; none stops early.
+func (r *Runner) results(resultsCh <-chan string) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for res := range resultsCh {
+			more := yield(res)
+			r.inflight.Done()
+			if !more {
+				return
+			}
+		}
+	}
+}
+
+func (r *Runner) startPrinter(ctx context.Context, resultsCh <-chan string, pagesCompleted *int32) *sync.WaitGroup {
 	var printWg sync.WaitGroup
 	printWg.Add(1)
 
 	go func() {
 		defer printWg.Done()
+		if r.doc != nil {
+			r.printDocument(resultsCh, pagesCompleted)
+			return
+		}
+
 		bufw := bufio.NewWriter(r.outWriter)
 
+		if r.cfg.Timeline {
+			r.printTimeline(bufw, resultsCh, pagesCompleted)
+			return
+		}
+
 		if r.cfg.JSON {
 			r.printJSON(bufw, resultsCh, pagesCompleted)
 			return
 		}
 
+		if r.cfg.ESBulk {
+			r.printESBulk(ctx, bufw, resultsCh, pagesCompleted)
+			return
+		}
+
+		if r.cfg.CSV || r.cfg.TSV {
+			r.printTable(bufw, resultsCh, pagesCompleted)
+			return
+		}
+
+		if r.tmpl != nil {
+			r.printTemplate(bufw, resultsCh, pagesCompleted)
+			return
+		}
+
 		if r.cfg.Subs {
 			r.printSubdomains(bufw, resultsCh, pagesCompleted)
 			return
@@ -598,52 +1028,66 @@ func (r *Runner) startPrinter(resultsCh <-chan string, pagesCompleted *int32) *s
 }
 
 // jsonRecord is one JSONL output line. Empty metadata fields are omitted.
+// Records are deduplicated per --collapse, by URL unless set otherwise.
 type jsonRecord struct {
 	URL       string `json:"url"`
 	Timestamp string `json:"timestamp,omitempty"`
+	Time      string `json:"time,omitempty"` // Timestamp as ISO 8601 (RFC 3339, UTC)
 	Status    string `json:"status,omitempty"`
 	Mime      string `json:"mime,omitempty"`
+	Length    string `json:"length,omitempty"`
+	Digest    string `json:"digest,omitempty"`
+	URLKey    string `json:"urlkey,omitempty"`
+	Replay    string `json:"replay,omitempty"` // raw capture on web.archive.org (id_)
+}
+
+// capture returns the columns of rec that identify a capture for dedup.
+func (rec jsonRecord) capture() cdx.Record {
+	return cdx.Record{Original: rec.URL, Timestamp: rec.Timestamp, Digest: rec.Digest}
 }
 
-// parseCDXRecord turns a CDX line (columns original,timestamp,statuscode,
-// mimetype) into a jsonRecord. Untrusted string fields are sanitized; CDX uses
-// "-" for a missing value, which is dropped. Returns ok=false for blank lines.
+// parseCDXRecord turns a CDX line (jsonFields columns) into a jsonRecord.
+// Untrusted string fields are sanitized; CDX uses "-" for a missing value,
+// which is dropped. time and replay are derived from the timestamp and URL.
+// Returns ok=false for blank lines.
 func parseCDXRecord(line string) (jsonRecord, bool) {
-	fields := strings.Fields(line)
-	if len(fields) == 0 {
+	rec, ok := cdx.ParseRecord(line, jsonFields)
+	if !ok || rec.Original == "" {
 		return jsonRecord{}, false
 	}
-	rec := jsonRecord{URL: sanitizeForTerminal(fields[0])}
-	get := func(i int) string {
-		if i < len(fields) && fields[i] != "-" {
-			return sanitizeForTerminal(fields[i])
-		}
-		return ""
+	out := jsonRecord{
+		URL:       sanitizeForTerminal(rec.Original),
+		Timestamp: sanitizeForTerminal(rec.Timestamp),
+		Status:    sanitizeForTerminal(rec.StatusCode),
+		Mime:      sanitizeForTerminal(rec.MimeType),
+		Length:    sanitizeForTerminal(rec.Length),
+		Digest:    sanitizeForTerminal(rec.Digest),
+		URLKey:    sanitizeForTerminal(rec.URLKey),
+		Replay:    sanitizeForTerminal(rec.ReplayURL()),
+	}
+	if t, err := rec.Time(); err == nil {
+		out.Time = t.Format(time.RFC3339)
 	}
-	rec.Timestamp = get(1)
-	rec.Status = get(2)
-	rec.Mime = get(3)
-	return rec, rec.URL != ""
+	return out, true
 }
 
 func (r *Runner) printJSON(bufw *bufio.Writer, resultsCh <-chan string, pagesCompleted *int32) {
 	enc := json.NewEncoder(bufw)
 	enc.SetEscapeHTML(false)
-	seen := make(map[string]struct{})
-	for res := range resultsCh {
+	seen := r.newDedup()
+	for res := range r.results(resultsCh) {
 		rec, ok := parseCDXRecord(res)
-		if !ok {
+		if !ok || !seen.add(r.collapse.key(rec.capture())) {
 			continue
 		}
-		if _, dup := seen[rec.URL]; dup {
-			continue
+		if !r.waybackLinks() {
+			rec.Replay = "" // not a Wayback capture
 		}
-		seen[rec.URL] = struct{}{}
 		r.pbar.ClearLine()
 		enc.Encode(rec) // Encode appends a newline, giving JSONL output
 		bufw.Flush()    // stream each record live rather than buffering
 		atomic.AddInt64(&r.found, 1)
-		r.pbar.Render(int(atomic.LoadInt32(pagesCompleted)))
+		r.renderProgress(pagesCompleted)
 	}
 	r.finishOutput(bufw)
 }
@@ -652,9 +1096,9 @@ func (r *Runner) printSubdomains(bufw *bufio.Writer, resultsCh <-chan string, pa
 	if r.baseDomain == "" {
 		return
 	}
-	seenSubs := make(map[string]struct{})
+	seenSubs := r.newDedup()
 	baseLower := strings.ToLower(r.baseDomain)
-	for res := range resultsCh {
+	for res := range r.results(resultsCh) {
 		u, err := url.Parse(res)
 		if err != nil {
 			continue
@@ -668,10 +1112,9 @@ func (r *Runner) printSubdomains(bufw *bufio.Writer, resultsCh <-chan string, pa
 			continue
 		}
 		if strings.HasSuffix(host, "."+baseLower) {
-			if _, ok := seenSubs[host]; ok {
+			if !seenSubs.add(host) {
 				continue
 			}
-			seenSubs[host] = struct{}{}
 			r.writeWithProgress(bufw, host, pagesCompleted)
 		}
 	}
@@ -679,8 +1122,8 @@ func (r *Runner) printSubdomains(bufw *bufio.Writer, resultsCh <-chan string, pa
 }
 
 func (r *Runner) printPaths(bufw *bufio.Writer, resultsCh <-chan string, pagesCompleted *int32) {
-	seenSeg := make(map[string]struct{})
-	for res := range resultsCh {
+	seenSeg := r.newDedup()
+	for res := range r.results(resultsCh) {
 		u, err := url.Parse(res)
 		if err != nil || u.Path == "" {
 			continue
@@ -691,10 +1134,9 @@ func (r *Runner) printPaths(bufw *bufio.Writer, resultsCh <-chan string, pagesCo
 			if seg == "" {
 				continue
 			}
-			if _, ok := seenSeg[seg]; ok {
+			if !seenSeg.add(seg) {
 				continue
 			}
-			seenSeg[seg] = struct{}{}
 			r.writeWithProgress(bufw, seg, pagesCompleted)
 		}
 	}
@@ -702,17 +1144,59 @@ func (r *Runner) printPaths(bufw *bufio.Writer, resultsCh <-chan string, pagesCo
 }
 
 func (r *Runner) printDefault(bufw *bufio.Writer, resultsCh <-chan string, pagesCompleted *int32) {
-	seen := make(map[string]struct{})
-	for res := range resultsCh {
-		if _, ok := seen[res]; ok {
+	if r.cfg.SmartDedupLatest {
+		r.printLatestShapes(bufw, resultsCh, pagesCompleted)
+		return
+	}
+	seen := r.newDedup()
+	for res := range r.results(resultsCh) {
+		key := res
+		if r.cfg.SmartDedup {
+			key = urlShape(res) // the first URL of each shape stands for it
+		}
+		if !seen.add(key) {
 			continue
 		}
-		seen[res] = struct{}{}
 		r.writeWithProgress(bufw, res, pagesCompleted)
 	}
 	r.finishOutput(bufw)
 }
 
+// dedup tracks the results a printer has already emitted for the current
+// target, plus those a resumed output file already holds.
+type dedup struct {
+	seen  map[string]struct{}
+	known map[string]struct{} // shared, read-only; keys as written (sanitized)
+	hits  *int64              // counts results found in known (atomic)
+}
+
+func (r *Runner) newDedup() *dedup {
+	return &dedup{seen: make(map[string]struct{}), known: r.known, hits: &r.knownHits}
+}
+
+// add records key and reports whether it is new.
+func (d *dedup) add(key string) bool {
+	if _, ok := d.seen[key]; ok {
+		return false
+	}
+	d.seen[key] = struct{}{}
+	if len(d.known) > 0 {
+		if _, ok := d.known[sanitizeForTerminal(key)]; ok {
+			if d.hits != nil {
+				atomic.AddInt64(d.hits, 1)
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// isKnown reports whether key was already in the output file.
+func (d *dedup) isKnown(key string) bool {
+	_, ok := d.known[key]
+	return ok
+}
+
 func (r *Runner) writeWithProgress(bufw *bufio.Writer, value string, pagesCompleted *int32) {
 	r.pbar.ClearLine()
 	fmt.Fprintln(bufw, sanitizeForTerminal(value))
@@ -721,7 +1205,7 @@ func (r *Runner) writeWithProgress(bufw *bufio.Writer, value string, pagesComple
 	// error is surfaced once by finishOutput; a per-line error is ignored here.
 	bufw.Flush()
 	atomic.AddInt64(&r.found, 1)
-	r.pbar.Render(int(atomic.LoadInt32(pagesCompleted)))
+	r.renderProgress(pagesCompleted)
 }
 
 // finishOutput flushes the per-domain buffered writer. The underlying file is
@@ -733,14 +1217,3 @@ func (r *Runner) finishOutput(bufw *bufio.Writer) {
 		r.log.warn("error writing output: %v", err)
 	}
 }
-
-// closeOutput closes the output file once, at the end of the run, and reports
-// where results were saved (to stderr, so stdout stays a clean result stream).
-// Safe to call when no output file is configured.
-func (r *Runner) closeOutput() {
-	if r.outFile != nil {
-		r.outFile.Close()
-		r.outFile = nil
-		r.log.info("saved results to %s", r.cfg.OutputFile)
-	}
-}
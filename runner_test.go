@@ -1,26 +1,26 @@
 package main
 
 import (
-	"context"
-	"fmt"
-	"net/http"
-	"net/http/httptest"
 	"net/url"
 	"reflect"
-	"sync/atomic"
 	"testing"
-	"time"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
 )
 
 // newTestRunner builds a Runner wired only with the fields processLine reads,
-// compiling the extension regex the same way NewRunner does.
+// compiling the extension regex and URL filter the same way NewRunner does.
 func newTestRunner(t *testing.T, cfg *Config) *Runner {
 	t.Helper()
 	re, includeMode, err := CompileExtRegex(cfg.IncludeExt, cfg.EffectiveExclude())
 	if err != nil {
 		t.Fatalf("CompileExtRegex: %v", err)
 	}
-	return &Runner{cfg: cfg, extRegex: re, includeMode: includeMode}
+	filter, err := newURLFilter(cfg)
+	if err != nil {
+		t.Fatalf("newURLFilter: %v", err)
+	}
+	return &Runner{cfg: cfg, extRegex: re, urlFilter: filter, includeMode: includeMode}
 }
 
 func TestProcessLine(t *testing.T) {
@@ -114,6 +114,30 @@ func TestProcessLine(t *testing.T) {
 			line: "http://example.com/app.js 20200101 200 application/javascript",
 			want: nil,
 		},
+		{
+			name: "match-regex keeps matching url",
+			cfg:  &Config{MatchRegex: []string{"/admin", "/internal"}},
+			line: "http://example.com/internal/users",
+			want: []string{"http://example.com/internal/users"},
+		},
+		{
+			name: "match-regex drops other urls",
+			cfg:  &Config{MatchRegex: []string{"/admin", "/internal"}},
+			line: "http://example.com/about",
+			want: nil,
+		},
+		{
+			name: "filter-regex drops before only-query",
+			cfg:  &Config{OnlyQuery: true, FilterRegex: []string{"/static/"}},
+			line: "http://example.com/static/x?v=1",
+			want: nil,
+		},
+		{
+			name: "json mode matches path of url field",
+			cfg:  &Config{JSON: true, MatchPath: []string{"^/api/"}},
+			line: "http://example.com/api/v1 20200101 200 text/html",
+			want: []string{"http://example.com/api/v1 20200101 200 text/html"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -138,19 +162,29 @@ func TestParseCDXRecord(t *testing.T) {
 		{
 			"full record",
 			"http://x/a 20200101 200 text/html",
-			jsonRecord{URL: "http://x/a", Timestamp: "20200101", Status: "200", Mime: "text/html"},
+			jsonRecord{URL: "http://x/a", Timestamp: "20200101", Time: "2020-01-01T00:00:00Z", Status: "200", Mime: "text/html",
+				Replay: "https://web.archive.org/web/20200101id_/http://x/a"},
+			true,
+		},
+		{
+			"all columns",
+			"http://x/a 20200102030405 200 text/html SHA1ABC 1234 x)/a",
+			jsonRecord{URL: "http://x/a", Timestamp: "20200102030405", Time: "2020-01-02T03:04:05Z", Status: "200",
+				Mime: "text/html", Digest: "SHA1ABC", Length: "1234", URLKey: "x)/a",
+				Replay: "https://web.archive.org/web/20200102030405id_/http://x/a"},
 			true,
 		},
 		{
 			"missing fields are dashes",
-			"http://x/a - 200 -",
+			"http://x/a - 200 - - - -",
 			jsonRecord{URL: "http://x/a", Status: "200"},
 			true,
 		},
 		{
 			"control chars stripped from url",
 			"http://x/\x1b[31m 20200101 200 text/html",
-			jsonRecord{URL: "http://x/[31m", Timestamp: "20200101", Status: "200", Mime: "text/html"},
+			jsonRecord{URL: "http://x/[31m", Timestamp: "20200101", Time: "2020-01-01T00:00:00Z", Status: "200", Mime: "text/html",
+				Replay: "https://web.archive.org/web/20200101id_/http://x/[31m"},
 			true,
 		},
 	}
@@ -173,22 +207,22 @@ func TestCDXURL(t *testing.T) {
 			JSON:   true,
 			From:   "2020",
 			To:     "2022",
-			Status: "200",
-			Mime:   "text/html",
+			Status: []string{"200"},
+			Mime:   []string{"text/html"},
 		},
-		baseURL:        cdxBaseURL,
+		client:         cdx.NewClient(nil),
 		currentPattern: "https://example.com/api",
 	}
 
 	t.Run("page request", func(t *testing.T) {
-		u, err := url.Parse(r.cdxURL(3, false))
+		u, err := url.Parse(r.client.PageURL(r.query(), 3))
 		if err != nil {
 			t.Fatalf("parse: %v", err)
 		}
 		q := u.Query()
 		checks := map[string]string{
 			"url":      "example.com/api*",
-			"fl":       "original,timestamp,statuscode,mimetype",
+			"fl":       "original,timestamp,statuscode,mimetype,digest,length,urlkey",
 			"collapse": "urlkey",
 			"page":     "3",
 			"from":     "2020",
@@ -214,7 +248,7 @@ func TestCDXURL(t *testing.T) {
 	})
 
 	t.Run("page-count request omits paging fields", func(t *testing.T) {
-		u, err := url.Parse(r.cdxURL(0, true))
+		u, err := url.Parse(r.client.NumPagesURL(r.query()))
 		if err != nil {
 			t.Fatalf("parse: %v", err)
 		}
@@ -232,61 +266,68 @@ func TestCDXURL(t *testing.T) {
 	})
 }
 
-func TestFetchWithRetry(t *testing.T) {
-	t.Run("success returns response without retry and sends UA", func(t *testing.T) {
-		var hits int32
-		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			atomic.AddInt32(&hits, 1)
-			if req.Header.Get("User-Agent") != userAgent {
-				t.Errorf("User-Agent = %q, want %q", req.Header.Get("User-Agent"), userAgent)
+func TestCDXFilters(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want []string
+	}{
+		{"none", Config{}, nil},
+		{"single status", Config{Status: []string{"200"}}, []string{"statuscode:200"}},
+		{"repeated status is any of", Config{Status: []string{"200", "3.."}}, []string{"statuscode:(200|3..)"}},
+		{"negated status", Config{Status: []string{"!404"}}, []string{"!statuscode:404"}},
+		{"negations each apply", Config{Status: []string{"2..", "!204", "!206"}}, []string{"statuscode:2..", "!statuscode:204", "!statuscode:206"}},
+		{"negated mime", Config{Mime: []string{"!image/.*"}}, []string{"!mimetype:image/.*"}},
+		{"raw filters last", Config{Status: []string{"200"}, CDXFilters: []string{"!digest:3I42H3S6.*", "length:[0-9]{4,}"}},
+			[]string{"statuscode:200", "!digest:3I42H3S6.*", "length:[0-9]{4,}"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Runner{cfg: &tt.cfg}
+			if got := r.cdxFilters(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cdxFilters() = %q, want %q", got, tt.want)
 			}
-			fmt.Fprintln(w, "ok")
-		}))
-		defer srv.Close()
-		r := &Runner{client: srv.Client(), cfg: &Config{Retries: 3}, log: newLogger(false, false)}
-		resp, err := r.fetchWithRetry(context.Background(), srv.URL, nil)
-		if err != nil {
-			t.Fatalf("unexpected error: %v", err)
-		}
-		resp.Body.Close()
-		if got := atomic.LoadInt32(&hits); got != 1 {
-			t.Errorf("hits = %d, want 1", got)
-		}
-	})
-
-	t.Run("404 fails fast without retrying", func(t *testing.T) {
-		var hits int32
-		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			atomic.AddInt32(&hits, 1)
-			w.WriteHeader(http.StatusNotFound)
-		}))
-		defer srv.Close()
-		r := &Runner{client: srv.Client(), cfg: &Config{Retries: 3}, log: newLogger(false, false)}
-		if _, err := r.fetchWithRetry(context.Background(), srv.URL, nil); err == nil {
-			t.Fatal("expected an error for HTTP 404")
-		}
-		if got := atomic.LoadInt32(&hits); got != 1 {
-			t.Errorf("hits = %d, want 1 (a 404 must not be retried)", got)
-		}
-	})
+		})
+	}
+}
 
-	t.Run("already-cancelled context returns immediately", func(t *testing.T) {
-		ctx, cancel := context.WithCancel(context.Background())
-		cancel()
-		r := &Runner{client: http.DefaultClient, cfg: &Config{Retries: 3}, log: newLogger(false, false)}
-		if _, err := r.fetchWithRetry(ctx, "http://example.invalid", nil); err == nil {
-			t.Fatal("expected an error on a cancelled context")
+func TestCheckCDXFilter(t *testing.T) {
+	tests := []struct {
+		filter  string
+		wantErr bool
+	}{
+		{"original:.*/admin.*", false},
+		{"!urlkey:com,example\\)/static.*", false},
+		{"length:[0-9]{6,}", false},
+		{"!statuscode:404", false},
+		{"digest", true},
+		{"length:", true},
+		{"host:example.com", true},
+		{"!:x", true},
+	}
+	for _, tt := range tests {
+		if err := checkCDXFilter(tt.filter); (err != nil) != tt.wantErr {
+			t.Errorf("checkCDXFilter(%q) error = %v, wantErr %v", tt.filter, err, tt.wantErr)
 		}
-	})
+	}
 }
 
-func TestSleepCtx(t *testing.T) {
-	if !sleepCtx(context.Background(), time.Millisecond) {
-		t.Error("sleepCtx should return true after the delay elapses")
+func TestDescribeFailures(t *testing.T) {
+	target := failure{Target: "a.com", Page: -1}
+	batch := failure{Target: "b.com", Page: -1, ResumeKey: "key"}
+	page := failure{Target: "c.com", Page: 3}
+	tests := []struct {
+		fs   []failure
+		want string
+	}{
+		{nil, ""},
+		{[]failure{page, page}, "2 page(s)"},
+		{[]failure{target, page}, "1 target(s) and 1 page(s)"},
+		{[]failure{page, batch, target, target}, "2 target(s), 1 cursor batch(es) and 1 page(s)"},
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	cancel()
-	if sleepCtx(ctx, time.Hour) {
-		t.Error("sleepCtx should return false when the context is cancelled")
+	for _, tt := range tests {
+		if got := describeFailures(tt.fs); got != tt.want {
+			t.Errorf("describeFailures(%v) = %q, want %q", tt.fs, got, tt.want)
+		}
 	}
 }
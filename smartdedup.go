@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// minSlugWords is how many hyphen-separated words make a path segment a
+// content slug (how-to-reset-a-password) on its own. After a numeric segment,
+// as in dated archives (/2019/01/post-a), two are enough.
+const minSlugWords = 4
+
+// urlShape returns the --smart-dedup key of a URL: scheme and host, the path
+// with numeric, UUID, and hash segments and content slugs replaced by
+// placeholders, and the sorted query keys without their values. URLs with the
+// same shape are variations of one endpoint or page template. A URL that does
+// not parse is its own shape.
+func urlShape(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	segs := strings.Split(u.EscapedPath(), "/")
+	afterNumber := false
+	for i, seg := range segs {
+		s, err := url.PathUnescape(seg)
+		if err != nil {
+			s = seg
+		}
+		kind := segmentKind(s)
+		switch {
+		case kind != segStatic:
+			segs[i] = "{" + kind + "}"
+		case isSlug(s, afterNumber):
+			segs[i] = "{slug}" + slugExt(s)
+		}
+		afterNumber = kind == segInt
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host))
+	b.WriteString(strings.Join(segs, "/"))
+	if u.RawQuery != "" {
+		var keys []string
+		for _, pair := range strings.FieldsFunc(u.RawQuery, func(r rune) bool { return r == '&' || r == ';' }) {
+			k, _, _ := strings.Cut(pair, "=")
+			if un, err := url.QueryUnescape(k); err == nil {
+				k = un
+			}
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		b.WriteString("?" + strings.Join(slices.Compact(keys), "&"))
+	}
+	return b.String()
+}
+
+// slugExt returns the file extension of a slug segment ("" if none), so
+// /post-a.html and /post-a.pdf keep distinct shapes.
+func slugExt(seg string) string {
+	if i := strings.LastIndexByte(seg, '.'); i > 0 {
+		return seg[i:]
+	}
+	return ""
+}
+
+// isSlug reports whether seg reads as a content slug: lowercase words and
+// numbers joined by hyphens, at least minSlugWords of them, or two after a
+// numeric segment.
+func isSlug(seg string, afterNumber bool) bool {
+	seg = strings.TrimSuffix(seg, slugExt(seg))
+	words := strings.Split(seg, "-")
+	if len(words) < 2 || (len(words) < minSlugWords && !afterNumber) {
+		return false
+	}
+	for _, w := range words {
+		if w == "" || strings.Trim(w, "abcdefghijklmnopqrstuvwxyz0123456789") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// shapeRep is the URL kept for a shape by --smart-dedup-latest.
+type shapeRep struct {
+	url, timestamp string
+}
+
+// printLatestShapes is the default printer under --smart-dedup-latest: it
+// keeps the most recently captured URL of each shape and writes them, in the
+// order the shapes were first seen, once the target's results are all in.
+// Results arrive from processLine as "url timestamp".
+func (r *Runner) printLatestShapes(bufw *bufio.Writer, resultsCh <-chan string, pagesCompleted *int32) {
+	var order []string
+	latest := make(map[string]shapeRep)
+	for res := range r.results(resultsCh) {
+		u, ts, _ := strings.Cut(res, " ")
+		key := urlShape(u)
+		if rep, ok := latest[key]; !ok {
+			order = append(order, key)
+		} else if ts <= rep.timestamp {
+			continue
+		}
+		latest[key] = shapeRep{u, ts}
+		r.renderProgress(pagesCompleted)
+	}
+	seen := r.newDedup()
+	for _, key := range order {
+		if seen.add(key) {
+			r.writeWithProgress(bufw, latest[key].url, pagesCompleted)
+		}
+	}
+	r.finishOutput(bufw)
+}
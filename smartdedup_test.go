@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestURLShape(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"query values", "http://example.com/item?id=1", "http://example.com/item?id=2", true},
+		{"query key order and repeats", "http://example.com/s?q=a&page=2&q=b", "http://example.com/s?page=9&q=c", true},
+		{"different query keys", "http://example.com/item?id=1", "http://example.com/item?ref=1", false},
+		{"no query vs query", "http://example.com/item", "http://example.com/item?id=1", false},
+		{"numeric segment", "http://example.com/users/17/edit", "http://example.com/users/4211/edit", true},
+		{"uuid segment", "http://example.com/o/0b6e0f6c-3b1a-4a53-9f66-2c1f5e9c2a10", "http://example.com/o/5f2b1e4c-0d9a-4c8e-8a3b-7e6d5c4b3a21", true},
+		{"hash segment", "http://example.com/f/d41d8cd98f00b204e9800998ecf8427e", "http://example.com/f/9e107d9d372bb6826bd81d3542a419d6", true},
+		{"dated post slugs", "http://example.com/blog/2019/01/post-a", "http://example.com/blog/2019/02/post-b", true},
+		{"long slugs", "http://example.com/news/how-to-reset-a-password", "http://example.com/news/new-office-opens-in-berlin", true},
+		{"slug extension kept", "http://example.com/2020/post-a.html", "http://example.com/2020/post-b.pdf", false},
+		{"short names are routes", "http://example.com/api/user-profile", "http://example.com/api/user-settings", false},
+		{"static segments differ", "http://example.com/about", "http://example.com/contact", false},
+		{"host case", "http://Example.COM/a", "http://example.com/a", true},
+		{"fragment ignored", "http://example.com/a#top", "http://example.com/a#bottom", true},
+		{"hosts differ", "http://a.example.com/x?id=1", "http://b.example.com/x?id=1", false},
+		{"scheme differs", "http://example.com/x", "https://example.com/x", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := urlShape(tt.a), urlShape(tt.b)
+			if (a == b) != tt.same {
+				t.Errorf("urlShape(%q) = %q, urlShape(%q) = %q; same = %v, want %v", tt.a, a, tt.b, b, a == b, tt.same)
+			}
+		})
+	}
+}
+
+func TestURLShapeUnparsable(t *testing.T) {
+	if got := urlShape("not a url"); got != "not a url" {
+		t.Errorf("urlShape = %q, want the input unchanged", got)
+	}
+}
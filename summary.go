@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
+)
+
+// Target and run statuses reported by --summary.
+const (
+	statusOK          = "ok"          // everything fetched
+	statusIncomplete  = "incomplete"  // finished, but some pages still failed
+	statusFailed      = "failed"      // nothing usable (e.g. the page count failed)
+	statusInterrupted = "interrupted" // cancelled by Ctrl-C/SIGTERM
+	statusSkipped     = "skipped"     // already completed per --resume checkpoint
+)
+
+// runSummary is the --summary document: one entry per target plus an overall
+// verdict, so orchestration can decide whether to re-run or alert without
+// parsing log lines.
+type runSummary struct {
+	Status   string          `json:"status"`
+	ExitCode int             `json:"exit_code"`
+	RunID    string          `json:"run_id"` // also tags --es-bulk documents
+	Started  time.Time       `json:"started"`
+	Duration float64         `json:"duration_seconds"`
+	Results  int64           `json:"results"`
+	Known    int64           `json:"known,omitempty"`   // results the output already held
+	ESBulk   *bulkSummary    `json:"es_bulk,omitempty"` // --es-url only
+	Targets  []targetSummary `json:"targets"`
+}
+
+// bulkSummary is what a run sent to --es-url.
+type bulkSummary struct {
+	Indexed int `json:"indexed"`
+	Failed  int `json:"failed"` // rejected, or in batches that could not be sent
+}
+
+// targetSummary describes one target. In --cursor mode pages are resume-key
+// batches, and a failed batch counts as a failed page.
+type targetSummary struct {
+	Target         string        `json:"target"`
+	Pattern        string        `json:"pattern"` // url= sent to the index
+	Status         string        `json:"status"`
+	Error          string        `json:"error,omitempty"`
+	Cursor         bool          `json:"cursor,omitempty"`
+	Pages          int           `json:"pages"`
+	PagesSucceeded int           `json:"pages_succeeded"`
+	PagesFailed    int           `json:"pages_failed"`
+	PagesResumed   int           `json:"pages_resumed,omitempty"` // done in an earlier run
+	Requests       int64         `json:"requests"`
+	Retries        int64         `json:"retries"`
+	CacheHits      int64         `json:"cache_hits,omitempty"`
+	HTTPStatus     map[int]int64 `json:"http_status"`
+	Results        int64         `json:"results"`
+	Known          int64         `json:"known,omitempty"` // skipped: already in the output (--append, --resume)
+	Bytes          int64         `json:"bytes"`
+	Duration       float64       `json:"duration_seconds"`
+	start          time.Time
+	failuresBefore int
+}
+
+// beginTarget starts the summary entry for the current target (r.cur), giving
+// the client fresh counters so the figures are per target.
+func (r *Runner) beginTarget(target string) *targetSummary {
+	r.stats = &cdx.Stats{}
+	r.client.Stats = r.stats
+	atomic.StoreInt32(&r.pagesOK, 0)
+	atomic.StoreInt64(&r.knownHits, 0)
+	r.failuresMu.Lock()
+	before := len(r.failures)
+	r.failuresMu.Unlock()
+	r.cur = &targetSummary{
+		Target:         target,
+		Pattern:        r.query().URL,
+		start:          time.Now(),
+		failuresBefore: before,
+	}
+	return r.cur
+}
+
+// endTarget completes ts from the counters once the target has been run, and
+// adds it to the summary.
+func (r *Runner) endTarget(ctx context.Context, ts *targetSummary, err error) {
+	ts.Duration = time.Since(ts.start).Seconds()
+	ts.Requests = r.stats.Requests.Load()
+	ts.Retries = r.stats.Retries.Load()
+	ts.CacheHits = r.stats.CacheHits.Load()
+	ts.Bytes = r.stats.Bytes.Load()
+	ts.HTTPStatus = r.stats.Statuses()
+	ts.Results = atomic.LoadInt64(&r.found)
+	ts.Known = atomic.LoadInt64(&r.knownHits)
+	ts.Cursor = r.cursorMode
+	ts.PagesSucceeded = int(atomic.LoadInt32(&r.pagesOK))
+
+	r.failuresMu.Lock()
+	incomplete := false
+	for _, f := range r.failures[ts.failuresBefore:] {
+		incomplete = true
+		if f.Page >= 0 || f.ResumeKey != "" {
+			ts.PagesFailed++
+		}
+	}
+	r.failuresMu.Unlock()
+
+	switch {
+	case err != nil:
+		ts.Status, ts.Error = statusFailed, err.Error()
+	case ctx.Err() != nil:
+		ts.Status = statusInterrupted
+	case incomplete:
+		ts.Status = statusIncomplete
+	default:
+		ts.Status = statusOK
+	}
+	r.summary.Targets = append(r.summary.Targets, *ts)
+	r.summary.Results += ts.Results
+	r.summary.Known += ts.Known
+}
+
+// skipTarget records a target the checkpoint says is already complete.
+func (r *Runner) skipTarget(target string) {
+	r.summary.Targets = append(r.summary.Targets, targetSummary{
+		Target:     target,
+		Pattern:    normalizeURLForCDX(target, r.cfg.Subs),
+		Status:     statusSkipped,
+		HTTPStatus: map[int]int64{},
+	})
+}
+
+// finishRun records the run's outcome in the summary and writes the
+// --summary and --html-report files, if set.
+func (r *Runner) finishRun(status string, exitCode int) {
+	r.summary.Status = status
+	r.summary.ExitCode = exitCode
+	r.summary.Duration = time.Since(r.summary.Started).Seconds()
+	if r.summary.Targets == nil {
+		r.summary.Targets = []targetSummary{}
+	}
+	r.writeSummary()
+	r.writeHTMLReport()
+}
+
+// writeSummary writes the finalized run summary to --summary, if set.
+func (r *Runner) writeSummary() {
+	if r.cfg.Summary == "" {
+		return
+	}
+	data, err := json.MarshalIndent(r.summary, "", "  ")
+	if err == nil {
+		err = os.WriteFile(r.cfg.Summary, append(data, '\n'), 0o644)
+	}
+	if err != nil {
+		r.log.errf("write summary: %v", err)
+	}
+}
+
+// newRunID returns an ID for the run started at t: the start time plus a
+// random suffix, so runs started in the same second still differ.
+func newRunID(t time.Time) string {
+	var b [4]byte
+	rand.Read(b[:])
+	return t.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b[:])
+}
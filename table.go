@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
+)
+
+// Derived columns available to --fields in addition to the CDX ones. They are
+// computed locally from the original URL (and timestamp, for snapshot).
+const (
+	fieldHost      = "host"
+	fieldPath      = "path"
+	fieldQuery     = "query"
+	fieldExtension = "extension"
+	fieldSnapshot  = "snapshot"
+)
+
+// defaultTableFields are the --csv/--tsv columns when --fields is not set;
+// the same record JSON mode prints.
+const defaultTableFields = "original,timestamp,statuscode,mimetype"
+
+// fieldAliases maps accepted --fields names to canonical column names. The
+// JSON key names (url, status, mime) and "ext" are accepted for convenience.
+var fieldAliases = map[string]string{
+	cdx.FieldOriginal: cdx.FieldOriginal, "url": cdx.FieldOriginal,
+	cdx.FieldTimestamp:  cdx.FieldTimestamp,
+	cdx.FieldStatusCode: cdx.FieldStatusCode, "status": cdx.FieldStatusCode,
+	cdx.FieldMimeType: cdx.FieldMimeType, "mime": cdx.FieldMimeType,
+	cdx.FieldDigest: cdx.FieldDigest,
+	cdx.FieldLength: cdx.FieldLength,
+	cdx.FieldURLKey: cdx.FieldURLKey,
+	fieldHost:       fieldHost,
+	fieldPath:       fieldPath,
+	fieldQuery:      fieldQuery,
+	fieldExtension:  fieldExtension, "ext": fieldExtension,
+	fieldSnapshot: fieldSnapshot,
+}
+
+// parseFields resolves a --fields list to canonical column names, rejecting
+// unknown names. An empty list selects defaultTableFields.
+func parseFields(list string) ([]string, error) {
+	names := splitCSV(list)
+	if len(names) == 0 {
+		names = splitCSV(defaultTableFields)
+	}
+	out := make([]string, 0, len(names))
+	for _, n := range names {
+		canon, ok := fieldAliases[strings.ToLower(n)]
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q (CDX: original, timestamp, statuscode, mimetype, digest, length, urlkey; derived: host, path, query, extension, snapshot)", n)
+		}
+		out = append(out, canon)
+	}
+	return out, nil
+}
+
+// tableCDXFields returns the CDX columns needed to render fields. original
+// always comes first: processLine filters on the first column's URL, and the
+// derived columns are computed from it.
+func tableCDXFields(fields []string) []string {
+	cols := []string{cdx.FieldOriginal}
+	have := map[string]bool{cdx.FieldOriginal: true}
+	add := func(c string) {
+		if !have[c] {
+			have[c] = true
+			cols = append(cols, c)
+		}
+	}
+	for _, f := range fields {
+		switch f {
+		case fieldHost, fieldPath, fieldQuery, fieldExtension:
+		case fieldSnapshot:
+			add(cdx.FieldTimestamp)
+		default:
+			add(f)
+		}
+	}
+	return cols
+}
+
+// fieldValue returns column f of rec. u is rec.Original parsed (nil if it
+// does not parse). snapshot is only filled for the Wayback source, the only
+// one whose captures have Wayback snapshot URLs.
+func (r *Runner) fieldValue(f string, rec cdx.Record, u *url.URL) string {
+	switch f {
+	case fieldHost:
+		if u != nil {
+			return u.Hostname()
+		}
+	case fieldPath:
+		if u != nil {
+			return u.EscapedPath()
+		}
+	case fieldQuery:
+		if u != nil {
+			return u.RawQuery
+		}
+	case fieldExtension:
+		if u != nil {
+			return strings.ToLower(strings.TrimPrefix(path.Ext(u.Path), "."))
+		}
+	case fieldSnapshot:
+		if r.waybackLinks() {
+			return rec.SnapshotURL()
+		}
+	default:
+		return rec.Get(f)
+	}
+	return ""
+}
+
+// spreadsheetSafe neutralizes a cell that a spreadsheet would evaluate as a
+// formula. Archived URLs are attacker-influenced, so a capture of
+// "=HYPERLINK(...)" must not become a live formula in the analyst's sheet:
+// such cells get a leading apostrophe, which spreadsheets hide and treat as
+// "text".
+func spreadsheetSafe(v string) string {
+	if v != "" && strings.ContainsRune("=+-@", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+// tableRow renders one CSV/TSV row (without the line terminator) with every
+// value sanitized and spreadsheet-safe; csv.Writer adds quoting where needed.
+func tableRow(sep rune, cells []string) string {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Comma = sep
+	for i, c := range cells {
+		cells[i] = spreadsheetSafe(sanitizeForTerminal(c))
+	}
+	w.Write(cells)
+	w.Flush()
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// tableSep returns the column separator of the active table mode.
+func (r *Runner) tableSep() rune {
+	if r.cfg.TSV {
+		return '\t'
+	}
+	return ','
+}
+
+// printTable writes CSV/TSV rows of the --fields columns. The header row is
+// written once per run, and not at all when appending to a resumed output.
+// Rows are deduplicated per --collapse, like JSON records.
+func (r *Runner) printTable(bufw *bufio.Writer, resultsCh <-chan string, pagesCompleted *int32) {
+	sep := r.tableSep()
+	if !r.headerDone && len(r.known) == 0 {
+		r.pbar.ClearLine()
+		fmt.Fprintln(bufw, tableRow(sep, append([]string(nil), r.fields...)))
+		bufw.Flush()
+	}
+	r.headerDone = true
+
+	seen := r.newDedup()
+	cols := r.cdxFields()
+	for res := range r.results(resultsCh) {
+		rec, ok := cdx.ParseRecord(res, cols)
+		if !ok || rec.Original == "" {
+			continue
+		}
+		u, err := url.Parse(rec.Original)
+		if err != nil {
+			u = nil
+		}
+		cells := make([]string, len(r.fields))
+		for i, f := range r.fields {
+			cells[i] = r.fieldValue(f, rec, u)
+		}
+		row := tableRow(sep, cells)
+		// A resumed output lacking the key columns can only be matched row
+		// by row.
+		if !seen.add(r.collapse.key(rec)) || (!r.tableKeyed() && seen.isKnown(row)) {
+			continue
+		}
+		r.pbar.ClearLine()
+		fmt.Fprintln(bufw, row)
+		bufw.Flush()
+		atomic.AddInt64(&r.found, 1)
+		r.renderProgress(pagesCompleted)
+	}
+	r.finishOutput(bufw)
+}
+
+// tableKeyed reports whether printed rows carry every column of the
+// --collapse key (the original URL, plus timestamp or digest unless
+// collapsing by urlkey), so a resumed output can be keyed like fresh rows.
+func (r *Runner) tableKeyed() bool {
+	f := r.collapse.field()
+	return r.tableKeyCol >= 0 && (f == "" || slices.Contains(r.fields, f))
+}
+
+// tableKey derives the dedup key of a CSV/TSV row read back from a resumed
+// output file: the --collapse key built from its cells, with any spreadsheet
+// guard removed, or the whole row when the key columns were not selected.
+func (r *Runner) tableKey(line string) string {
+	line = strings.TrimRight(line, "\r\n")
+	if !r.tableKeyed() || line == "" {
+		return line
+	}
+	cr := csv.NewReader(strings.NewReader(line))
+	cr.Comma = r.tableSep()
+	cr.LazyQuotes = true
+	cells, err := cr.Read()
+	if err != nil || len(cells) != len(r.fields) {
+		return ""
+	}
+	var rec cdx.Record
+	for i, f := range r.fields {
+		v := cells[i]
+		if len(v) > 1 && v[0] == '\'' && strings.ContainsRune("=+-@", rune(v[1])) {
+			v = v[1:]
+		}
+		switch f {
+		case cdx.FieldOriginal:
+			rec.Original = v
+		case cdx.FieldTimestamp:
+			rec.Timestamp = v
+		case cdx.FieldDigest:
+			rec.Digest = v
+		}
+	}
+	return r.collapse.key(rec)
+}
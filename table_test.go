@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
+)
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{"", []string{"original", "timestamp", "statuscode", "mimetype"}, false},
+		{"url, Status ,mime,ext", []string{"original", "statuscode", "mimetype", "extension"}, false},
+		{"host,snapshot,digest", []string{"host", "snapshot", "digest"}, false},
+		{"original,bogus", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseFields(tt.in)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseFields(%q) = %v, %v; want %v, err=%v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestTableCDXFields(t *testing.T) {
+	got := tableCDXFields([]string{"host", "statuscode", "snapshot", "digest", "timestamp"})
+	want := []string{"original", "statuscode", "timestamp", "digest"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tableCDXFields = %v, want %v", got, want)
+	}
+}
+
+func TestTableRow(t *testing.T) {
+	tests := []struct {
+		name  string
+		sep   rune
+		cells []string
+		want  string
+	}{
+		{"plain", ',', []string{"http://a/x", "200"}, "http://a/x,200"},
+		{"comma is quoted", ',', []string{"http://a/?q=1,2", "200"}, `"http://a/?q=1,2",200`},
+		{"quote is doubled", ',', []string{`http://a/"x"`}, `"http://a/""x"""`},
+		{"formula is neutralized", ',', []string{"=HYPERLINK(\"http://evil\")", "-1", "+x", "@SUM(A1)"},
+			`"'=HYPERLINK(""http://evil"")",'-1,'+x,'@SUM(A1)`},
+		{"control bytes stripped", '\t', []string{"http://a/\x1b[31mred", "x\ty"}, "http://a/[31mred\txy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tableRow(tt.sep, tt.cells); got != tt.want {
+				t.Errorf("tableRow = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldValue(t *testing.T) {
+	r := &Runner{cfg: &Config{}}
+	rec := cdx.Record{Original: "http://Sub.Example.com:8080/a/b/File.PHP?x=1&y=2", Timestamp: "20200102030405"}
+	u, _ := url.Parse(rec.Original)
+	for field, want := range map[string]string{
+		"host":      "Sub.Example.com",
+		"path":      "/a/b/File.PHP",
+		"query":     "x=1&y=2",
+		"extension": "php",
+		"snapshot":  "https://web.archive.org/web/20200102030405/http://Sub.Example.com:8080/a/b/File.PHP?x=1&y=2",
+		"timestamp": "20200102030405",
+	} {
+		if got := r.fieldValue(field, rec, u); got != want {
+			t.Errorf("%s = %q, want %q", field, got, want)
+		}
+	}
+	r.cfg.Source = sourceCommonCrawl
+	if got := r.fieldValue("snapshot", rec, u); got != "" {
+		t.Errorf("snapshot for Common Crawl = %q, want empty", got)
+	}
+}
+
+func TestTableKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   string
+		keyCol   int
+		collapse string
+		line     string
+		want     string
+	}{
+		{"by url", "original,statuscode", 0, "", "http://a/1,200\n", "http://a/1"},
+		{"guard removed", "statuscode,original", 1, "", "200,'-x\n", "-x"},
+		{"no url column: whole row", "host,path", -1, "", "a,/1\n", "a,/1"},
+		{"digest collapse", "original,digest", 0, "digest", "http://a/1,ABC\n", "http://a/1 ABC"},
+		{"year collapse", "timestamp,original", 1, "timestamp:4", "20200102,http://a/1\n", "http://a/1 2020"},
+		{"collapse column not printed: whole row", "original,statuscode", 0, "digest", "http://a/1,200\n", "http://a/1,200"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Runner{cfg: &Config{CSV: true}, tableKeyCol: tt.keyCol}
+			r.fields, _ = parseFields(tt.fields)
+			r.collapse, _ = parseCollapse(tt.collapse)
+			if got := r.tableKey(tt.line); got != tt.want {
+				t.Errorf("tableKey(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
+)
+
+// templateRecord is what a --template is executed with: one capture, its URL
+// split into parts, and its CDX metadata. Every value is sanitized; CDX "-"
+// placeholders are empty.
+type templateRecord struct {
+	URL       string            // original URL as archived
+	Scheme    string            // "http", "https", ...
+	Host      string            // host[:port]
+	Hostname  string            // host without port
+	Port      string            // explicit port, if any
+	Path      string            // escaped path
+	Query     string            // raw query string, without "?"
+	Fragment  string            // fragment, without "#"
+	Extension string            // lower-case path extension, without "."
+	Params    map[string]string // first value of each query parameter
+	Timestamp string            // yyyyMMddhhmmss
+	Time      string            // Timestamp as RFC 3339, UTC
+	Status    string
+	Mime      string
+	Length    string
+	Digest    string
+	URLKey    string
+	Snapshot  string // Wayback snapshot page (Wayback source only)
+	Replay    string // raw capture on web.archive.org (Wayback source only)
+}
+
+// templateFuncs are the helpers available to --template in addition to the
+// text/template builtins (printf, urlquery, ...).
+var templateFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"shellquote": shellQuote,
+	"mdcell":     func(s string) string { return strings.ReplaceAll(s, "|", `\|`) },
+}
+
+// shellQuote single-quotes s for POSIX shells, so archived URLs can be pasted
+// into generated curl commands without being interpreted.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// parseTemplate compiles a --template and dry-runs it on an empty record, so
+// a misspelled field is reported up front rather than on the first result.
+// Missing query parameters render as empty strings.
+func parseTemplate(text string) (*template.Template, error) {
+	t, err := template.New("template").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Execute(io.Discard, templateRecord{Params: map[string]string{}}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// newTemplateRecord builds the template data for a CDX line (jsonFields
+// columns). Returns ok=false for blank lines.
+func (r *Runner) newTemplateRecord(line string) (templateRecord, bool) {
+	rec, ok := cdx.ParseRecord(line, jsonFields)
+	if !ok || rec.Original == "" {
+		return templateRecord{}, false
+	}
+	tr := templateRecord{
+		URL:       sanitizeForTerminal(rec.Original),
+		Params:    map[string]string{},
+		Timestamp: sanitizeForTerminal(rec.Timestamp),
+		Status:    sanitizeForTerminal(rec.StatusCode),
+		Mime:      sanitizeForTerminal(rec.MimeType),
+		Length:    sanitizeForTerminal(rec.Length),
+		Digest:    sanitizeForTerminal(rec.Digest),
+		URLKey:    sanitizeForTerminal(rec.URLKey),
+	}
+	if t, err := rec.Time(); err == nil {
+		tr.Time = t.Format(time.RFC3339)
+	}
+	if r.waybackLinks() {
+		tr.Snapshot = sanitizeForTerminal(rec.SnapshotURL())
+		tr.Replay = sanitizeForTerminal(rec.ReplayURL())
+	}
+	if u, err := url.Parse(rec.Original); err == nil {
+		tr.Scheme = sanitizeForTerminal(u.Scheme)
+		tr.Host = sanitizeForTerminal(u.Host)
+		tr.Hostname = sanitizeForTerminal(u.Hostname())
+		tr.Port = sanitizeForTerminal(u.Port())
+		tr.Path = sanitizeForTerminal(u.EscapedPath())
+		tr.Query = sanitizeForTerminal(u.RawQuery)
+		tr.Fragment = sanitizeForTerminal(u.Fragment)
+		tr.Extension = sanitizeForTerminal(strings.ToLower(strings.TrimPrefix(path.Ext(u.Path), ".")))
+		for k, vs := range u.Query() {
+			if len(vs) > 0 {
+				tr.Params[sanitizeForTerminal(k)] = sanitizeForTerminal(vs[0])
+			}
+		}
+	}
+	return tr, true
+}
+
+// probeRecord has every templateRecord field set, for multiLineTemplate.
+var probeRecord = templateRecord{
+	URL:       "http://example.com:8080/a/b.html?q=1#top",
+	Scheme:    "http",
+	Host:      "example.com:8080",
+	Hostname:  "example.com",
+	Port:      "8080",
+	Path:      "/a/b.html",
+	Query:     "q=1",
+	Fragment:  "top",
+	Extension: "html",
+	Params:    map[string]string{"q": "1"},
+	Timestamp: "20200102030405",
+	Time:      "2020-01-02T03:04:05Z",
+	Status:    "200",
+	Mime:      "text/html",
+	Length:    "1234",
+	Digest:    "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA",
+	URLKey:    "com,example:8080)/a/b.html?q=1",
+	Snapshot:  "https://web.archive.org/web/20200102030405/http://example.com:8080/a/b.html?q=1",
+	Replay:    "https://web.archive.org/web/20200102030405id_/http://example.com:8080/a/b.html?q=1",
+}
+
+// multiLineTemplate reports whether t renders a typical record on several
+// lines. A template that only does so for some records slips through;
+// printTemplate checks each record as well where that matters.
+func multiLineTemplate(t *template.Template) bool {
+	out, err := renderTemplate(t, probeRecord)
+	return err == nil && strings.Contains(out, "\n")
+}
+
+// renderTemplate executes t for tr and returns the record's output as
+// printed, without the final newline.
+func renderTemplate(t *template.Template, tr templateRecord) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, tr); err != nil {
+		return "", err
+	}
+	return sanitizeRendered(strings.TrimRight(buf.String(), "\n")), nil
+}
+
+// sanitizeRendered applies sanitizeForTerminal to rendered template output
+// while keeping the tabs and newlines the template itself produced: values are
+// already sanitized, so any layout characters left come from the template.
+func sanitizeRendered(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		cells := strings.Split(l, "\t")
+		for j, c := range cells {
+			cells[j] = sanitizeForTerminal(c)
+		}
+		lines[i] = strings.Join(cells, "\t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// printTemplate renders each record with the --template. Records are
+// deduplicated per --collapse, like the other record modes, and output by
+// rendered text as well, so a template that only prints part of the URL
+// yields each distinct value once. Records rendering to nothing are skipped;
+// an execution error is reported once and the record skipped. When the output
+// is matched line by line, a record rendering to several lines is not written
+// and the target is recorded as incomplete.
+func (r *Runner) printTemplate(bufw *bufio.Writer, resultsCh <-chan string, pagesCompleted *int32) {
+	seen := r.newDedup()
+	captures := make(map[string]struct{}) // --collapse keys
+	warned, multiLine := false, false
+	for res := range r.results(resultsCh) {
+		rec, ok := cdx.ParseRecord(res, jsonFields)
+		if !ok || rec.Original == "" {
+			continue
+		}
+		key := r.collapse.key(rec)
+		if _, dup := captures[key]; dup {
+			continue
+		}
+		captures[key] = struct{}{}
+		tr, ok := r.newTemplateRecord(res)
+		if !ok {
+			continue
+		}
+		out, err := renderTemplate(r.tmpl, tr)
+		if err != nil {
+			if !warned {
+				r.notify(levelWarn, "template: %v", err)
+				warned = true
+			}
+			continue
+		}
+		if strings.Contains(out, "\n") && r.cfg.matchesOutputLines() {
+			// validate() only catches templates that always break lines; a
+			// record written on several lines would never match on resume.
+			if !multiLine {
+				err := fmt.Errorf("template rendered %s on several lines, which --append, --checkpoint and --resume cannot match; such records are not written", tr.URL)
+				r.notify(levelError, "%v", err)
+				r.recordFailure(r.currentPattern, -1, "", err)
+				multiLine = true
+			}
+			continue
+		}
+		if strings.TrimSpace(out) == "" || !seen.add(out) {
+			continue
+		}
+		r.pbar.ClearLine()
+		fmt.Fprintln(bufw, out)
+		bufw.Flush()
+		atomic.AddInt64(&r.found, 1)
+		r.renderProgress(pagesCompleted)
+	}
+	r.finishOutput(bufw)
+}
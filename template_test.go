@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTemplateRender(t *testing.T) {
+	line := "https://example.com:8443/api/v1/users.json?id=7&q=a%20b&id=8 20200102030405 200 application/json ABCDEF 512 com,example:8443)/api/v1/users.json?id=7&id=8&q=a+b"
+	tests := []struct {
+		name   string
+		tmpl   string
+		source string
+		want   string
+	}{
+		{"url parts", "{{.Scheme}} {{.Host}} {{.Hostname}} {{.Port}} {{.Path}} {{.Extension}}", "",
+			"https example.com:8443 example.com 8443 /api/v1/users.json json"},
+		{"params", "{{.Params.id}} {{.Params.q}} [{{.Params.missing}}]", "", "7 a b []"},
+		{"range over params is sorted", "{{range $k, $v := .Params}}{{$k}}={{$v}};{{end}}", "", "id=7;q=a b;"},
+		{"metadata", "{{.Status}} {{.Mime}} {{.Length}} {{.Digest}} {{.Time}}", "",
+			"200 application/json 512 ABCDEF 2020-01-02T03:04:05Z"},
+		{"ffuf target", "{{.Scheme}}://{{.Host}}{{.Path}}?FUZZ", "", "https://example.com:8443/api/v1/users.json?FUZZ"},
+		{"curl command", "curl -s {{shellquote .URL}}", "",
+			"curl -s 'https://example.com:8443/api/v1/users.json?id=7&q=a%20b&id=8'"},
+		{"helpers", `{{.Hostname | upper}} {{replace "/" "_" .Path}} {{mdcell "a|b"}}`, "",
+			"EXAMPLE.COM _api_v1_users.json a\\|b"},
+		{"replay on wayback", "{{.Replay}}", "",
+			"https://web.archive.org/web/20200102030405id_/https://example.com:8443/api/v1/users.json?id=7&q=a%20b&id=8"},
+		{"no replay for other sources", "[{{.Replay}}{{.Snapshot}}]", sourceCommonCrawl, "[]"},
+		{"template tabs and newlines kept", "{{.Status}}\t{{.Hostname}}\n{{.Port}}", "", "200\texample.com\n8443"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseTemplate(tt.tmpl)
+			if err != nil {
+				t.Fatalf("parseTemplate: %v", err)
+			}
+			r := &Runner{cfg: &Config{Source: tt.source}}
+			rec, ok := r.newTemplateRecord(line)
+			if !ok {
+				t.Fatal("newTemplateRecord: not ok")
+			}
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, rec); err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			if got := sanitizeRendered(buf.String()); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateSanitizesValues(t *testing.T) {
+	tmpl, _ := parseTemplate("{{.URL}}|{{.Path}}|{{.Params.x}}")
+	r := &Runner{cfg: &Config{}}
+	rec, ok := r.newTemplateRecord("http://example.com/a%1b[31mb?x=%07%09y 20200101 200 text/html")
+	if !ok {
+		t.Fatal("newTemplateRecord: not ok")
+	}
+	var buf bytes.Buffer
+	tmpl.Execute(&buf, rec)
+	// Decoded control bytes in a query value must not reach the terminal,
+	// while percent-encoded bytes stay encoded.
+	got := sanitizeRendered(buf.String())
+	if want := "http://example.com/a%1b[31mb?x=%07%09y|/a%1b[31mb|y"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMultiLineTemplate(t *testing.T) {
+	tests := map[string]bool{
+		"{{.URL}}":                       false,
+		"{{.URL}}\n":                     false, // a template file's final newline
+		"{{.URL}}\r\n":                   false,
+		`{{.URL}}\n`:                     false, // a literal backslash and n
+		"{{.URL}}\n{{.Status}}":          true,
+		`{{printf "%s\n%s" .URL .Mime}}`: true,
+		`{{.URL}}{{if .Params.q}}{{"\n"}}q{{end}}`: true, // rendered, not just read
+	}
+	for text, want := range tests {
+		tmpl, err := parseTemplate(text)
+		if err != nil {
+			t.Fatalf("parseTemplate(%q): %v", text, err)
+		}
+		if got := multiLineTemplate(tmpl); got != want {
+			t.Errorf("multiLineTemplate(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	for _, text := range []string{"{{.URL", "{{.NoSuchField}}", "{{nosuchfunc .URL}}"} {
+		if _, err := parseTemplate(text); err == nil {
+			t.Errorf("parseTemplate(%q) = nil error, want one", text)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+
+	"github.com/OoS-MaMaD/gowaybackgo/cdx"
+)
+
+// --timeline-by periods.
+const (
+	periodYear  = "year"
+	periodMonth = "month"
+)
+
+// sparkBlocks are the sparkline levels, lowest first. Periods without
+// captures are drawn as a space so gaps stand out.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// periodDigits returns the timestamp prefix length of a --timeline-by period.
+func periodDigits(period string) int {
+	if period == periodMonth {
+		return 6
+	}
+	return 4
+}
+
+// periodIndex maps a CDX timestamp to a consecutive period number (years, or
+// months since year 0), so runs of periods can be walked without gaps.
+func periodIndex(ts string, digits int) (int, bool) {
+	if len(ts) < digits {
+		return 0, false
+	}
+	y, err := strconv.Atoi(ts[:4])
+	if err != nil {
+		return 0, false
+	}
+	if digits == 4 {
+		return y, true
+	}
+	m, err := strconv.Atoi(ts[4:6])
+	if err != nil || m < 1 || m > 12 {
+		return 0, false
+	}
+	return y*12 + m - 1, true
+}
+
+// periodLabel is the inverse of periodIndex: "2019" or "2019-03".
+func periodLabel(i, digits int) string {
+	if digits == 4 {
+		return fmt.Sprintf("%04d", i)
+	}
+	return fmt.Sprintf("%04d-%02d", i/12, i%12+1)
+}
+
+// timelineGroup counts the captures of one host (and top-level path, with
+// --timeline-paths) per period.
+type timelineGroup struct {
+	host, path string
+	counts     map[int]int
+}
+
+// timelineRow is one group's --timeline output: a table row, or one JSONL
+// object with --json. Counts covers every period from First to Last,
+// including the empty ones also listed in Gaps.
+type timelineRow struct {
+	Host      string         `json:"host"`
+	Path      string         `json:"path,omitempty"`
+	Period    string         `json:"period"`
+	Total     int            `json:"total"`
+	First     string         `json:"first"`
+	Last      string         `json:"last"`
+	Peak      string         `json:"peak"`
+	Counts    map[string]int `json:"counts"`
+	Gaps      []string       `json:"gaps"` // runs of empty periods, "2019" or "2019..2020"
+	Sparkline string         `json:"sparkline"`
+}
+
+// row summarizes g over periods of the given length.
+func (g *timelineGroup) row(period string, digits int) timelineRow {
+	first, last, total := 0, 0, 0
+	for i, n := range g.counts {
+		if total == 0 || i < first {
+			first = i
+		}
+		if total == 0 || i > last {
+			last = i
+		}
+		total += n
+	}
+	peak := first
+	for i := first; i <= last; i++ {
+		if g.counts[i] > g.counts[peak] {
+			peak = i
+		}
+	}
+	out := timelineRow{
+		Host:   g.host,
+		Path:   g.path,
+		Period: period,
+		Total:  total,
+		First:  periodLabel(first, digits),
+		Last:   periodLabel(last, digits),
+		Peak:   periodLabel(peak, digits),
+		Counts: make(map[string]int, last-first+1),
+		Gaps:   []string{},
+	}
+	top := g.counts[peak]
+	var spark strings.Builder
+	gapStart := -1
+	for i := first; i <= last; i++ {
+		n := g.counts[i]
+		out.Counts[periodLabel(i, digits)] = n
+		if n == 0 {
+			spark.WriteRune(' ')
+			if gapStart < 0 {
+				gapStart = i
+			}
+			continue
+		}
+		// Any capture gets at least the lowest block, so it is never
+		// mistaken for a gap.
+		spark.WriteRune(sparkBlocks[(n*len(sparkBlocks)-1)/top])
+		if gapStart >= 0 {
+			out.Gaps = append(out.Gaps, periodRange(gapStart, i-1, digits))
+			gapStart = -1
+		}
+	}
+	out.Sparkline = spark.String()
+	return out
+}
+
+// periodRange formats the periods from a to b inclusive.
+func periodRange(a, b, digits int) string {
+	if a == b {
+		return periodLabel(a, digits)
+	}
+	return periodLabel(a, digits) + ".." + periodLabel(b, digits)
+}
+
+// topLevelPath returns the first segment of an URL path ("/api" for
+// "/api/v1/users"), or "/" for the root and files directly under it.
+func topLevelPath(p string) string {
+	p = strings.TrimPrefix(p, "/")
+	seg, _, nested := strings.Cut(p, "/")
+	if !nested || seg == "" {
+		return "/"
+	}
+	return "/" + seg
+}
+
+// printTimeline aggregates the target's captures per period and writes one
+// row per host (or host and top-level path) once the target is done: a table
+// with a sparkline, or JSONL with --json.
+func (r *Runner) printTimeline(bufw *bufio.Writer, resultsCh <-chan string, pagesCompleted *int32) {
+	period := r.cfg.TimelineBy
+	if period == "" {
+		period = periodYear
+	}
+	digits := periodDigits(period)
+	seen := r.newDedup()
+	groups := make(map[string]*timelineGroup)
+	for res := range r.results(resultsCh) {
+		rec, ok := cdx.ParseRecord(res, r.cdxFields())
+		if !ok || !seen.add(r.collapse.key(rec)) {
+			continue
+		}
+		i, ok := periodIndex(rec.Timestamp, digits)
+		if !ok {
+			continue
+		}
+		u, err := url.Parse(rec.Original)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		host := sanitizeForTerminal(strings.ToLower(u.Hostname()))
+		var path string
+		if r.cfg.TimelinePaths {
+			path = sanitizeForTerminal(topLevelPath(u.EscapedPath()))
+		}
+		key := host + " " + path
+		g := groups[key]
+		if g == nil {
+			g = &timelineGroup{host: host, path: path, counts: make(map[int]int)}
+			groups[key] = g
+		}
+		g.counts[i]++
+		atomic.AddInt64(&r.found, 1)
+		r.renderProgress(pagesCompleted)
+	}
+	if len(groups) == 0 {
+		return
+	}
+
+	rows := make([]timelineRow, 0, len(groups))
+	for _, g := range groups {
+		rows = append(rows, g.row(period, digits))
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Host != rows[j].Host {
+			return rows[i].Host < rows[j].Host
+		}
+		return rows[i].Path < rows[j].Path
+	})
+
+	r.pbar.ClearLine()
+	if r.cfg.JSON {
+		enc := json.NewEncoder(bufw)
+		enc.SetEscapeHTML(false)
+		for _, row := range rows {
+			enc.Encode(row)
+		}
+		r.finishOutput(bufw)
+		return
+	}
+	tw := tabwriter.NewWriter(bufw, 0, 0, 2, ' ', 0)
+	header := "HOST\t"
+	if r.cfg.TimelinePaths {
+		header += "PATH\t"
+	}
+	fmt.Fprintln(tw, header+"CAPTURES\tFIRST\tLAST\tPEAK\tACTIVITY\tGAPS")
+	for _, row := range rows {
+		cells := row.Host + "\t"
+		if r.cfg.TimelinePaths {
+			cells += row.Path + "\t"
+		}
+		gaps := strings.Join(row.Gaps, ",")
+		if gaps == "" {
+			gaps = "-"
+		}
+		fmt.Fprintf(tw, "%s%d\t%s\t%s\t%s\t%s\t%s\n", cells, row.Total, row.First, row.Last, row.Peak, row.Sparkline, gaps)
+	}
+	tw.Flush()
+	r.finishOutput(bufw)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPeriodIndex(t *testing.T) {
+	tests := []struct {
+		ts     string
+		digits int
+		want   string
+		ok     bool
+	}{
+		{"20190315120000", 4, "2019", true},
+		{"20190315120000", 6, "2019-03", true},
+		{"201912", 6, "2019-12", true},
+		{"2019", 6, "", false},
+		{"20191315", 6, "", false},
+		{"abcd0101", 4, "", false},
+	}
+	for _, tt := range tests {
+		i, ok := periodIndex(tt.ts, tt.digits)
+		if ok != tt.ok || (ok && periodLabel(i, tt.digits) != tt.want) {
+			t.Errorf("periodIndex(%q, %d) = %d (%s), %v; want %s, %v", tt.ts, tt.digits, i, periodLabel(i, tt.digits), ok, tt.want, tt.ok)
+		}
+	}
+	// Months are consecutive across a year boundary.
+	dec, _ := periodIndex("201912", 6)
+	jan, _ := periodIndex("202001", 6)
+	if jan != dec+1 {
+		t.Errorf("2020-01 index %d, want 2019-12 index %d + 1", jan, dec)
+	}
+}
+
+func TestTimelineRow(t *testing.T) {
+	g := &timelineGroup{host: "example.com", counts: map[int]int{2014: 1, 2015: 8, 2018: 4, 2020: 2}}
+	got := g.row(periodYear, 4)
+	want := timelineRow{
+		Host:      "example.com",
+		Period:    periodYear,
+		Total:     15,
+		First:     "2014",
+		Last:      "2020",
+		Peak:      "2015",
+		Counts:    map[string]int{"2014": 1, "2015": 8, "2016": 0, "2017": 0, "2018": 4, "2019": 0, "2020": 2},
+		Gaps:      []string{"2016..2017", "2019"},
+		Sparkline: "▁█  ▄ ▂",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("row =\n%+v\nwant\n%+v", got, want)
+	}
+
+	m := &timelineGroup{counts: map[int]int{2019*12 + 11: 3, 2020*12 + 1: 3}}
+	if got := m.row(periodMonth, 6); got.First != "2019-12" || got.Last != "2020-02" ||
+		!reflect.DeepEqual(got.Gaps, []string{"2020-01"}) || got.Sparkline != "█ █" {
+		t.Errorf("month row = %+v", got)
+	}
+}
+
+func TestTopLevelPath(t *testing.T) {
+	for in, want := range map[string]string{
+		"":              "/",
+		"/":             "/",
+		"/index.html":   "/",
+		"/api/v1/users": "/api",
+		"/api/":         "/api",
+		"//x":           "/",
+	} {
+		if got := topLevelPath(in); got != want {
+			t.Errorf("topLevelPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// URL parts a --match-*/--filter-* regex applies to.
+const (
+	partURL   = "url"
+	partHost  = "host"
+	partPath  = "path"
+	partQuery = "query"
+)
+
+// urlRule is one --match-* or --filter-* regex.
+type urlRule struct {
+	part  string // partURL, partHost, partPath, or partQuery
+	match bool   // keep only matching URLs; false drops them
+	re    *regexp.Regexp
+}
+
+// urlFilter keeps or drops URLs by regexes on the whole URL or one part of
+// it, applied locally to every URL the index returns. A URL is kept when,
+// for each part with --match-* regexes, at least one of them matches, and no
+// --filter-* regex matches.
+type urlFilter struct {
+	rules []urlRule
+}
+
+// newURLFilter compiles the --match-*/--filter-* flags of cfg. It returns nil
+// when none are set.
+func newURLFilter(cfg *Config) (*urlFilter, error) {
+	f := &urlFilter{}
+	for _, set := range []struct {
+		flag  string
+		part  string
+		match bool
+		exprs []string
+	}{
+		{"--match-regex", partURL, true, cfg.MatchRegex},
+		{"--match-host", partHost, true, cfg.MatchHost},
+		{"--match-path", partPath, true, cfg.MatchPath},
+		{"--match-query", partQuery, true, cfg.MatchQuery},
+		{"--filter-regex", partURL, false, cfg.FilterRegex},
+		{"--filter-host", partHost, false, cfg.FilterHost},
+		{"--filter-path", partPath, false, cfg.FilterPath},
+		{"--filter-query", partQuery, false, cfg.FilterQuery},
+	} {
+		for _, expr := range set.exprs {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", set.flag, err)
+			}
+			f.rules = append(f.rules, urlRule{part: set.part, match: set.match, re: re})
+		}
+	}
+	if len(f.rules) == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// keep reports whether the URL raw (parsed as u, nil if it did not parse)
+// passes the filter. The host is matched lowercased and without the port; a
+// URL that does not parse has no host, path, or query.
+func (f *urlFilter) keep(raw string, u *url.URL) bool {
+	part := func(name string) string {
+		switch {
+		case name == partURL:
+			return raw
+		case u == nil:
+			return ""
+		case name == partHost:
+			return strings.ToLower(u.Hostname())
+		case name == partPath:
+			return u.Path
+		}
+		return u.RawQuery
+	}
+	matched := make(map[string]bool) // part -> some --match-* regex matched
+	for _, rule := range f.rules {
+		hit := rule.re.MatchString(part(rule.part))
+		if !rule.match {
+			if hit {
+				return false
+			}
+			continue
+		}
+		matched[rule.part] = matched[rule.part] || hit
+	}
+	for _, ok := range matched {
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
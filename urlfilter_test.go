@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestURLFilter(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		url  string
+		want bool
+	}{
+		{"match-regex any of several", Config{MatchRegex: []string{"/admin", "/internal"}}, "http://example.com/admin/", true},
+		{"match-regex none matches", Config{MatchRegex: []string{"/admin", "/internal"}}, "http://example.com/home", false},
+		{"filter-regex drops", Config{FilterRegex: []string{"/static/"}}, "http://example.com/static/app.css", false},
+		{"filter wins over match", Config{MatchRegex: []string{"admin"}, FilterRegex: []string{"\\.png$"}}, "http://example.com/admin/logo.png", false},
+		{"host is lowercased without port", Config{MatchHost: []string{"^api\\.example\\.com$"}}, "http://API.example.com:8080/x", true},
+		{"host regex ignores the path", Config{MatchHost: []string{"^api\\."}}, "http://example.com/api.example.com", false},
+		{"path regex ignores the host", Config{FilterPath: []string{"admin"}}, "http://admin.example.com/", true},
+		{"query regex", Config{MatchQuery: []string{"(^|&)redirect="}}, "http://example.com/?a=1&redirect=x", true},
+		{"query regex without query", Config{MatchQuery: []string{"id="}}, "http://example.com/p", false},
+		{"every part must match", Config{MatchHost: []string{"^api\\."}, MatchPath: []string{"^/v2/"}}, "http://api.example.com/v1/users", false},
+		{"unparsable url only has the url part", Config{MatchRegex: []string{"%zz"}, FilterPath: []string{"."}}, "http://example.com/%zz", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newURLFilter(&tt.cfg)
+			if err != nil {
+				t.Fatalf("newURLFilter: %v", err)
+			}
+			u, _ := url.Parse(tt.url)
+			if got := f.keep(tt.url, u); got != tt.want {
+				t.Errorf("keep(%q) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewURLFilter(t *testing.T) {
+	if f, err := newURLFilter(&Config{}); f != nil || err != nil {
+		t.Errorf("no flags: got %v, %v; want nil, nil", f, err)
+	}
+	if _, err := newURLFilter(&Config{FilterPath: []string{"("}}); err == nil {
+		t.Error("invalid regex: want an error")
+	}
+}
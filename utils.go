@@ -34,6 +34,18 @@ func CompileExtRegex(includeCSV, excludeCSV string) (*regexp.Regexp, bool, error
 	return re, includeMode, err
 }
 
+// splitCSV splits a comma-separated flag value, trimming spaces and dropping
+// empty items.
+func splitCSV(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
 // sanitizeForTerminal strips control and escape characters from untrusted data
 // before it is printed. Archived URLs come from the Wayback CDX API, which is
 // attacker-influenced (anyone can archive a crafted URL), so a raw line could